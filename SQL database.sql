@@ -136,9 +136,10 @@ SHOW TABLES;
 -- Create an index for `is_available` to optimize availability queries
 CREATE INDEX idx_vehicle_is_available ON vehicles(is_available);
 
--- Enforce no overlapping reservations for the same vehicle
-CREATE UNIQUE INDEX idx_no_overlap ON bookings(vehicle_id, start_time, end_time)
-WHERE status = 'confirmed';
+-- Booking and vehicle search check each vehicle for bookings overlapping the requested
+-- window. MySQL has no partial indexes, so overlaps are rejected by those checks rather
+-- than by a unique index
+CREATE INDEX idx_bookings_vehicle_time ON bookings(vehicle_id, start_time, end_time);
 
 
 
@@ -173,3 +174,560 @@ ADD FOREIGN KEY (payment_method_id) REFERENCES payment_methods(id);
 -- Modify invoices table to include payment_status and track if it’s been paid
 ALTER TABLE invoices
 ADD COLUMN payment_status ENUM('unpaid', 'paid', 'refunded') DEFAULT 'unpaid';  -- Track payment status of invoices
+
+-- Login sessions: each row backs one refresh token so access tokens can be revoked server-side
+CREATE TABLE IF NOT EXISTS user_sessions (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    refresh_token_hash CHAR(64) NOT NULL UNIQUE,   -- SHA-256 of the current refresh token
+    previous_token_hash CHAR(64),                  -- SHA-256 of the last rotated token, used to detect reuse
+    user_agent VARCHAR(255),
+    ip_address VARCHAR(45),
+    expires_at DATETIME NOT NULL,
+    revoked_at DATETIME NULL,
+    last_used_at DATETIME NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    INDEX idx_user_sessions_user (user_id),
+    INDEX idx_user_sessions_previous (previous_token_hash)
+);
+
+-- Password reset tokens: single-use, expiring, stored as SHA-256 digests
+CREATE TABLE IF NOT EXISTS password_reset_tokens (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    expires_at DATETIME NOT NULL,
+    used_at DATETIME NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+-- TOTP two-factor authentication
+ALTER TABLE users
+ADD COLUMN mfa_enabled BOOLEAN DEFAULT FALSE,   -- Set once the user confirms their first code
+ADD COLUMN mfa_secret VARCHAR(64) NULL,         -- Base32 TOTP secret (pending until mfa_enabled)
+ADD COLUMN mfa_last_step BIGINT NULL,           -- Last accepted TOTP time step, prevents code replay
+ADD COLUMN mfa_required BOOLEAN DEFAULT FALSE;  -- Forces enrolment at next login (e.g. admin accounts)
+
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    code_hash CHAR(64) NOT NULL,                -- SHA-256 of the recovery code
+    used_at DATETIME NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    INDEX idx_mfa_recovery_user (user_id)
+);
+
+-- Phone registration: email becomes optional for users who sign up with a phone number
+ALTER TABLE users
+MODIFY email VARCHAR(255) NULL,
+ADD COLUMN phone VARCHAR(16) NULL UNIQUE,       -- E.164 format, e.g. +6591234567
+ADD COLUMN phone_verified BOOLEAN DEFAULT FALSE;
+
+-- One-time codes sent by SMS for phone verification and passwordless login
+CREATE TABLE IF NOT EXISTS otp_codes (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    phone VARCHAR(16) NOT NULL,
+    purpose ENUM('verify_phone', 'login') NOT NULL,
+    code_hash CHAR(64) NOT NULL,                -- SHA-256 of the code
+    attempts INT DEFAULT 0,                     -- Failed verification attempts against this code
+    expires_at DATETIME NOT NULL,
+    consumed_at DATETIME NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_otp_phone_purpose (phone, purpose, created_at)
+);
+
+-- Split membership from authorization: the tier lives only in membership_tier_id and
+-- users.role no longer doubles as the membership name
+UPDATE users u
+JOIN membership_tiers mt ON mt.name = u.role
+SET u.membership_tier_id = mt.id;
+ALTER TABLE users DROP COLUMN role;
+
+-- Role-based access control for staff. Customers have no rows in user_roles.
+CREATE TABLE IF NOT EXISTS roles (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(50) NOT NULL UNIQUE,
+    description VARCHAR(255)
+);
+
+CREATE TABLE IF NOT EXISTS permissions (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(50) NOT NULL UNIQUE,           -- "<resource>:<action>", e.g. fleet:manage
+    description VARCHAR(255)
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role_id INT NOT NULL,
+    permission_id INT NOT NULL,
+    PRIMARY KEY (role_id, permission_id),
+    FOREIGN KEY (role_id) REFERENCES roles(id),
+    FOREIGN KEY (permission_id) REFERENCES permissions(id)
+);
+
+CREATE TABLE IF NOT EXISTS user_roles (
+    user_id INT NOT NULL,
+    role_id INT NOT NULL,
+    granted_by INT NULL,                        -- Admin who granted the role (NULL when seeded)
+    granted_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, role_id),
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (role_id) REFERENCES roles(id)
+);
+
+INSERT INTO roles (name, description)
+VALUES
+('admin', 'Full access, including role management'),
+('support', 'Customer support staff'),
+('fleet_manager', 'Manages vehicles and bookings'),
+('finance', 'Handles payments and refunds');
+
+INSERT INTO permissions (name, description)
+VALUES
+('users:read', 'View user accounts'),
+('users:manage', 'Change user account settings such as forced MFA'),
+('roles:manage', 'Grant and revoke staff roles'),
+('fleet:manage', 'Change vehicle availability and manage any booking'),
+('billing:refund', 'Issue refunds for payments');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r JOIN permissions p
+WHERE (r.name = 'admin')
+   OR (r.name = 'support' AND p.name IN ('users:read', 'users:manage'))
+   OR (r.name = 'fleet_manager' AND p.name IN ('fleet:manage', 'users:read'))
+   OR (r.name = 'finance' AND p.name IN ('billing:refund', 'users:read'));
+
+-- Bootstrap the first administrator (replace 1 with the user's ID), then manage roles through the admin API:
+-- INSERT INTO user_roles (user_id, role_id) SELECT 1, id FROM roles WHERE name = 'admin';
+-- UPDATE users SET mfa_required = TRUE WHERE id = 1;
+
+-- A refund updates the invoice of the payment it is taken from, which stays partially
+-- refunded until the whole payment has been refunded
+ALTER TABLE invoices
+ADD COLUMN payment_id INT NULL,
+ADD FOREIGN KEY (payment_id) REFERENCES payments(id),
+MODIFY COLUMN payment_status ENUM('unpaid', 'paid', 'partially_refunded', 'refunded') DEFAULT 'unpaid';
+
+-- Token signing keys, shared by every user-service replica so each one signs with and
+-- publishes the same keys. A new key is published in the JWKS before it starts signing.
+CREATE TABLE IF NOT EXISTS signing_keys (
+    id VARCHAR(64) PRIMARY KEY,                 -- Key ID: RFC 7638 thumbprint of the public key
+    private_key TEXT NOT NULL,                  -- PKCS #8 PEM
+    created_at DATETIME NOT NULL,
+    active_from DATETIME NOT NULL,              -- When the key starts signing new tokens
+    INDEX idx_signing_keys_created (created_at)
+);
+
+-- Login brute-force protection. State lives here so every user-service replica sees it.
+CREATE TABLE IF NOT EXISTS login_attempts (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    identifier VARCHAR(255) NOT NULL,           -- Email or phone the login was attempted for
+    user_id INT NULL,                           -- NULL when no account matches the identifier
+    ip_address VARCHAR(45),
+    succeeded BOOLEAN NOT NULL,
+    cleared BOOLEAN NOT NULL DEFAULT FALSE,     -- Set once a success or unlock resets the failure count
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_login_attempts_identifier (identifier, created_at),
+    INDEX idx_login_attempts_ip (ip_address, created_at)
+);
+
+ALTER TABLE users
+ADD COLUMN locked_until DATETIME NULL;         -- Login is refused until this time after too many failures
+
+CREATE TABLE IF NOT EXISTS account_unlock_tokens (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    token_hash CHAR(64) NOT NULL UNIQUE,        -- SHA-256 of the token in the emailed unlock link
+    expires_at DATETIME NOT NULL,
+    used_at DATETIME NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+-- Audit trail of security-relevant account events such as lockouts
+CREATE TABLE IF NOT EXISTS security_events (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NULL,
+    event_type VARCHAR(50) NOT NULL,            -- e.g. account_locked, account_unlocked
+    ip_address VARCHAR(45),
+    details VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_security_events_user (user_id, created_at)
+);
+
+-- Email verification tokens expire and can be re-sent; only their SHA-256 is stored
+CREATE TABLE IF NOT EXISTS email_verification_tokens (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    expires_at DATETIME NOT NULL,
+    used_at DATETIME NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    INDEX idx_email_verification_user (user_id, created_at)
+);
+
+-- Carry over links already emailed to unverified users, then drop the plaintext column
+INSERT INTO email_verification_tokens (user_id, token_hash, expires_at)
+SELECT id, SHA2(verification_token, 256), NOW() + INTERVAL 24 HOUR
+FROM users
+WHERE is_verified = FALSE AND verification_token IS NOT NULL;
+
+ALTER TABLE users DROP COLUMN verification_token;
+
+-- Pending email address changes; the address is only swapped once the new one is confirmed
+CREATE TABLE IF NOT EXISTS email_change_requests (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    new_email VARCHAR(255) NOT NULL,
+    token_hash CHAR(64) NOT NULL UNIQUE,        -- SHA-256 of the token in the link sent to the new address
+    expires_at DATETIME NOT NULL,
+    used_at DATETIME NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+-- Deleted accounts are anonymised rather than removed, because bookings, payments and
+-- invoices keep referencing them for accounting
+ALTER TABLE users
+ADD COLUMN deleted_at DATETIME NULL;
+
+-- Driver licences. A user needs an approved, unexpired licence before they can book.
+CREATE TABLE IF NOT EXISTS driver_licences (
+    user_id INT PRIMARY KEY,
+    licence_number VARCHAR(50) NOT NULL,
+    issuing_country CHAR(2) NOT NULL,           -- ISO 3166-1 alpha-2, e.g. SG
+    expiry_date DATE NOT NULL,
+    date_of_birth DATE NOT NULL,
+    document_ref VARCHAR(255) NOT NULL,         -- File name of the uploaded scan in user-service's upload directory
+    status ENUM('pending', 'approved', 'rejected') NOT NULL DEFAULT 'pending',
+    rejection_reason VARCHAR(255) NULL,
+    submitted_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    reviewed_at DATETIME NULL,
+    reviewed_by INT NULL,                       -- Staff member who approved or rejected it
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    INDEX idx_driver_licences_status (status, submitted_at)
+);
+
+INSERT INTO permissions (name, description)
+VALUES ('licences:review', 'Approve or reject driver licences');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r JOIN permissions p
+WHERE r.name IN ('admin', 'support') AND p.name = 'licences:review';
+
+-- Membership tiers are ordered by tier_rank; moving to a higher rank is an upgrade.
+-- Paid tiers are billed monthly from the day the user first upgraded. Each month's renewal
+-- must be paid within a grace period, otherwise the member drops to the free tier.
+ALTER TABLE membership_tiers
+ADD COLUMN tier_rank INT NOT NULL DEFAULT 0,
+ADD COLUMN monthly_fee DECIMAL(10, 2) NOT NULL DEFAULT 0.00;
+
+UPDATE membership_tiers SET tier_rank = 0, monthly_fee = 0.00 WHERE name = 'Basic';
+UPDATE membership_tiers SET tier_rank = 1, monthly_fee = 9.90 WHERE name = 'Premium';
+UPDATE membership_tiers SET tier_rank = 2, monthly_fee = 19.90 WHERE name = 'VIP';
+
+ALTER TABLE users
+ADD COLUMN membership_billing_anchor DATETIME NULL,  -- Start of the first paid period; NULL while on a free tier
+ADD COLUMN membership_paid_until DATETIME NULL;      -- End of the last paid period; NULL while on a free tier
+
+-- Existing paid members start their first billing period now
+UPDATE users u
+JOIN membership_tiers mt ON mt.id = u.membership_tier_id
+SET u.membership_billing_anchor = NOW(), u.membership_paid_until = NOW() + INTERVAL 1 MONTH
+WHERE mt.monthly_fee > 0;
+
+-- Every requested tier change. Upgrades and monthly renewals wait for payment through
+-- billing-service; downgrades are scheduled for the end of the current billing period.
+CREATE TABLE IF NOT EXISTS membership_changes (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    from_tier_id INT NOT NULL,
+    to_tier_id INT NOT NULL,
+    change_type ENUM('upgrade', 'downgrade', 'renewal') NOT NULL,
+    status ENUM('pending_payment', 'scheduled', 'applied', 'canceled') NOT NULL,
+    amount DECIMAL(10, 2) NOT NULL DEFAULT 0.00,  -- Charged for an upgrade or renewal
+    effective_at DATETIME NULL,                   -- When a scheduled downgrade takes effect or a renewal fell due
+    period_end DATETIME NULL,                     -- End of the period a renewal pays for
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    applied_at DATETIME NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (from_tier_id) REFERENCES membership_tiers(id),
+    FOREIGN KEY (to_tier_id) REFERENCES membership_tiers(id),
+    INDEX idx_membership_changes_user (user_id, created_at),
+    INDEX idx_membership_changes_due (status, effective_at)
+);
+
+-- Membership payments are not tied to a booking; they point at the change they paid for
+ALTER TABLE payments
+MODIFY booking_id INT NULL,
+ADD COLUMN membership_change_id INT NULL,
+ADD FOREIGN KEY (membership_change_id) REFERENCES membership_changes(id);
+
+-- Priority access: members of priority tiers get the first day after a vehicle is released
+-- and can book high-demand vehicles further ahead than other members
+ALTER TABLE vehicles
+ADD COLUMN released_at DATETIME NULL,                 -- When the vehicle was added or returned to service
+ADD COLUMN high_demand BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE vehicles SET released_at = created_at;
+
+-- Loyalty points. Members earn points for every dollar paid on a completed rental,
+-- multiplied by their tier, and can redeem them as a discount when paying.
+ALTER TABLE membership_tiers
+ADD COLUMN points_multiplier DECIMAL(4, 2) NOT NULL DEFAULT 1.00;
+
+UPDATE membership_tiers SET points_multiplier = 1.50 WHERE name = 'Premium';
+UPDATE membership_tiers SET points_multiplier = 2.00 WHERE name = 'VIP';
+
+-- Append-only: the balance is the sum of a user's entries; corrections are new entries
+CREATE TABLE IF NOT EXISTS loyalty_points_ledger (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    points INT NOT NULL,                        -- Positive when earned or given back, negative when redeemed or reversed
+    entry_type ENUM('earn', 'redeem', 'reversal', 'refund') NOT NULL,  -- A reversal takes back points earned by a refunded payment
+    booking_id INT NULL,
+    payment_id INT NULL,
+    refund_id INT NULL,                         -- Set instead of payment_id on redeemed points a refund gives back
+    description VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (booking_id) REFERENCES bookings(id),
+    FOREIGN KEY (payment_id) REFERENCES payments(id),
+    FOREIGN KEY (refund_id) REFERENCES refunds(id),
+    UNIQUE KEY uq_loyalty_points_payment (payment_id, entry_type),  -- A payment earns, redeems or is reversed at most once
+    UNIQUE KEY uq_loyalty_points_refund (refund_id),
+    INDEX idx_loyalty_points_user (user_id, created_at)
+);
+
+CREATE TRIGGER loyalty_points_ledger_no_update BEFORE UPDATE ON loyalty_points_ledger
+FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'loyalty_points_ledger is append-only';
+
+CREATE TRIGGER loyalty_points_ledger_no_delete BEFORE DELETE ON loyalty_points_ledger
+FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'loyalty_points_ledger is append-only';
+
+-- Points redeemed on a payment show up as a discount line on its invoice
+ALTER TABLE payments
+ADD COLUMN points_redeemed INT NOT NULL DEFAULT 0,
+ADD COLUMN points_discount DECIMAL(10, 2) NOT NULL DEFAULT 0.00;
+
+ALTER TABLE invoices
+ADD COLUMN points_discount DECIMAL(10, 2) NOT NULL DEFAULT 0.00;
+
+-- Referrals. Every user gets a code to share; once a referred user completes their first
+-- paid rental both sides are credited with loyalty points.
+ALTER TABLE users
+ADD COLUMN referral_code CHAR(8) NULL UNIQUE;
+
+CREATE TABLE IF NOT EXISTS referrals (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    referrer_id INT NOT NULL,
+    referred_id INT NOT NULL UNIQUE,            -- A user can only be referred once
+    status ENUM('pending', 'rewarded', 'rejected') NOT NULL DEFAULT 'pending',
+    rejection_reason VARCHAR(255) NULL,         -- Why the anti-abuse checks refused the credit
+    qualifying_payment_id INT NULL,             -- Payment for the referred user's first completed rental
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    resolved_at DATETIME NULL,
+    FOREIGN KEY (referrer_id) REFERENCES users(id),
+    FOREIGN KEY (referred_id) REFERENCES users(id),
+    FOREIGN KEY (qualifying_payment_id) REFERENCES payments(id),
+    INDEX idx_referrals_referrer (referrer_id),
+    INDEX idx_referrals_status (status)
+);
+
+-- Referral credit is paid out as loyalty points, one entry per party
+ALTER TABLE loyalty_points_ledger
+MODIFY entry_type ENUM('earn', 'redeem', 'reversal', 'refund', 'referral') NOT NULL,
+ADD COLUMN referral_id INT NULL,
+ADD FOREIGN KEY (referral_id) REFERENCES referrals(id),
+ADD UNIQUE KEY uq_loyalty_points_referral (referral_id, user_id);
+
+-- Account suspension by support staff. Suspended users cannot log in or book.
+ALTER TABLE users
+ADD COLUMN suspended_at DATETIME NULL,
+ADD COLUMN suspension_reason VARCHAR(255) NULL,
+ADD INDEX idx_users_created_at (created_at),
+ADD INDEX idx_users_name (name);
+
+-- Personal API keys for scripts. Only the SHA-256 hash of a key is stored; the prefix
+-- column keeps the first characters so users can tell their keys apart.
+CREATE TABLE IF NOT EXISTS api_keys (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    key_prefix VARCHAR(16) NOT NULL,
+    key_hash CHAR(64) NOT NULL UNIQUE,
+    scopes SET('bookings:read', 'bookings:write', 'invoices:read') NOT NULL,
+    expires_at DATETIME NULL,
+    last_used_at DATETIME NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    revoked_at DATETIME NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    INDEX idx_api_keys_user (user_id)
+);
+
+-- Notification channels a user has chosen. Users without a row are notified by email only.
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    user_id INT PRIMARY KEY,
+    email_enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    sms_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    push_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    push_webhook_url VARCHAR(500) NULL,          -- Push notifications are posted here as JSON
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+-- Outbox of rendered notifications. Services queue messages here and a dispatcher
+-- delivers them, retrying failures with backoff until the attempts run out.
+CREATE TABLE IF NOT EXISTS notification_outbox (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NULL,                            -- NULL for messages to an address not on an account yet
+    channel ENUM('email', 'sms', 'push') NOT NULL,
+    recipient VARCHAR(500) NOT NULL,             -- Email address, phone number or webhook URL
+    template VARCHAR(50) NOT NULL,
+    subject VARCHAR(255) NULL,
+    body TEXT NOT NULL,
+    dedupe_key VARCHAR(100) NULL,                -- Stops the same notification being queued twice
+    status ENUM('pending', 'sent', 'failed') NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_error VARCHAR(255) NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    sent_at DATETIME NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    UNIQUE KEY uq_notification_outbox_dedupe (dedupe_key, channel),
+    INDEX idx_notification_outbox_due (status, next_attempt_at)
+);
+
+-- When the renter handed the vehicle back, so overdue returns can be chased
+ALTER TABLE bookings
+ADD COLUMN returned_at DATETIME NULL;
+
+-- Fleet management. Retired vehicles take no new bookings but keep their rental history.
+ALTER TABLE vehicles
+ADD COLUMN retired_at DATETIME NULL,
+ADD COLUMN retirement_reason VARCHAR(255) NULL;
+
+-- Cleaning a retired vehicle must not put it back into service
+DROP TRIGGER IF EXISTS update_vehicle_availability_before_update;
+
+DELIMITER //
+
+CREATE TRIGGER update_vehicle_availability_before_update
+BEFORE UPDATE ON vehicle_status
+FOR EACH ROW
+BEGIN
+    IF NEW.cleanliness = 'needs maintenance' THEN
+        UPDATE vehicles SET is_available = FALSE WHERE id = NEW.vehicle_id;
+    ELSE
+        UPDATE vehicles SET is_available = TRUE WHERE id = NEW.vehicle_id AND retired_at IS NULL;
+    END IF;
+END//
+
+DELIMITER ;
+
+-- Personal API keys for vehicle devices reporting telemetry
+ALTER TABLE api_keys
+MODIFY scopes SET('bookings:read', 'bookings:write', 'invoices:read', 'telemetry:write') NOT NULL;
+
+-- Latest telemetry reported by each vehicle. location stays the human readable place name.
+ALTER TABLE vehicle_status
+ADD COLUMN latitude DECIMAL(9, 6) NULL,
+ADD COLUMN longitude DECIMAL(9, 6) NULL,
+ADD COLUMN odometer_km DECIMAL(10, 1) NULL,
+ADD COLUMN reported_at DATETIME NULL;              -- Device time of the reading shown, newer readings replace it
+
+-- Every telemetry reading received, for history queries
+CREATE TABLE IF NOT EXISTS vehicle_telemetry (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    vehicle_id INT NOT NULL,
+    latitude DECIMAL(9, 6) NOT NULL,
+    longitude DECIMAL(9, 6) NOT NULL,
+    charge_level INT NOT NULL CHECK (charge_level BETWEEN 0 AND 100),
+    odometer_km DECIMAL(10, 1) NOT NULL,
+    cleanliness ENUM('clean', 'dirty', 'needs maintenance') NULL,
+    recorded_at DATETIME NOT NULL,                 -- Device time of the reading
+    received_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (vehicle_id) REFERENCES vehicles(id),
+    INDEX idx_vehicle_telemetry_vehicle_time (vehicle_id, recorded_at)
+);
+
+-- Telemetry updates vehicle_status every few seconds, so only a change of cleanliness may
+-- take a vehicle out of or back into service; otherwise every reading would undo staff
+-- taking a vehicle offline
+DROP TRIGGER IF EXISTS update_vehicle_availability_before_update;
+
+DELIMITER //
+
+CREATE TRIGGER update_vehicle_availability_before_update
+BEFORE UPDATE ON vehicle_status
+FOR EACH ROW
+BEGIN
+    IF NOT (NEW.cleanliness <=> OLD.cleanliness) THEN
+        IF NEW.cleanliness = 'needs maintenance' THEN
+            UPDATE vehicles SET is_available = FALSE WHERE id = NEW.vehicle_id;
+        ELSE
+            UPDATE vehicles SET is_available = TRUE WHERE id = NEW.vehicle_id AND retired_at IS NULL;
+        END IF;
+    END IF;
+END//
+
+DELIMITER ;
+
+-- Named places where vehicles are parked and picked up
+CREATE TABLE IF NOT EXISTS stations (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(100) NOT NULL UNIQUE,
+    address VARCHAR(255) NULL,
+    latitude DECIMAL(9, 6) NOT NULL,
+    longitude DECIMAL(9, 6) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_stations_position (latitude, longitude)
+);
+
+INSERT INTO stations (name, address, latitude, longitude)
+VALUES
+('Garage A', '10 Bayfront Avenue', 1.283400, 103.860700),
+('Garage B', '2 Orchard Turn', 1.304800, 103.831800),
+('Garage C', '1 Sin Ming Road', 1.352100, 103.819800),
+('Garage D', '1 Jurong West Central 2', 1.340000, 103.706000),
+('Garage E', '3 Tampines Central 5', 1.352600, 103.944800);
+
+-- The station a vehicle is parked at. Vehicles without telemetry are located by their station.
+ALTER TABLE vehicle_status
+ADD COLUMN station_id INT NULL,
+ADD FOREIGN KEY (station_id) REFERENCES stations(id),
+ADD INDEX idx_vehicle_status_position (latitude, longitude);
+
+UPDATE vehicle_status vs
+JOIN stations s ON s.name = vs.location
+SET vs.station_id = s.id;
+
+-- How many vehicles a station can hold and when it is open. Stations without opening hours
+-- are open around the clock; closes_at before opens_at means open overnight.
+ALTER TABLE stations
+ADD COLUMN capacity INT NOT NULL DEFAULT 10 CHECK (capacity > 0),
+ADD COLUMN opens_at TIME NULL,
+ADD COLUMN closes_at TIME NULL;
+
+UPDATE stations SET capacity = 20 WHERE name IN ('Garage A', 'Garage B');
+UPDATE stations SET opens_at = '06:00', closes_at = '23:00' WHERE name IN ('Garage D', 'Garage E');
+
+-- The station a vehicle belongs to, where it is parked when not out on a trip
+ALTER TABLE vehicles
+ADD COLUMN home_station_id INT NULL,
+ADD FOREIGN KEY (home_station_id) REFERENCES stations(id);
+
+UPDATE vehicles v
+JOIN vehicle_status vs ON vs.vehicle_id = v.id
+SET v.home_station_id = vs.station_id;
+
+-- Where a booking picks the vehicle up and hands it back. A different drop-off station
+-- makes it a one-way trip.
+ALTER TABLE bookings
+ADD COLUMN pickup_station_id INT NULL,
+ADD COLUMN dropoff_station_id INT NULL,
+ADD FOREIGN KEY (pickup_station_id) REFERENCES stations(id),
+ADD FOREIGN KEY (dropoff_station_id) REFERENCES stations(id);
@@ -1,7 +1,11 @@
 package database
 
 import (
+	"cnad_assignment/billing-service/models"
+	"database/sql"
+	"errors"
 	"log"
+	"math"
 	"time"
 )
 
@@ -16,9 +20,14 @@ func FetchBookingsByUser(userID int) ([]map[string]interface{}, error) {
             b.status, 
             v.make, 
             v.model, 
-            v.registration_number 
+            v.registration_number,
+            COALESCE(ps.name, ''),
+            COALESCE(ds.name, ''),
+            b.dropoff_station_id IS NOT NULL AND NOT (b.dropoff_station_id <=> b.pickup_station_id)
         FROM bookings b 
         JOIN vehicles v ON b.vehicle_id = v.id 
+        LEFT JOIN stations ps ON ps.id = b.pickup_station_id
+        LEFT JOIN stations ds ON ds.id = b.dropoff_station_id
         WHERE b.user_id = ? AND b.status IN ('confirmed', 'modified', 'completed');` // Make sure 'completed' is considered too
 
 	rows, err := DB.Query(query, userID)
@@ -32,9 +41,12 @@ func FetchBookingsByUser(userID int) ([]map[string]interface{}, error) {
 	for rows.Next() {
 		var bookingID, userID int
 		var startTimeStr, endTimeStr, status, make, model, registrationNumber string
+		var pickupStation, dropoffStation string
+		var oneWay bool
 
 		// Scan the result into variables
-		err := rows.Scan(&bookingID, &userID, &startTimeStr, &endTimeStr, &status, &make, &model, &registrationNumber)
+		err := rows.Scan(&bookingID, &userID, &startTimeStr, &endTimeStr, &status, &make, &model, &registrationNumber,
+			&pickupStation, &dropoffStation, &oneWay)
 		if err != nil {
 			log.Printf("Error scanning row: %v", err)
 			return nil, err
@@ -63,6 +75,9 @@ func FetchBookingsByUser(userID int) ([]map[string]interface{}, error) {
 			"make":                make,
 			"model":               model,
 			"registration_number": registrationNumber,
+			"pickup_station":      pickupStation,
+			"dropoff_station":     dropoffStation,
+			"one_way":             oneWay, // Handed back at another station than where it was picked up
 		})
 	}
 
@@ -73,3 +88,203 @@ func FetchBookingsByUser(userID int) ([]map[string]interface{}, error) {
 
 	return bookings, nil
 }
+
+// BookingBelongsToUser reports whether the booking exists and was made by the user
+func BookingBelongsToUser(bookingID, userID int) (bool, error) {
+	var ownerID int
+	err := DB.QueryRow("SELECT user_id FROM bookings WHERE id = ?", bookingID).Scan(&ownerID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return ownerID == userID, nil
+}
+
+// FetchBookingPeriod returns the start and end time of a booking and whether it is one-way,
+// handing the vehicle back at a different station from where it was picked up
+func FetchBookingPeriod(bookingID int) (time.Time, time.Time, bool, error) {
+	var startTime, endTime time.Time
+	var oneWay bool
+	query := `
+        SELECT start_time, end_time, dropoff_station_id IS NOT NULL AND NOT (dropoff_station_id <=> pickup_station_id)
+        FROM bookings
+        WHERE id = ?
+    `
+	err := DB.QueryRow(query, bookingID).Scan(&startTime, &endTime, &oneWay)
+	return startTime, endTime, oneWay, err
+}
+
+// FetchMembershipTier returns the name of the user's membership tier and the hourly rate
+// discount it carries, as a percentage (e.g. 10 for 10%).
+func FetchMembershipTier(userID int) (string, float64, error) {
+	var tier string
+	var discount float64
+	query := `
+        SELECT mt.name, mt.hourly_rate_discount
+        FROM users u
+        JOIN membership_tiers mt ON mt.id = u.membership_tier_id
+        WHERE u.id = ?
+    `
+	err := DB.QueryRow(query, userID).Scan(&tier, &discount)
+	return tier, discount, err
+}
+
+// ErrPaymentNotFound is returned when a payment ID does not exist
+var ErrPaymentNotFound = errors.New("payment not found")
+
+// ErrRefundExceedsPayment is returned when a refund would take the total refunded above the amount paid
+var ErrRefundExceedsPayment = errors.New("refund exceeds the amount paid")
+
+// RefundPayment records a completed refund against a payment and marks the payment's invoice as
+// refunded, or partially refunded while some of the payment is left. Loyalty points redeemed on
+// the payment are given back in proportion to the share refunded. An amount of zero refunds
+// whatever has not been refunded yet. It returns the amount refunded.
+func RefundPayment(paymentID int, amount float64, reason string) (float64, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	var paid float64
+	var userID, bookingID, pointsRedeemed int
+	lockQuery := "SELECT amount, user_id, COALESCE(booking_id, 0), points_redeemed FROM payments WHERE id = ? FOR UPDATE"
+	err = tx.QueryRow(lockQuery, paymentID).Scan(&paid, &userID, &bookingID, &pointsRedeemed)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		return 0, ErrPaymentNotFound
+	}
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	var refunded float64
+	query := "SELECT COALESCE(SUM(amount), 0) FROM refunds WHERE payment_id = ? AND refund_status = 'completed'"
+	if err := tx.QueryRow(query, paymentID).Scan(&refunded); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	remaining := paid - refunded
+	if amount == 0 {
+		amount = remaining
+	}
+	if amount <= 0 || amount > remaining {
+		tx.Rollback()
+		return 0, ErrRefundExceedsPayment
+	}
+
+	insertQuery := "INSERT INTO refunds (payment_id, amount, refund_status, reason) VALUES (?, ?, 'completed', ?)"
+	result, err := tx.Exec(insertQuery, paymentID, amount, reason)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	refundID, err := result.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	fullyRefunded := math.Round((remaining-amount)*100) <= 0
+
+	// Give back the points redeemed on the payment in proportion to how much of it is now refunded
+	if pointsRedeemed > 0 {
+		owed := pointsRedeemed
+		if !fullyRefunded {
+			owed = int(math.Floor(float64(pointsRedeemed) * (refunded + amount) / paid))
+		}
+
+		var returned int
+		returnedQuery := `
+            SELECT COALESCE(SUM(l.points), 0)
+            FROM loyalty_points_ledger l
+            JOIN refunds r ON r.id = l.refund_id
+            WHERE r.payment_id = ? AND l.entry_type = 'refund'
+        `
+		if err := tx.QueryRow(returnedQuery, paymentID).Scan(&returned); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+
+		if owed > returned {
+			ledgerQuery := `
+                INSERT INTO loyalty_points_ledger (user_id, points, entry_type, booking_id, refund_id, description)
+                VALUES (?, ?, 'refund', NULLIF(?, 0), ?, CONCAT('Points returned by refund of payment #', ?))
+            `
+			if _, err := tx.Exec(ledgerQuery, userID, owed-returned, bookingID, refundID, paymentID); err != nil {
+				tx.Rollback()
+				return 0, err
+			}
+		}
+	}
+
+	// The invoice only counts as refunded once nothing is left of the payment
+	invoiceStatus := "partially_refunded"
+	if fullyRefunded {
+		invoiceStatus = "refunded"
+	}
+	if _, err := tx.Exec("UPDATE invoices SET payment_status = ? WHERE payment_id = ?", invoiceStatus, paymentID); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	return amount, tx.Commit()
+}
+
+// FetchPaymentsByUser returns every payment made by the user, newest first
+func FetchPaymentsByUser(userID int) ([]models.Payment, error) {
+	query := `
+        SELECT id, user_id, amount, payment_method, payment_status, payment_date, COALESCE(booking_id, 0),
+               COALESCE(membership_change_id, 0), points_redeemed, points_discount
+        FROM payments
+        WHERE user_id = ?
+        ORDER BY payment_date DESC
+    `
+	rows, err := DB.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	payments := []models.Payment{}
+	for rows.Next() {
+		var payment models.Payment
+		var method sql.NullString
+		if err := rows.Scan(&payment.ID, &payment.UserID, &payment.Amount, &method, &payment.PaymentStatus, &payment.PaymentDate, &payment.BookingID,
+			&payment.MembershipChangeID, &payment.PointsRedeemed, &payment.PointsDiscount); err != nil {
+			return nil, err
+		}
+		payment.PaymentMethod = method.String
+		payments = append(payments, payment)
+	}
+	return payments, rows.Err()
+}
+
+// FetchInvoicesByUser returns every invoice issued to the user, newest first
+func FetchInvoicesByUser(userID int) ([]models.Invoice, error) {
+	query := `
+        SELECT id, user_id, booking_id, amount, payment_status, points_discount, invoice_date
+        FROM invoices
+        WHERE user_id = ?
+        ORDER BY invoice_date DESC
+    `
+	rows, err := DB.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invoices := []models.Invoice{}
+	for rows.Next() {
+		var invoice models.Invoice
+		var status sql.NullString
+		if err := rows.Scan(&invoice.ID, &invoice.UserID, &invoice.BookingID, &invoice.Amount, &status, &invoice.PointsDiscount, &invoice.InvoiceDate); err != nil {
+			return nil, err
+		}
+		invoice.PaymentStatus = status.String
+		invoices = append(invoices, invoice)
+	}
+	return invoices, rows.Err()
+}
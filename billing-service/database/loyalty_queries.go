@@ -0,0 +1,111 @@
+package database
+
+import (
+	"cnad_assignment/billing-service/models"
+	"errors"
+	"math"
+	"time"
+)
+
+// ErrInsufficientPoints is returned when a user tries to redeem more loyalty points than they have
+var ErrInsufficientPoints = errors.New("not enough loyalty points")
+
+// ErrBookingAlreadyPaid is returned when the booking already has a completed payment
+var ErrBookingAlreadyPaid = errors.New("booking already paid")
+
+// ErrBookingNotPayable is returned when the booking was canceled or is otherwise not chargeable
+var ErrBookingNotPayable = errors.New("booking cannot be paid")
+
+// RecordBookingPayment stores a completed payment for a booking that is confirmed, modified
+// or completed and has not been paid yet. When redeemPoints is set, up to that many loyalty
+// points are taken off the amount at pointValue dollars each and the redemption is written
+// to the points ledger in the same transaction. Only the points needed to cover the amount
+// are used.
+func RecordBookingPayment(userID, bookingID int, amount float64, paymentMethod string, redeemPoints int, pointValue float64) (models.Payment, error) {
+	payment := models.Payment{
+		UserID:        userID,
+		BookingID:     bookingID,
+		PaymentMethod: paymentMethod,
+		PaymentStatus: "completed",
+		PaymentDate:   time.Now(),
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return payment, err
+	}
+
+	// Lock the booking so it cannot be paid twice, and only charge bookings that still stand
+	var status string
+	if err := tx.QueryRow("SELECT status FROM bookings WHERE id = ? FOR UPDATE", bookingID).Scan(&status); err != nil {
+		tx.Rollback()
+		return payment, err
+	}
+	if status != "confirmed" && status != "modified" && status != "completed" {
+		tx.Rollback()
+		return payment, ErrBookingNotPayable
+	}
+	var paid bool
+	paidQuery := "SELECT EXISTS (SELECT 1 FROM payments WHERE booking_id = ? AND payment_status = 'completed')"
+	if err := tx.QueryRow(paidQuery, bookingID).Scan(&paid); err != nil {
+		tx.Rollback()
+		return payment, err
+	}
+	if paid {
+		tx.Rollback()
+		return payment, ErrBookingAlreadyPaid
+	}
+
+	if redeemPoints > 0 {
+		// Lock the user so two payments cannot spend the same points
+		var lockedID int
+		if err := tx.QueryRow("SELECT id FROM users WHERE id = ? FOR UPDATE", userID).Scan(&lockedID); err != nil {
+			tx.Rollback()
+			return payment, err
+		}
+
+		var balance int
+		if err := tx.QueryRow("SELECT COALESCE(SUM(points), 0) FROM loyalty_points_ledger WHERE user_id = ?", userID).Scan(&balance); err != nil {
+			tx.Rollback()
+			return payment, err
+		}
+		if redeemPoints > balance {
+			tx.Rollback()
+			return payment, ErrInsufficientPoints
+		}
+
+		payment.PointsDiscount = math.Min(math.Round(float64(redeemPoints)*pointValue*100)/100, amount)
+		payment.PointsRedeemed = int(math.Ceil(math.Round(payment.PointsDiscount/pointValue*100) / 100))
+	}
+	payment.Amount = math.Round((amount-payment.PointsDiscount)*100) / 100
+
+	insertQuery := `
+        INSERT INTO payments (user_id, amount, payment_status, payment_method, payment_date, booking_id, points_redeemed, points_discount)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+    `
+	result, err := tx.Exec(insertQuery, userID, payment.Amount, payment.PaymentStatus, payment.PaymentMethod, payment.PaymentDate,
+		bookingID, payment.PointsRedeemed, payment.PointsDiscount)
+	if err != nil {
+		tx.Rollback()
+		return payment, err
+	}
+	paymentID, err := result.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return payment, err
+	}
+	payment.ID = int(paymentID)
+
+	if payment.PointsRedeemed > 0 {
+		ledgerQuery := `
+            INSERT INTO loyalty_points_ledger (user_id, points, entry_type, booking_id, payment_id, description)
+            VALUES (?, ?, 'redeem', ?, ?, CONCAT('Redeemed on booking #', ?))
+        `
+		if _, err := tx.Exec(ledgerQuery, userID, -payment.PointsRedeemed, bookingID, payment.ID, bookingID); err != nil {
+			tx.Rollback()
+			return payment, err
+		}
+	}
+
+	return payment, tx.Commit()
+}
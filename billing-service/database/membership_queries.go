@@ -0,0 +1,111 @@
+package database
+
+import (
+	"cnad_assignment/billing-service/models"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrMembershipChangeNotFound is returned when the user has no unpaid upgrade or renewal with the ID
+var ErrMembershipChangeNotFound = errors.New("membership change not found")
+
+// ErrMembershipChangeStale is returned when the user's tier changed after the change was requested
+var ErrMembershipChangeStale = errors.New("membership changed since the change was requested")
+
+// PayMembershipChange records the payment for a pending upgrade or monthly renewal. An upgrade
+// moves the user to the new tier; one from a free tier starts a monthly billing period now.
+// A renewal extends the paid membership to the end of the period it was issued for.
+func PayMembershipChange(changeID, userID int, paymentMethod string) (models.Payment, error) {
+	payment := models.Payment{
+		UserID:             userID,
+		PaymentMethod:      paymentMethod,
+		PaymentStatus:      "completed",
+		PaymentDate:        time.Now(),
+		MembershipChangeID: changeID,
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return payment, err
+	}
+
+	var changeType string
+	var fromTierID, toTierID, currentTierID int
+	var periodEnd, anchor, paidUntil sql.NullTime
+	query := `
+        SELECT mc.change_type, mc.from_tier_id, mc.to_tier_id, mc.amount, mc.period_end,
+               u.membership_tier_id, u.membership_billing_anchor, u.membership_paid_until
+        FROM membership_changes mc
+        JOIN users u ON u.id = mc.user_id
+        WHERE mc.id = ? AND mc.user_id = ? AND mc.status = 'pending_payment'
+        FOR UPDATE
+    `
+	err = tx.QueryRow(query, changeID, userID).Scan(&changeType, &fromTierID, &toTierID, &payment.Amount, &periodEnd,
+		&currentTierID, &anchor, &paidUntil)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		return payment, ErrMembershipChangeNotFound
+	}
+	if err != nil {
+		tx.Rollback()
+		return payment, err
+	}
+
+	// The charge was worked out for the tier the user had at the time
+	if currentTierID != fromTierID || (changeType == "renewal" && !periodEnd.Valid) {
+		if _, err := tx.Exec("UPDATE membership_changes SET status = 'canceled' WHERE id = ?", changeID); err != nil {
+			tx.Rollback()
+			return payment, err
+		}
+		if err := tx.Commit(); err != nil {
+			return payment, err
+		}
+		return payment, ErrMembershipChangeStale
+	}
+
+	insertQuery := `
+        INSERT INTO payments (user_id, amount, payment_status, payment_method, payment_date, membership_change_id)
+        VALUES (?, ?, ?, ?, ?, ?)
+    `
+	result, err := tx.Exec(insertQuery, userID, payment.Amount, payment.PaymentStatus, payment.PaymentMethod, payment.PaymentDate, changeID)
+	if err != nil {
+		tx.Rollback()
+		return payment, err
+	}
+	paymentID, err := result.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return payment, err
+	}
+	payment.ID = int(paymentID)
+
+	// A renewal extends the paid period and an upgrade from a free tier starts one. Upgrades
+	// between paid tiers were charged for the rest of the period already paid for.
+	if changeType == "renewal" {
+		paidUntil = periodEnd
+	} else if !anchor.Valid {
+		anchor = sql.NullTime{Time: payment.PaymentDate, Valid: true}
+		paidUntil = sql.NullTime{Time: payment.PaymentDate.AddDate(0, 1, 0), Valid: true}
+	}
+
+	statements := []struct {
+		query string
+		args  []interface{}
+	}{
+		{"UPDATE users SET membership_tier_id = ?, membership_billing_anchor = ?, membership_paid_until = ? WHERE id = ?",
+			[]interface{}{toTierID, anchor, paidUntil, userID}},
+		{"UPDATE membership_changes SET status = 'applied', applied_at = ? WHERE id = ?", []interface{}{payment.PaymentDate, changeID}},
+		// A renewal still open for the old tier would otherwise lapse the new one
+		{"UPDATE membership_changes SET status = 'canceled' WHERE user_id = ? AND change_type = 'renewal' AND status = 'pending_payment'",
+			[]interface{}{userID}},
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt.query, stmt.args...); err != nil {
+			tx.Rollback()
+			return payment, err
+		}
+	}
+
+	return payment, tx.Commit()
+}
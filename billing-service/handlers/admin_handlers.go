@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"cnad_assignment/billing-service/database"
+	"cnad_assignment/shared/auth"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// AdminRefundPayment refunds all or part of a payment and updates the refund status of its invoice
+func AdminRefundPayment(w http.ResponseWriter, r *http.Request) {
+	paymentID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || paymentID <= 0 {
+		http.Error(w, "Invalid payment ID", http.StatusBadRequest)
+		return
+	}
+
+	// Amount is optional; leaving it out refunds the rest of the payment
+	var request struct {
+		Amount float64 `json:"amount"`
+		Reason string  `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Amount < 0 {
+		http.Error(w, "Invalid refund details", http.StatusBadRequest)
+		return
+	}
+
+	refunded, err := database.RefundPayment(paymentID, request.Amount, request.Reason)
+	if err == database.ErrPaymentNotFound {
+		http.Error(w, "Payment not found", http.StatusNotFound)
+		return
+	}
+	if err == database.ErrRefundExceedsPayment {
+		http.Error(w, "Refund exceeds the amount left on the payment", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Error refunding payment %d: %v", paymentID, err)
+		http.Error(w, "Failed to refund payment", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %d refunded %.2f of payment %d", auth.UserID(r), refunded, paymentID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"payment_id": paymentID,
+		"refunded":   refunded,
+		"message":    "Refund issued",
+	})
+}
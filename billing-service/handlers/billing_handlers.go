@@ -3,34 +3,27 @@ package handlers
 import (
 	"cnad_assignment/billing-service/database" // Import the database package
 	"cnad_assignment/billing-service/utils"
+	"cnad_assignment/shared/auth"
+	"cnad_assignment/shared/notify"
 	"encoding/json"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"strconv"
 	"time"
 )
 
-// Calculate the cost including discount based on user role
+// Calculate the cost including discount based on the user's membership tier
 func calculateBillingWithDiscount(userID int, startTime, endTime time.Time) (float64, float64, float64, error) {
-	// Fetch user's role from the database
-	var userRole string
-	query := "SELECT role FROM users WHERE id = ?"
-	err := database.DB.QueryRow(query, userID).Scan(&userRole) // Access DB from the database package
+	// Fetch user's membership tier from the database
+	_, discountPercent, err := database.FetchMembershipTier(userID) // Access DB from the database package
 	if err != nil {
-		return 0, 0, 0, fmt.Errorf("failed to fetch user role: %v", err)
+		return 0, 0, 0, fmt.Errorf("failed to fetch membership tier: %v", err)
 	}
 
-	// Set discount based on membership tier
-	var discount float64
-	switch userRole {
-	case "VIP":
-		discount = 0.20 // 20% discount for VIP
-	case "Premium":
-		discount = 0.10 // 10% discount for Premium
-	default:
-		discount = 0.00 // No discount for Basic
-	}
+	// The tier's discount is stored as a percentage
+	discount := discountPercent / 100
 
 	// Calculate rental duration in hours
 	rentalDuration := endTime.Sub(startTime).Hours()
@@ -48,18 +41,50 @@ func calculateBillingWithDiscount(userID int, startTime, endTime time.Time) (flo
 	return costBeforeDiscount, discountAmount, finalCost, nil
 }
 
-// FetchBillingDetails fetches the billing details for a user including booking and vehicle details
-func FetchBillingDetails(w http.ResponseWriter, r *http.Request) {
-	userIDStr := r.URL.Query().Get("user_id")
-	if userIDStr == "" {
-		http.Error(w, "User ID is required", http.StatusBadRequest)
-		return
+// calculateBookingCharges prices a booking: the rental with the membership discount applied,
+// plus the one-way fee, which the discount does not cover
+func calculateBookingCharges(userID int, startTime, endTime time.Time, oneWay bool) (float64, float64, float64, float64, error) {
+	costBeforeDiscount, discountAmount, finalCost, err := calculateBillingWithDiscount(userID, startTime, endTime)
+	if err != nil {
+		return 0, 0, 0, 0, err
+	}
+
+	var oneWayFee float64
+	if oneWay {
+		oneWayFee = utils.OneWayFee
+		finalCost += oneWayFee
+	}
+	return costBeforeDiscount, discountAmount, oneWayFee, finalCost, nil
+}
+
+// bookingAmount is what the user owes for a booking, rounded to the cent. Payments are
+// charged this amount rather than one sent by the client.
+func bookingAmount(userID, bookingID int) (float64, error) {
+	startTime, endTime, oneWay, err := database.FetchBookingPeriod(bookingID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch booking: %v", err)
 	}
 
-	userID, err := strconv.Atoi(userIDStr)
+	_, _, _, finalCost, err := calculateBookingCharges(userID, startTime, endTime, oneWay)
 	if err != nil {
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
-		return
+		return 0, err
+	}
+	return math.Round(finalCost*100) / 100, nil
+}
+
+// FetchBillingDetails fetches the billing details for a user including booking and vehicle details
+func FetchBillingDetails(w http.ResponseWriter, r *http.Request) {
+	// Billing details are always for the caller; an explicit user_id must match
+	userID := auth.UserID(r)
+	if userIDStr := r.URL.Query().Get("user_id"); userIDStr != "" {
+		requestedID, err := strconv.Atoi(userIDStr)
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+		if !callerMatches(w, r, requestedID) {
+			return
+		}
 	}
 
 	// Fetch the bookings and vehicle details for the user
@@ -69,29 +94,15 @@ func FetchBillingDetails(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Fetch the user's membership role and calculate discount
-	var userRole string
-	query := "SELECT role FROM users WHERE id = ?"
-	err = database.DB.QueryRow(query, userID).Scan(&userRole)
+	// Fetch the user's membership tier and calculate discount
+	membershipTier, discountPercent, err := database.FetchMembershipTier(userID)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error fetching user role: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Error fetching membership tier: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	// Set discount based on membership tier
-
-	var discountPercentage string
-	switch userRole {
-	case "VIP":
-
-		discountPercentage = "20%"
-	case "Premium":
-
-		discountPercentage = "10%"
-	default:
-
-		discountPercentage = "0%"
-	}
+	// Show the discount the user's tier carries
+	discountPercentage := fmt.Sprintf("%g%%", discountPercent)
 
 	// Calculate total cost and gather billing details
 	var totalCost float64
@@ -103,7 +114,8 @@ func FetchBillingDetails(w http.ResponseWriter, r *http.Request) {
 		vehicle := fmt.Sprintf("%s %s (%s)", booking["make"], booking["model"], booking["registration_number"])
 
 		// Calculate the cost for the booking
-		costBeforeDiscount, discountAmount, finalCost, err := calculateBillingWithDiscount(userID, booking["start_time"].(time.Time), booking["end_time"].(time.Time))
+		costBeforeDiscount, discountAmount, oneWayFee, finalCost, err := calculateBookingCharges(userID,
+			booking["start_time"].(time.Time), booking["end_time"].(time.Time), booking["one_way"].(bool))
 		if err != nil {
 			http.Error(w, fmt.Sprintf("Error calculating billing: %v", err), http.StatusInternalServerError)
 			return
@@ -117,6 +129,9 @@ func FetchBillingDetails(w http.ResponseWriter, r *http.Request) {
 			"duration":             booking["end_time"].(time.Time).Sub(booking["start_time"].(time.Time)).Hours(),
 			"cost_before_discount": fmt.Sprintf("$%.2f", costBeforeDiscount),
 			"discount":             fmt.Sprintf("$%.2f (%s)", discountAmount, discountPercentage),
+			"pickup_station":       booking["pickup_station"],
+			"dropoff_station":      booking["dropoff_station"],
+			"one_way_fee":          fmt.Sprintf("$%.2f", oneWayFee),
 			"final_cost":           fmt.Sprintf("$%.2f", finalCost),
 		})
 
@@ -124,12 +139,12 @@ func FetchBillingDetails(w http.ResponseWriter, r *http.Request) {
 		totalCost += finalCost
 	}
 
-	// Respond with the total cost, billing details, and user's role and discount percentage
+	// Respond with the total cost, billing details, and user's membership tier and discount percentage
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"total_cost":      totalCost,
 		"billing_details": billingDetails,
-		"user_role":       userRole,           // Send the user's role
+		"membership_tier": membershipTier,     // Send the user's membership tier
 		"discount":        discountPercentage, // Send the discount percentage
 	})
 }
@@ -148,9 +163,10 @@ type Payment struct {
 // HandlePaymentConfirmation handles payment confirmation, clears the debt, and sends the invoice
 func HandlePaymentConfirmation(w http.ResponseWriter, r *http.Request) {
 	var paymentDetails struct {
-		UserID    int     `json:"user_id"`    // Expecting integer for user_id
-		Amount    float64 `json:"amount"`     // Expecting float64 for amount
-		BookingID int     `json:"booking_id"` // Expecting integer for booking_id
+		UserID        int    `json:"user_id"`    // Expecting integer for user_id
+		BookingID     int    `json:"booking_id"` // Expecting integer for booking_id
+		PaymentMethod string `json:"payment_method"`
+		RedeemPoints  int    `json:"redeem_points"` // Loyalty points to take off the amount
 	}
 
 	// Decode incoming payment details
@@ -160,11 +176,8 @@ func HandlePaymentConfirmation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Log the decoded payment details for debugging
-	log.Printf("Received payment details: %+v\n", paymentDetails)
-
-	if paymentDetails.Amount <= 0 {
-		http.Error(w, "Invalid payment amount", http.StatusBadRequest)
+	if paymentDetails.RedeemPoints < 0 {
+		http.Error(w, "Invalid number of points to redeem", http.StatusBadRequest)
 		return
 	}
 
@@ -174,51 +187,80 @@ func HandlePaymentConfirmation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Now you can process the payment
-	query := "UPDATE payments SET payment_status = 'paid' WHERE user_id = ? AND payment_status = 'pending' AND booking_id = ?"
-	_, err := database.DB.Exec(query, paymentDetails.UserID, paymentDetails.BookingID)
-	if err != nil {
-		http.Error(w, "Error updating payment status", http.StatusInternalServerError)
+	// Payments can only be made by the caller for their own bookings
+	if paymentDetails.UserID != 0 && !callerMatches(w, r, paymentDetails.UserID) {
 		return
 	}
-
-	// Generate the invoice
-	invoiceID := generateInvoice(paymentDetails.UserID, paymentDetails.BookingID, paymentDetails.Amount)
-	if invoiceID == 0 {
-		http.Error(w, "Failed to generate invoice", http.StatusInternalServerError)
+	paymentDetails.UserID = auth.UserID(r)
+	if !authorizeBooking(w, paymentDetails.BookingID, paymentDetails.UserID) {
 		return
 	}
 
-	// Fetch user email from the database
-	var userEmail string
-	err = database.DB.QueryRow("SELECT email FROM users WHERE id = ?", paymentDetails.UserID).Scan(&userEmail)
+	// Charge what the booking costs, not an amount sent by the client
+	amount, err := bookingAmount(paymentDetails.UserID, paymentDetails.BookingID)
 	if err != nil {
-		http.Error(w, "Failed to fetch user email", http.StatusInternalServerError)
+		log.Printf("Error calculating amount of booking %d: %v", paymentDetails.BookingID, err)
+		http.Error(w, "Error calculating payment amount", http.StatusInternalServerError)
 		return
 	}
 
-	// Generate email content
-	invoiceDetails := map[string]interface{}{
-		"invoice_id": invoiceID,
-		"user_id":    paymentDetails.UserID,
-		"amount":     paymentDetails.Amount,
-		"status":     "Paid",
-		"date":       time.Now().Format(time.RFC1123),
+	// Now you can process the payment, taking any redeemed points off the amount
+	payment, err := database.RecordBookingPayment(paymentDetails.UserID, paymentDetails.BookingID, amount,
+		paymentDetails.PaymentMethod, paymentDetails.RedeemPoints, utils.PointValue)
+	if err == database.ErrInsufficientPoints {
+		http.Error(w, "You do not have enough loyalty points", http.StatusBadRequest)
+		return
+	}
+	if err == database.ErrBookingAlreadyPaid {
+		http.Error(w, "This booking has already been paid", http.StatusConflict)
+		return
+	}
+	if err == database.ErrBookingNotPayable {
+		http.Error(w, "This booking was canceled and cannot be paid", http.StatusConflict)
+		return
 	}
-	emailContent := utils.GenerateInvoiceEmail(invoiceDetails)
-
-	// Send the invoice email
-	err = utils.SendEmail(userEmail, "Your Invoice", emailContent)
 	if err != nil {
-		http.Error(w, "Failed to send invoice email", http.StatusInternalServerError)
+		log.Printf("Error recording payment for booking %d: %v", paymentDetails.BookingID, err)
+		http.Error(w, "Error updating payment status", http.StatusInternalServerError)
+		return
+	}
+
+	// Generate the invoice
+	invoiceID := generateInvoice(paymentDetails.UserID, paymentDetails.BookingID, payment.ID, payment.Amount, payment.PointsDiscount)
+	if invoiceID == 0 {
+		http.Error(w, "Failed to generate invoice", http.StatusInternalServerError)
 		return
 	}
 
+	notifyInvoice(paymentDetails.UserID, paymentDetails.BookingID, invoiceID, payment.Amount, payment.PointsRedeemed, payment.PointsDiscount)
+
 	// Respond to the client
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"message": "Payment confirmed and invoice sent via email.",
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Payment confirmed. Your invoice is on its way.",
+		"payment": payment,
+	})
+}
+
+// notifyInvoice queues the invoice on the user's notification channels. A failure is only
+// logged since the payment has already gone through.
+func notifyInvoice(userID, bookingID, invoiceID int, amount float64, pointsRedeemed int, pointsDiscount float64) {
+	_, err := notify.Notify(database.DB, notify.Notification{
+		UserID:   userID,
+		Template: notify.TemplateInvoice,
+		Data: notify.Data{
+			"InvoiceID":      invoiceID,
+			"BookingID":      bookingID,
+			"Amount":         amount,
+			"PointsRedeemed": pointsRedeemed,
+			"PointsDiscount": pointsDiscount,
+			"Date":           time.Now(),
+		},
+		DedupeKey: fmt.Sprintf("invoice-%d", invoiceID),
 	})
+	if err != nil {
+		log.Printf("Error queuing invoice %d for user %d: %v", invoiceID, userID, err)
+	}
 }
 
 // ConfirmPayment confirms the payment and processes the request
@@ -229,14 +271,29 @@ func ConfirmPayment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Log received data for debugging
-	log.Printf("Received payment details: %+v\n", payment)
+	// Payments can only be made by the caller for their own bookings
+	if payment.UserID != 0 && !callerMatches(w, r, payment.UserID) {
+		return
+	}
+	payment.UserID = auth.UserID(r)
 
 	// Validate required fields
-	if payment.UserID == 0 || payment.Amount <= 0 || payment.PaymentMethod == "" || payment.BookingID == 0 {
+	if payment.PaymentMethod == "" || payment.BookingID == 0 {
 		http.Error(w, "Missing required payment information.", http.StatusBadRequest)
 		return
 	}
+	if !authorizeBooking(w, payment.BookingID, payment.UserID) {
+		return
+	}
+
+	// Charge what the booking costs, not an amount sent by the client
+	amount, err := bookingAmount(payment.UserID, payment.BookingID)
+	if err != nil {
+		log.Printf("Error calculating amount of booking %d: %v", payment.BookingID, err)
+		http.Error(w, "Error calculating payment amount", http.StatusInternalServerError)
+		return
+	}
+	payment.Amount = amount
 
 	// Process the payment (e.g., Stripe or PayPal) - here we assume it is successful
 	payment.PaymentStatus = "completed" // Update this based on payment gateway response
@@ -247,47 +304,37 @@ func ConfirmPayment(w http.ResponseWriter, r *http.Request) {
         INSERT INTO payments (user_id, amount, payment_status, payment_method, payment_date, booking_id)
         VALUES (?, ?, ?, ?, ?, ?)
     `
-	_, err := database.DB.Exec(query, payment.UserID, payment.Amount, payment.PaymentStatus, payment.PaymentMethod, payment.PaymentDate, payment.BookingID)
+	result, err := database.DB.Exec(query, payment.UserID, payment.Amount, payment.PaymentStatus, payment.PaymentMethod, payment.PaymentDate, payment.BookingID)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error processing payment: %v", err), http.StatusInternalServerError)
 		return
 	}
+	paymentID, err := result.LastInsertId()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error processing payment: %v", err), http.StatusInternalServerError)
+		return
+	}
+	payment.ID = int(paymentID)
 
 	// Generate the invoice
-	invoiceID := generateInvoice(payment.UserID, payment.BookingID, payment.Amount)
+	invoiceID := generateInvoice(payment.UserID, payment.BookingID, payment.ID, payment.Amount, 0)
 	if invoiceID == 0 {
 		http.Error(w, "Failed to generate invoice", http.StatusInternalServerError)
 		return
 	}
 
-	// Send the invoice via email
-	invoiceDetails := map[string]interface{}{
-		"invoice_id": invoiceID,
-		"user_id":    payment.UserID,
-		"amount":     payment.Amount,
-		"status":     "Paid",
-		"date":       time.Now().Format(time.RFC1123),
-	}
-
-	emailContent := utils.GenerateInvoiceEmail(invoiceDetails)
-
-	// Send the invoice email
-	userEmail := "" // Fetch the user email based on payment.UserID
-	err = utils.SendEmail(userEmail, "Your Invoice", emailContent)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to send invoice email: %v", err), http.StatusInternalServerError)
-		return
-	}
+	notifyInvoice(payment.UserID, payment.BookingID, invoiceID, payment.Amount, 0, 0)
 
 	// Respond to the client
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"message": "Payment processed successfully and invoice sent.",
+		"message": "Payment processed successfully. Your invoice is on its way.",
 	})
 }
 
-// generateInvoice creates a new invoice in the existing table and returns the invoice ID.
-func generateInvoice(userID int, bookingID int, amount float64) int {
+// generateInvoice creates a new invoice for a payment in the existing table and returns the
+// invoice ID. pointsDiscount is the amount already taken off by redeeming loyalty points.
+func generateInvoice(userID int, bookingID int, paymentID int, amount, pointsDiscount float64) int {
 	// Ensure the booking_id exists in the bookings table
 	var validBookingID int
 	err := database.DB.QueryRow("SELECT id FROM bookings WHERE id = ?", bookingID).Scan(&validBookingID)
@@ -298,10 +345,10 @@ func generateInvoice(userID int, bookingID int, amount float64) int {
 
 	// Insert invoice if booking ID is valid
 	query := `
-        INSERT INTO invoices (user_id, booking_id, amount, payment_status, invoice_date)
-        VALUES (?, ?, ?, 'Paid', ?)
+        INSERT INTO invoices (user_id, booking_id, payment_id, amount, payment_status, points_discount, invoice_date)
+        VALUES (?, ?, ?, ?, 'Paid', ?, ?)
     `
-	result, err := database.DB.Exec(query, userID, bookingID, amount, time.Now())
+	result, err := database.DB.Exec(query, userID, bookingID, paymentID, amount, pointsDiscount, time.Now())
 	if err != nil {
 		fmt.Printf("Error generating invoice: %v\n", err)
 		return 0
@@ -310,3 +357,110 @@ func generateInvoice(userID int, bookingID int, amount float64) int {
 	invoiceID, _ := result.LastInsertId()
 	return int(invoiceID)
 }
+
+// callerMatches checks that a user ID supplied by the client is the authenticated caller.
+// On mismatch it writes a 403 response and returns false.
+func callerMatches(w http.ResponseWriter, r *http.Request, userID int) bool {
+	if userID != auth.UserID(r) {
+		log.Printf("User %d attempted to access billing data of user %d", auth.UserID(r), userID)
+		http.Error(w, "You can only access your own billing information", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// authorizeBooking checks that the booking belongs to the user before it is paid or invoiced.
+// On failure it writes the error response and returns false.
+func authorizeBooking(w http.ResponseWriter, bookingID, userID int) bool {
+	owned, err := database.BookingBelongsToUser(bookingID, userID)
+	if err != nil {
+		log.Printf("Error checking owner of booking %d: %v", bookingID, err)
+		http.Error(w, "Failed to verify booking", http.StatusInternalServerError)
+		return false
+	}
+	if !owned {
+		http.Error(w, "Booking not found", http.StatusNotFound)
+		return false
+	}
+	return true
+}
+
+// FetchBillingHistory returns all payments and invoices of the caller
+func FetchBillingHistory(w http.ResponseWriter, r *http.Request) {
+	userID := auth.UserID(r)
+
+	payments, err := database.FetchPaymentsByUser(userID)
+	if err != nil {
+		log.Printf("Error fetching payments for user %d: %v", userID, err)
+		http.Error(w, "Failed to fetch payments", http.StatusInternalServerError)
+		return
+	}
+
+	invoices, err := database.FetchInvoicesByUser(userID)
+	if err != nil {
+		log.Printf("Error fetching invoices for user %d: %v", userID, err)
+		http.Error(w, "Failed to fetch invoices", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"payments": payments,
+		"invoices": invoices,
+	})
+}
+
+// FetchInvoices returns the invoices of the caller
+func FetchInvoices(w http.ResponseWriter, r *http.Request) {
+	userID := auth.UserID(r)
+
+	invoices, err := database.FetchInvoicesByUser(userID)
+	if err != nil {
+		log.Printf("Error fetching invoices for user %d: %v", userID, err)
+		http.Error(w, "Failed to fetch invoices", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(invoices)
+}
+
+// PayMembershipChange pays for an upgrade requested through user-service, activating the new
+// tier, or for the monthly renewal of a paid membership
+func PayMembershipChange(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		ChangeID      int    `json:"change_id"`
+		PaymentMethod string `json:"payment_method"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Error decoding payment details", http.StatusBadRequest)
+		return
+	}
+	if request.ChangeID <= 0 || request.PaymentMethod == "" {
+		http.Error(w, "Missing required payment information.", http.StatusBadRequest)
+		return
+	}
+
+	userID := auth.UserID(r)
+	payment, err := database.PayMembershipChange(request.ChangeID, userID, request.PaymentMethod)
+	if err == database.ErrMembershipChangeNotFound {
+		http.Error(w, "No unpaid membership upgrade or renewal found", http.StatusNotFound)
+		return
+	}
+	if err == database.ErrMembershipChangeStale {
+		http.Error(w, "Your membership changed since this payment was requested. Please request it again.", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error paying membership change %d for user %d: %v", request.ChangeID, userID, err)
+		http.Error(w, "Failed to process payment", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %d paid %.2f for membership change %d", userID, payment.Amount, request.ChangeID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Payment confirmed. Your membership is active; log in again to refresh your session.",
+		"payment": payment,
+	})
+}
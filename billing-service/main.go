@@ -3,6 +3,7 @@ package main
 import (
 	"cnad_assignment/billing-service/database"
 	"cnad_assignment/billing-service/routes"
+	"cnad_assignment/shared/auth"
 	"fmt"
 	"log"
 	"net/http"
@@ -15,6 +16,9 @@ func main() {
 	// Initialize the database
 	database.InitDB()
 
+	// Verify access tokens with the public keys published by user-service
+	auth.SetKeySource(auth.NewJWKSCache(auth.DefaultJWKSURL))
+
 	// Create a new router
 	router := mux.NewRouter()
 
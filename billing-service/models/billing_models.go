@@ -4,22 +4,26 @@ import "time"
 
 // Payment represents a payment transaction
 type Payment struct {
-	ID            int       `json:"id"`
-	UserID        int       `json:"user_id"`
-	Amount        float64   `json:"amount"`
-	PaymentMethod string    `json:"payment_method"`
-	PaymentStatus string    `json:"payment_status"`
-	PaymentDate   time.Time `json:"payment_date"`
-	BookingID     int       `json:"booking_id"` // Add BookingID here
+	ID                 int       `json:"id"`
+	UserID             int       `json:"user_id"`
+	Amount             float64   `json:"amount"`
+	PaymentMethod      string    `json:"payment_method"`
+	PaymentStatus      string    `json:"payment_status"`
+	PaymentDate        time.Time `json:"payment_date"`
+	BookingID          int       `json:"booking_id"`                     // Add BookingID here
+	MembershipChangeID int       `json:"membership_change_id,omitempty"` // Set instead of BookingID for membership upgrades
+	PointsRedeemed     int       `json:"points_redeemed"`
+	PointsDiscount     float64   `json:"points_discount"` // Taken off the amount by redeeming loyalty points
 }
 
 // Invoice represents an invoice generated for a booking.
 type Invoice struct {
-	ID            int       `json:"id"`
-	UserID        int       `json:"user_id"`
-	BookingID     int       `json:"booking_id"`
-	Amount        float64   `json:"amount"`
-	PaymentStatus string    `json:"payment_status"`
-	InvoiceDate   time.Time `json:"invoice_date"`
-	CreatedAt     time.Time `json:"created_at"`
+	ID             int       `json:"id"`
+	UserID         int       `json:"user_id"`
+	BookingID      int       `json:"booking_id"`
+	Amount         float64   `json:"amount"`
+	PaymentStatus  string    `json:"payment_status"`
+	PointsDiscount float64   `json:"points_discount"`
+	InvoiceDate    time.Time `json:"invoice_date"`
+	CreatedAt      time.Time `json:"created_at"`
 }
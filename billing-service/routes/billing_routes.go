@@ -1,21 +1,39 @@
 package routes
 
 import (
+	"cnad_assignment/billing-service/database"
 	"cnad_assignment/billing-service/handlers" // Ensure this import is correct
+	"cnad_assignment/shared/auth"
+	"net/http"
 
 	"github.com/gorilla/mux"
 )
 
 // RegisterBillingRoutes registers routes related to billing
 func RegisterBillingRoutes(router *mux.Router) {
+	// Invoices may also be fetched by scripts with a personal API key holding the invoices:read scope
+	invoices := auth.APIKeyMiddleware(database.DB, auth.ScopeInvoicesRead)(http.HandlerFunc(handlers.FetchInvoices))
+	router.Handle("/api/v1/invoices", invoices).Methods("GET")
+
+	// Every other billing route requires a valid access token; the user is taken from the token
+	billingRouter := router.NewRoute().Subrouter()
+	billingRouter.Use(auth.Middleware(database.DB))
+
 	// Register the FetchBookings route for fetching all bookings for a user
 	//router.HandleFunc("/api/v1/bookings", handlers.FetchBookings).Methods("GET")
 
 	// Register the FetchBillingDetails route for fetching billing details
-	router.HandleFunc("/api/v1/billing", handlers.FetchBillingDetails).Methods("GET")
-	router.HandleFunc("/api/v1/payment/confirm", handlers.HandlePaymentConfirmation).Methods("POST")
-	router.HandleFunc("/api/v1/payment/confirm", handlers.ConfirmPayment).Methods("POST")
+	billingRouter.HandleFunc("/api/v1/billing", handlers.FetchBillingDetails).Methods("GET")
+	billingRouter.HandleFunc("/api/v1/billing/history", handlers.FetchBillingHistory).Methods("GET")
+	billingRouter.HandleFunc("/api/v1/payment/confirm", handlers.HandlePaymentConfirmation).Methods("POST")
+	billingRouter.HandleFunc("/api/v1/payment/confirm", handlers.ConfirmPayment).Methods("POST")
+	billingRouter.HandleFunc("/api/v1/payment/membership", handlers.PayMembershipChange).Methods("POST")
 
 	// Make sure the /api/v1/billing/bookings is handled correctly, assuming you want separate functionality
-	router.HandleFunc("/api/v1/billing/bookings", handlers.FetchBillingDetails).Methods("GET") // <- Updated to match billing details
+	billingRouter.HandleFunc("/api/v1/billing/bookings", handlers.FetchBillingDetails).Methods("GET") // <- Updated to match billing details
+
+	// Refunds for staff with the billing:refund permission
+	adminRouter := billingRouter.PathPrefix("/api/v1/admin").Subrouter()
+	adminRouter.Use(auth.RequirePermission(database.DB, auth.PermBillingRefund))
+	adminRouter.HandleFunc("/payments/{id:[0-9]+}/refund", handlers.AdminRefundPayment).Methods("POST")
 }
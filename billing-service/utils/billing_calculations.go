@@ -7,26 +7,20 @@ import (
 	"time"
 )
 
+// OneWayFee is charged on top of the rental for a booking that hands the vehicle back at a
+// different station from where it was picked up. Membership discounts do not apply to it.
+const OneWayFee = 15.00
+
 // CalculateBilling calculates the cost based on membership level and rental duration
 func CalculateBilling(userID int, startTime, endTime time.Time) (float64, error) {
-	var hourlyRateDiscount float64
-	var role string
-
-	// Fetch the user's role (membership tier) from the database
-	err := database.DB.QueryRow("SELECT role FROM users WHERE id = ?", userID).Scan(&role)
+	// Fetch the user's membership tier from the database
+	_, discountPercent, err := database.FetchMembershipTier(userID)
 	if err != nil {
 		return 0, err
 	}
 
-	// Set discount based on membership tier
-	switch role {
-	case "Premium":
-		hourlyRateDiscount = 0.10 // 10% discount for Premium
-	case "VIP":
-		hourlyRateDiscount = 0.20 // 20% discount for VIP
-	default:
-		hourlyRateDiscount = 0.00 // No discount for Basic tier
-	}
+	// The tier's discount is stored as a percentage
+	hourlyRateDiscount := discountPercent / 100
 
 	// Calculate rental duration in hours
 	rentalDuration := endTime.Sub(startTime).Hours()
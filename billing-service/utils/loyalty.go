@@ -0,0 +1,4 @@
+package utils
+
+// PointValue is how many dollars one redeemed loyalty point is worth
+const PointValue = 0.01
@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Scopes a personal API key can be granted
+const (
+	ScopeBookingsRead  = "bookings:read"
+	ScopeBookingsWrite = "bookings:write"
+	ScopeInvoicesRead  = "invoices:read"
+
+	// ScopeTelemetryWrite lets vehicle devices report telemetry. The key's owner also
+	// needs the fleet:manage permission.
+	ScopeTelemetryWrite = "telemetry:write"
+)
+
+// Scopes lists every API key scope
+var Scopes = []string{ScopeBookingsRead, ScopeBookingsWrite, ScopeInvoicesRead, ScopeTelemetryWrite}
+
+// APIKeyPrefix starts every personal API key so it can be told apart from a JWT
+const APIKeyPrefix = "cs_"
+
+// errAPIKeyNotAllowed is returned by Middleware for API keys on routes that only accept access tokens
+var errAPIKeyNotAllowed = errors.New("API keys are not accepted for this endpoint")
+
+// IsAPIKey reports whether a bearer token is a personal API key rather than a JWT
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
+
+// HashAPIKey returns the SHA-256 hex digest of an API key, which is all that is stored
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// HasScope reports whether the caller may use an API key scope. Access tokens from a
+// login carry every scope.
+func (identity Identity) HasScope(scope string) bool {
+	if identity.APIKeyID == 0 {
+		return true
+	}
+	for _, granted := range identity.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticateAPIKey looks up an active API key of an active account and records its use
+func authenticateAPIKey(db *sql.DB, key string) (Identity, error) {
+	var identity Identity
+	var scopes string
+	query := `
+        SELECT k.id, k.user_id, k.scopes, mt.name
+        FROM api_keys k
+        JOIN users u ON u.id = k.user_id
+        JOIN membership_tiers mt ON mt.id = u.membership_tier_id
+        WHERE k.key_hash = ? AND k.revoked_at IS NULL AND (k.expires_at IS NULL OR k.expires_at > NOW())
+          AND u.suspended_at IS NULL AND u.deleted_at IS NULL
+    `
+	err := db.QueryRow(query, HashAPIKey(key)).Scan(&identity.APIKeyID, &identity.UserID, &scopes, &identity.MembershipTier)
+	if err == sql.ErrNoRows {
+		return identity, errors.New("invalid or expired API key")
+	}
+	if err != nil {
+		return identity, fmt.Errorf("failed to check API key: %v", err)
+	}
+	if scopes != "" {
+		identity.Scopes = strings.Split(scopes, ",")
+	}
+
+	// Only write once a minute so busy scripts do not update the row on every call
+	touchQuery := "UPDATE api_keys SET last_used_at = NOW() WHERE id = ? AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL 1 MINUTE)"
+	if _, err := db.Exec(touchQuery, identity.APIKeyID); err != nil {
+		log.Printf("Error recording use of API key %d: %v", identity.APIKeyID, err)
+	}
+	return identity, nil
+}
+
+// APIKeyMiddleware is Middleware for routes that scripts may call: besides access tokens
+// it accepts personal API keys that hold the scope
+func APIKeyMiddleware(db *sql.DB, scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			identity, err := authenticate(db, r, true)
+			if err != nil {
+				log.Printf("Unauthorized request to %s: %v", r.URL.Path, err)
+				WriteError(w, http.StatusUnauthorized, "Unauthorized")
+				return
+			}
+			if !identity.HasScope(scope) {
+				log.Printf("API key %d denied %s %s: missing scope %s", identity.APIKeyID, r.Method, r.URL.Path, scope)
+				WriteError(w, http.StatusForbidden, "API key does not have the "+scope+" scope")
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(withIdentity(r.Context(), identity)))
+		})
+	}
+}
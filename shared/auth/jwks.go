@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultJWKSURL is where user-service publishes its token verification keys
+const DefaultJWKSURL = "http://localhost:8081/.well-known/jwks.json"
+
+// JWKSCacheTTL is how long a JWKSCache trusts fetched keys before refetching them. A key
+// published this long before it signs anything is known to every cache that is not stale.
+const JWKSCacheTTL = 10 * time.Minute
+
+// JWKSCache is a KeySource that fetches keys from user-service's JWKS endpoint and
+// caches them. An unknown key ID triggers a refetch so rotated keys are picked up
+// straight away. Fetches, including failed ones, happen at most once per minRefresh to
+// avoid hammering user-service, and run without holding the lock so requests for known
+// keys are never held up by a slow user-service.
+type JWKSCache struct {
+	URL        string
+	TTL        time.Duration // How long fetched keys are trusted before refetching
+	minRefresh time.Duration
+	client     *http.Client
+
+	mu          sync.Mutex
+	keys        map[string]ed25519.PublicKey
+	fetchedAt   time.Time     // Last successful fetch
+	attemptedAt time.Time     // Last fetch, successful or not
+	inflight    chan struct{} // Closed when the fetch under way finishes; nil if none is
+}
+
+// NewJWKSCache creates a cache for the JWKS served at url
+func NewJWKSCache(url string) *JWKSCache {
+	return &JWKSCache{
+		URL:        url,
+		TTL:        JWKSCacheTTL,
+		minRefresh: time.Minute,
+		client:     &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// PublicKey returns the key with the given ID, fetching the JWKS when the cache is stale
+// or does not know the key yet. Callers arriving while a fetch is under way wait for it
+// instead of starting their own. If user-service is unreachable, stale keys keep being used.
+func (c *JWKSCache) PublicKey(kid string) (ed25519.PublicKey, error) {
+	c.mu.Lock()
+	key, known := c.keys[kid]
+	if known && time.Since(c.fetchedAt) <= c.TTL {
+		c.mu.Unlock()
+		return key, nil
+	}
+
+	if done := c.inflight; done != nil {
+		c.mu.Unlock()
+		<-done
+		c.mu.Lock()
+	} else if time.Since(c.attemptedAt) > c.minRefresh {
+		done := make(chan struct{})
+		c.inflight = done
+		c.attemptedAt = time.Now()
+		c.mu.Unlock()
+
+		keys, err := c.fetch()
+
+		c.mu.Lock()
+		if err != nil {
+			log.Printf("Error fetching JWKS from %s: %v", c.URL, err)
+		} else {
+			c.keys = keys
+			c.fetchedAt = time.Now()
+		}
+		c.inflight = nil
+		close(done)
+	}
+
+	key, known = c.keys[kid]
+	c.mu.Unlock()
+	if known {
+		return key, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+// fetch downloads the current JWKS and returns its keys by ID
+func (c *JWKSCache) fetch() (map[string]ed25519.PublicKey, error) {
+	resp, err := c.client.Get(c.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	var set JWKSet
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %v", err)
+	}
+
+	keys := make(map[string]ed25519.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		publicKey, err := jwk.PublicKey()
+		if err != nil {
+			log.Printf("Skipping JWKS key %s: %v", jwk.Kid, err)
+			continue
+		}
+		keys[jwk.Kid] = publicKey
+	}
+	return keys, nil
+}
@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// JWK is an Ed25519 public key in JSON Web Key format (RFC 8037)
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Kid string `json:"kid"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+}
+
+// JWKSet is the document served at /.well-known/jwks.json
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewJWK encodes a public key as a signing JWK
+func NewJWK(kid string, publicKey ed25519.PublicKey) JWK {
+	return JWK{
+		Kty: "OKP",
+		Crv: "Ed25519",
+		X:   base64.RawURLEncoding.EncodeToString(publicKey),
+		Kid: kid,
+		Use: "sig",
+		Alg: "EdDSA",
+	}
+}
+
+// PublicKey decodes the Ed25519 public key of the JWK
+func (k JWK) PublicKey() (ed25519.PublicKey, error) {
+	if k.Kty != "OKP" || k.Crv != "Ed25519" {
+		return nil, errors.New("unsupported key type")
+	}
+	x, err := base64.RawURLEncoding.DecodeString(k.X)
+	if err != nil || len(x) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid Ed25519 key")
+	}
+	return ed25519.PublicKey(x), nil
+}
+
+// KeyThumbprint returns the RFC 7638 thumbprint of a public key, used as its key ID
+func KeyThumbprint(publicKey ed25519.PublicKey) string {
+	// Members in lexicographic order, as the RFC requires
+	canonical, _ := json.Marshal(struct {
+		Crv string `json:"crv"`
+		Kty string `json:"kty"`
+		X   string `json:"x"`
+	}{"Ed25519", "OKP", base64.RawURLEncoding.EncodeToString(publicKey)})
+
+	sum := sha256.Sum256(canonical)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// SigningKey is one Ed25519 key pair used to sign tokens
+type SigningKey struct {
+	ID         string
+	PrivateKey ed25519.PrivateKey
+	CreatedAt  time.Time
+	ActiveFrom time.Time // When the key starts signing; it is published before then
+}
+
+// KeySet holds the signing keys of user-service. The newest active key signs new tokens.
+// Keys not active yet are already published so verifiers know them before they see them,
+// and older keys stay published so tokens they signed can be verified until they expire.
+type KeySet struct {
+	mu   sync.RWMutex
+	keys []SigningKey // Oldest first, by ActiveFrom
+}
+
+// NewKeySet creates a key set from keys ordered oldest first
+func NewKeySet(keys []SigningKey) *KeySet {
+	return &KeySet{keys: keys}
+}
+
+// Replace swaps in a new list of keys ordered oldest first, e.g. after rotation
+func (s *KeySet) Replace(keys []SigningKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = keys
+}
+
+// Keys returns a copy of the keys ordered oldest first
+func (s *KeySet) Keys() []SigningKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]SigningKey(nil), s.keys...)
+}
+
+// Sign signs the claims with the newest active key, setting the "kid" header and "iss" claim
+func (s *KeySet) Sign(claims jwt.MapClaims) (string, error) {
+	s.mu.RLock()
+	now := time.Now()
+	active := -1
+	for i, key := range s.keys {
+		if !key.ActiveFrom.After(now) {
+			active = i
+		}
+	}
+	if active < 0 {
+		s.mu.RUnlock()
+		return "", errors.New("no signing key available")
+	}
+	key := s.keys[active]
+	s.mu.RUnlock()
+
+	claims["iss"] = Issuer
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.PrivateKey)
+}
+
+// PublicKey returns the public half of the key with the given ID
+func (s *KeySet) PublicKey(kid string) (ed25519.PublicKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, key := range s.keys {
+		if key.ID == kid {
+			return key.PrivateKey.Public().(ed25519.PublicKey), nil
+		}
+	}
+	return nil, ErrUnknownKey
+}
+
+// JWKS returns the public keys of the set, newest first
+func (s *KeySet) JWKS() JWKSet {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	set := JWKSet{Keys: []JWK{}}
+	for i := len(s.keys) - 1; i >= 0; i-- {
+		key := s.keys[i]
+		set.Keys = append(set.Keys, NewJWK(key.ID, key.PrivateKey.Public().(ed25519.PublicKey)))
+	}
+	return set
+}
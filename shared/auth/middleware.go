@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Identity is the authenticated caller of a request
+type Identity struct {
+	UserID         int
+	SessionID      int
+	MembershipTier string // Tier when the token was issued; may lag a change by up to the token lifetime
+
+	APIKeyID int      // Set when the caller authenticated with a personal API key instead of a login
+	Scopes   []string // Scopes of the API key
+}
+
+type contextKey struct{}
+
+// BearerToken extracts the token from an "Authorization: Bearer <token>" header
+func BearerToken(r *http.Request) (string, error) {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		return "", errors.New("missing authorization header")
+	}
+
+	parts := strings.Split(authHeader, " ")
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		return "", errors.New("invalid authorization header format")
+	}
+	return parts[1], nil
+}
+
+// Authenticate validates the bearer access token of the request and rejects tokens
+// whose login session has been revoked or has expired. Personal API keys are refused.
+func Authenticate(db *sql.DB, r *http.Request) (Identity, error) {
+	return authenticate(db, r, false)
+}
+
+// authenticate validates the bearer token of the request, which may be a personal API
+// key when allowAPIKey is set
+func authenticate(db *sql.DB, r *http.Request, allowAPIKey bool) (Identity, error) {
+	var identity Identity
+
+	tokenString, err := BearerToken(r)
+	if err != nil {
+		return identity, err
+	}
+	if IsAPIKey(tokenString) {
+		if !allowAPIKey {
+			return identity, errAPIKeyNotAllowed
+		}
+		return authenticateAPIKey(db, tokenString)
+	}
+
+	claims, err := ParseToken(tokenString, AudienceAPI)
+	if err != nil {
+		return identity, err
+	}
+
+	userID, ok := claims["sub"].(float64)
+	if !ok {
+		return identity, errors.New("invalid token")
+	}
+	sessionID, ok := claims["sid"].(float64)
+	if !ok {
+		return identity, errors.New("token is not bound to a session")
+	}
+
+	// Reject tokens from sessions that were logged out or revoked
+	var active bool
+	query := "SELECT revoked_at IS NULL AND expires_at > NOW() FROM user_sessions WHERE id = ?"
+	err = db.QueryRow(query, int(sessionID)).Scan(&active)
+	if err != nil && err != sql.ErrNoRows {
+		return identity, fmt.Errorf("failed to check session: %v", err)
+	}
+	if !active {
+		return identity, errors.New("session has been revoked")
+	}
+
+	identity.UserID = int(userID)
+	identity.SessionID = int(sessionID)
+	identity.MembershipTier, _ = claims["tier"].(string)
+	return identity, nil
+}
+
+// Middleware rejects requests without a valid access token and stores the caller's
+// Identity in the request context for handlers to read with FromContext. Routes that
+// also accept personal API keys use APIKeyMiddleware instead.
+func Middleware(db *sql.DB) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			identity, err := Authenticate(db, r)
+			if err == errAPIKeyNotAllowed {
+				WriteError(w, http.StatusForbidden, err.Error())
+				return
+			}
+			if err != nil {
+				log.Printf("Unauthorized request to %s: %v", r.URL.Path, err)
+				WriteError(w, http.StatusUnauthorized, "Unauthorized")
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(withIdentity(r.Context(), identity)))
+		})
+	}
+}
+
+// withIdentity stores the authenticated caller in the request context
+func withIdentity(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, identity)
+}
+
+// FromContext returns the Identity stored by Middleware
+func FromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(contextKey{}).(Identity)
+	return identity, ok
+}
+
+// UserID returns the authenticated user's ID, or 0 if the request did not pass through Middleware
+func UserID(r *http.Request) int {
+	identity, _ := FromContext(r.Context())
+	return identity.UserID
+}
+
+// WriteError writes a JSON error response in the {"error": "..."} shape used across the API
+func WriteError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+)
+
+// Permissions granted to staff roles
+const (
+	PermUsersRead     = "users:read"
+	PermUsersManage   = "users:manage"
+	PermRolesManage   = "roles:manage"
+	PermFleetManage   = "fleet:manage"
+	PermBillingRefund = "billing:refund"
+	PermLicenceReview = "licences:review"
+)
+
+// HasPermission reports whether any of the user's roles grants the permission
+func HasPermission(db *sql.DB, userID int, permission string) (bool, error) {
+	var granted bool
+	query := `
+        SELECT EXISTS (
+            SELECT 1
+            FROM user_roles ur
+            JOIN role_permissions rp ON rp.role_id = ur.role_id
+            JOIN permissions p ON p.id = rp.permission_id
+            WHERE ur.user_id = ? AND p.name = ?
+        )
+    `
+	err := db.QueryRow(query, userID, permission).Scan(&granted)
+	return granted, err
+}
+
+// RequirePermission rejects requests whose caller lacks the permission. It must run
+// after Middleware so the caller's Identity is in the request context.
+func RequirePermission(db *sql.DB, permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			identity, ok := FromContext(r.Context())
+			if !ok {
+				WriteError(w, http.StatusUnauthorized, "Unauthorized")
+				return
+			}
+
+			granted, err := HasPermission(db, identity.UserID, permission)
+			if err != nil {
+				log.Printf("Error checking permission %s for user %d: %v", permission, identity.UserID, err)
+				WriteError(w, http.StatusInternalServerError, "Failed to check permissions")
+				return
+			}
+			if !granted {
+				log.Printf("User %d denied %s %s: missing permission %s", identity.UserID, r.Method, r.URL.Path, permission)
+				WriteError(w, http.StatusForbidden, "Forbidden")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Issuer is the "iss" claim of every token issued by user-service
+const Issuer = "http://localhost:8081"
+
+// Token audiences
+const (
+	AudienceAPI         = "car-sharing-api"          // Access tokens accepted by every service
+	AudienceUserService = "car-sharing-user-service" // Tokens only user-service accepts, e.g. MFA pending tokens
+)
+
+// KeySource looks up the public key that verifies tokens signed under a key ID
+type KeySource interface {
+	PublicKey(kid string) (ed25519.PublicKey, error)
+}
+
+// ErrUnknownKey is returned by a KeySource when it has no key with the requested ID
+var ErrUnknownKey = errors.New("unknown signing key")
+
+var (
+	keySourceMu sync.RWMutex
+	keySource   KeySource
+)
+
+// SetKeySource sets where ParseToken finds verification keys. user-service uses its own
+// KeySet; the other services use a JWKSCache pointed at user-service.
+func SetKeySource(source KeySource) {
+	keySourceMu.Lock()
+	defer keySourceMu.Unlock()
+	keySource = source
+}
+
+func currentKeySource() (KeySource, error) {
+	keySourceMu.RLock()
+	defer keySourceMu.RUnlock()
+	if keySource == nil {
+		return nil, errors.New("no token verification keys configured")
+	}
+	return keySource, nil
+}
+
+// ParseToken verifies the signature, expiry, issuer and audience of a token and returns its claims
+func ParseToken(tokenString, audience string) (jwt.MapClaims, error) {
+	source, err := currentKeySource()
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodEd25519); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		kid, ok := token.Header["kid"].(string)
+		if !ok || kid == "" {
+			return nil, errors.New("token has no key ID")
+		}
+		return source.PublicKey(kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	if !claims.VerifyIssuer(Issuer, true) {
+		return nil, errors.New("invalid token issuer")
+	}
+	if !claims.VerifyAudience(audience, true) {
+		return nil, errors.New("invalid token audience")
+	}
+	return claims, nil
+}
@@ -0,0 +1,103 @@
+package notify
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// MaxAttempts is how many times a message is tried before it is marked failed
+const MaxAttempts = 6
+
+// RetryBaseDelay is the wait before the first retry; every further retry waits twice as long
+const RetryBaseDelay = time.Minute
+
+// claimTimeout is how long a dispatcher holds a message it is sending before others may
+// pick it up again, e.g. after the dispatcher crashed mid-send
+const claimTimeout = 5 * time.Minute
+
+// retryDelay returns how long to wait after the given number of failed attempts
+func retryDelay(attempts int) time.Duration {
+	return RetryBaseDelay << uint(attempts-1)
+}
+
+// Dispatch sends up to limit messages that are due and returns how many were sent and how
+// many failed. Each message is claimed before sending, so several dispatchers can run
+// side by side without sending a message twice. Failed messages are retried with
+// exponential backoff until MaxAttempts is reached.
+func Dispatch(db *sql.DB, senders map[string]Sender, limit int) (int, int, error) {
+	query := `
+        SELECT id, channel, recipient, template, COALESCE(subject, ''), body, attempts
+        FROM notification_outbox
+        WHERE status = 'pending' AND next_attempt_at <= ?
+        ORDER BY next_attempt_at
+        LIMIT ?
+    `
+	rows, err := db.Query(query, time.Now(), limit)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	type dueMessage struct {
+		Message
+		attempts int
+	}
+	var due []dueMessage
+	for rows.Next() {
+		var msg dueMessage
+		if err := rows.Scan(&msg.ID, &msg.Channel, &msg.Recipient, &msg.Template, &msg.Subject, &msg.Body, &msg.attempts); err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		due = append(due, msg)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	sent, failed := 0, 0
+	for _, msg := range due {
+		now := time.Now()
+		claimQuery := "UPDATE notification_outbox SET next_attempt_at = ? WHERE id = ? AND status = 'pending' AND next_attempt_at <= ?"
+		result, err := db.Exec(claimQuery, now.Add(claimTimeout), msg.ID, now)
+		if err != nil {
+			return sent, failed, err
+		}
+		if claimed, err := result.RowsAffected(); err != nil || claimed == 0 {
+			continue // Another dispatcher got there first
+		}
+
+		sendErr := fmt.Errorf("no sender configured for channel %s", msg.Channel)
+		if sender, ok := senders[msg.Channel]; ok {
+			sendErr = sender.Send(msg.Message)
+		}
+
+		attempts := msg.attempts + 1
+		if sendErr == nil {
+			_, err = db.Exec("UPDATE notification_outbox SET status = 'sent', attempts = ?, sent_at = ?, last_error = NULL WHERE id = ?",
+				attempts, time.Now(), msg.ID)
+			sent++
+		} else {
+			status := "pending"
+			if attempts >= MaxAttempts {
+				status = "failed"
+			}
+			_, err = db.Exec("UPDATE notification_outbox SET status = ?, attempts = ?, next_attempt_at = ?, last_error = ? WHERE id = ?",
+				status, attempts, time.Now().Add(retryDelay(attempts)), truncate(sendErr.Error(), 255), msg.ID)
+			failed++
+		}
+		if err != nil {
+			return sent, failed, err
+		}
+	}
+	return sent, failed, nil
+}
+
+// truncate shortens s to at most n bytes so it fits its column
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
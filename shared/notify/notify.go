@@ -0,0 +1,134 @@
+// Package notify sends notifications to users by email, SMS and push. Messages are
+// rendered from templates and written to the notification_outbox table; Dispatch
+// delivers them in the background and retries failures, so a slow or unreachable
+// provider never holds up the request that caused the notification.
+package notify
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Delivery channels
+const (
+	ChannelEmail = "email"
+	ChannelSMS   = "sms"
+	ChannelPush  = "push" // Posted as JSON to the user's webhook URL
+)
+
+// Data fills in the placeholders of a template
+type Data map[string]interface{}
+
+// Notification is a message for a user. It is sent on every channel the user has enabled
+// and has a contact for.
+type Notification struct {
+	UserID    int
+	Template  string
+	Data      Data
+	DedupeKey string // A notification with the same key is only queued once per channel; empty never deduplicates
+}
+
+// recipient is where a user receives notifications on each channel they enabled
+type recipient struct {
+	name     string
+	contacts map[string]string // Channel to email address, phone number or webhook URL
+}
+
+// loadRecipient looks up the user's enabled channels. Users who never saved preferences
+// are notified by email only.
+func loadRecipient(db *sql.DB, userID int) (recipient, error) {
+	var email, phone, name, webhookURL string
+	var emailEnabled, smsEnabled, pushEnabled bool
+	query := `
+        SELECT COALESCE(u.email, ''), COALESCE(u.phone, ''), u.name,
+               COALESCE(p.email_enabled, TRUE), COALESCE(p.sms_enabled, FALSE), COALESCE(p.push_enabled, FALSE),
+               COALESCE(p.push_webhook_url, '')
+        FROM users u
+        LEFT JOIN notification_preferences p ON p.user_id = u.id
+        WHERE u.id = ? AND u.deleted_at IS NULL
+    `
+	err := db.QueryRow(query, userID).Scan(&email, &phone, &name, &emailEnabled, &smsEnabled, &pushEnabled, &webhookURL)
+	if err != nil {
+		return recipient{}, err
+	}
+
+	contacts := map[string]string{}
+	if emailEnabled && email != "" {
+		contacts[ChannelEmail] = email
+	}
+	if smsEnabled && phone != "" {
+		contacts[ChannelSMS] = phone
+	}
+	if pushEnabled && webhookURL != "" {
+		contacts[ChannelPush] = webhookURL
+	}
+	return recipient{name: name, contacts: contacts}, nil
+}
+
+// Notify renders the notification and queues it on each channel the user has enabled.
+// It returns how many messages were queued, which is 0 for a user with no usable channel
+// or a notification that was already queued under the same dedupe key.
+func Notify(db *sql.DB, n Notification) (int, error) {
+	to, err := loadRecipient(db, n.UserID)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("user %d not found", n.UserID)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to load notification preferences: %v", err)
+	}
+
+	data := Data{"Name": to.name}
+	for key, value := range n.Data {
+		data[key] = value
+	}
+
+	queued := 0
+	for _, channel := range []string{ChannelEmail, ChannelSMS, ChannelPush} {
+		contact, ok := to.contacts[channel]
+		if !ok {
+			continue
+		}
+		subject, body, err := render(n.Template, channel, data)
+		if err != nil {
+			return queued, err
+		}
+		inserted, err := enqueue(db, n.UserID, channel, contact, n.Template, subject, body, n.DedupeKey)
+		if err != nil {
+			return queued, fmt.Errorf("failed to queue %s notification: %v", channel, err)
+		}
+		if inserted {
+			queued++
+		}
+	}
+	return queued, nil
+}
+
+// SendTo queues a message for a specific address regardless of preferences. It is meant
+// for messages the account depends on, such as verification links, and for addresses that
+// are not on an account yet.
+func SendTo(db *sql.DB, channel, to, template string, data Data) error {
+	subject, body, err := render(template, channel, data)
+	if err != nil {
+		return err
+	}
+	if _, err := enqueue(db, 0, channel, to, template, subject, body, ""); err != nil {
+		return fmt.Errorf("failed to queue %s notification: %v", channel, err)
+	}
+	return nil
+}
+
+// enqueue writes a message to the outbox and reports whether it was new. A message whose
+// dedupe key was already used on the channel is left as it is.
+func enqueue(db *sql.DB, userID int, channel, to, template, subject, body, dedupeKey string) (bool, error) {
+	query := `
+        INSERT INTO notification_outbox (user_id, channel, recipient, template, subject, body, dedupe_key)
+        VALUES (NULLIF(?, 0), ?, ?, ?, ?, ?, NULLIF(?, ''))
+        ON DUPLICATE KEY UPDATE id = id
+    `
+	result, err := db.Exec(query, userID, channel, to, template, subject, body, dedupeKey)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	return rowsAffected > 0, err
+}
@@ -0,0 +1,156 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"gopkg.in/gomail.v2"
+)
+
+// Message is a rendered notification taken from the outbox for delivery
+type Message struct {
+	ID        int
+	Channel   string
+	Recipient string // Email address, phone number or webhook URL, depending on the channel
+	Template  string
+	Subject   string
+	Body      string
+}
+
+// Sender delivers messages on one channel
+type Sender interface {
+	Send(msg Message) error
+}
+
+// FileSender is a Sender for local development. It appends every message to a file
+// instead of delivering it.
+type FileSender struct {
+	Path string
+}
+
+// Send appends the message to the file
+func (s FileSender) Send(msg Message) error {
+	f, err := os.OpenFile(s.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open notification sink: %v", err)
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "%s\t%s\t%s\t%q\t%q\n", time.Now().Format(time.RFC3339), msg.Channel, msg.Recipient, msg.Subject, msg.Body)
+	return err
+}
+
+// SMTPSender delivers email through an SMTP server. Without a username it does not
+// authenticate, which suits local SMTP sinks such as MailHog.
+type SMTPSender struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+// Send emails the message as plain text
+func (s SMTPSender) Send(msg Message) error {
+	m := gomail.NewMessage()
+	m.SetHeader("From", s.From)
+	m.SetHeader("To", msg.Recipient)
+	m.SetHeader("Subject", msg.Subject)
+	m.SetBody("text/plain", msg.Body)
+
+	dialer := gomail.NewDialer(s.Host, s.Port, s.Username, s.Password)
+	return dialer.DialAndSend(m)
+}
+
+// WebhookSender delivers push notifications by posting them as JSON to the recipient URL
+type WebhookSender struct {
+	Client *http.Client
+}
+
+// Send posts the message to the webhook and expects a 2xx response
+func (s WebhookSender) Send(msg Message) error {
+	payload, err := json.Marshal(map[string]interface{}{
+		"id":       msg.ID,
+		"template": msg.Template,
+		"title":    msg.Subject,
+		"body":     msg.Body,
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.Client.Post(msg.Recipient, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// DefaultSinkFile is where FileSender writes when NOTIFY_SINK_FILE is not set
+const DefaultSinkFile = "notification_outbox.log"
+
+// SendersFromEnv sets up a Sender for every channel from the environment. By default all
+// channels write to the file named by NOTIFY_SINK_FILE so nothing leaves the machine.
+// NOTIFY_EMAIL=smtp sends email through SMTP_HOST, SMTP_PORT, SMTP_USERNAME, SMTP_PASSWORD
+// and SMTP_FROM, and NOTIFY_PUSH=webhook posts push notifications to users' webhooks.
+// There is no SMS provider yet, so SMS always goes to the file.
+func SendersFromEnv() (map[string]Sender, error) {
+	sinkPath := os.Getenv("NOTIFY_SINK_FILE")
+	if sinkPath == "" {
+		sinkPath = DefaultSinkFile
+	}
+	sink := FileSender{Path: sinkPath}
+	senders := map[string]Sender{ChannelEmail: sink, ChannelSMS: sink, ChannelPush: sink}
+
+	switch backend := os.Getenv("NOTIFY_EMAIL"); backend {
+	case "", "file":
+	case "smtp":
+		host := os.Getenv("SMTP_HOST")
+		from := os.Getenv("SMTP_FROM")
+		if host == "" || from == "" {
+			return nil, errors.New("NOTIFY_EMAIL=smtp needs SMTP_HOST and SMTP_FROM")
+		}
+		port := 587
+		if value := os.Getenv("SMTP_PORT"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed <= 0 {
+				return nil, fmt.Errorf("invalid SMTP_PORT %q", value)
+			}
+			port = parsed
+		}
+		senders[ChannelEmail] = SMTPSender{
+			Host:     host,
+			Port:     port,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		}
+	default:
+		return nil, fmt.Errorf("unknown NOTIFY_EMAIL backend %q", backend)
+	}
+
+	switch backend := os.Getenv("NOTIFY_PUSH"); backend {
+	case "", "file":
+	case "webhook":
+		senders[ChannelPush] = WebhookSender{Client: &http.Client{Timeout: 10 * time.Second}}
+	default:
+		return nil, fmt.Errorf("unknown NOTIFY_PUSH backend %q", backend)
+	}
+
+	for channel, sender := range senders {
+		log.Printf("Delivering %s notifications with %T", channel, sender)
+	}
+	return senders, nil
+}
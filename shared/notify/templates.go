@@ -0,0 +1,132 @@
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+	"time"
+)
+
+// Templates
+const (
+	TemplateEmailVerification  = "email_verification"
+	TemplatePasswordReset      = "password_reset"
+	TemplateEmailChangeConfirm = "email_change_confirm"
+	TemplateEmailChangeNotice  = "email_change_notice"
+	TemplateAccountLocked      = "account_locked"
+	TemplateBookingConfirmed   = "booking_confirmed"
+	TemplateBookingReminder    = "booking_reminder"
+	TemplateReturnOverdue      = "return_overdue"
+	TemplateInvoice            = "invoice"
+	TemplateOneTimeCode        = "one_time_code"
+)
+
+// messageTemplate is the text of a notification. Email uses the subject and body; SMS
+// uses the short form, and push the subject as its title and the short form as its body.
+// Templates without a short form can only be sent by email, and those without a body
+// only by SMS or push.
+type messageTemplate struct {
+	subject *template.Template
+	body    *template.Template
+	short   *template.Template
+}
+
+var templateFuncs = template.FuncMap{
+	"datetime": func(t time.Time) string { return t.Format("Mon 2 Jan 2006 15:04") },
+	"money":    func(amount float64) string { return fmt.Sprintf("$%.2f", amount) },
+}
+
+// newTemplate parses the parts of a template, panicking on mistakes since they are fixed at compile time
+func newTemplate(name, subject, body, short string) messageTemplate {
+	parse := func(part, text string) *template.Template {
+		if text == "" {
+			return nil
+		}
+		return template.Must(template.New(name + "." + part).Funcs(templateFuncs).Option("missingkey=error").Parse(text))
+	}
+	return messageTemplate{subject: parse("subject", subject), body: parse("body", body), short: parse("short", short)}
+}
+
+var templates = map[string]messageTemplate{
+	TemplateEmailVerification: newTemplate(TemplateEmailVerification,
+		"Email Verification",
+		"Please verify your email by clicking the link: {{.Link}}\n\nThe link expires in {{.ExpiresHours}} hours.",
+		""),
+	TemplatePasswordReset: newTemplate(TemplatePasswordReset,
+		"Password Reset",
+		"We received a request to reset your password. Use the link below within {{.ExpiresMinutes}} minutes to choose a new one:\n\n{{.Link}}\n\nIf you did not request this, you can ignore this email.",
+		""),
+	TemplateEmailChangeConfirm: newTemplate(TemplateEmailChangeConfirm,
+		"Confirm Your New Email Address",
+		"Confirm that you want to use this address to log in by opening the link below within {{.ExpiresHours}} hours:\n\n{{.Link}}\n\nIf you did not request this, you can ignore this email.",
+		""),
+	TemplateEmailChangeNotice: newTemplate(TemplateEmailChangeNotice,
+		"Email Change Requested",
+		"A request was made to change the email address of your account to {{.NewEmail}}. The change only takes effect once it is confirmed from that address.\n\nIf this was not you, reset your password and log out of all devices.",
+		""),
+	TemplateAccountLocked: newTemplate(TemplateAccountLocked,
+		"Account Locked",
+		"Your account was locked for {{.LockedMinutes}} minutes after too many failed login attempts.\n\nIf this was you, use the link below to unlock it now:\n\n{{.Link}}\n\nIf it was not you, consider resetting your password.",
+		""),
+	TemplateBookingConfirmed: newTemplate(TemplateBookingConfirmed,
+		"Booking Confirmed: {{.Vehicle}}",
+		"Hi {{.Name}},\n\nYour booking #{{.BookingID}} of the {{.Vehicle}} is confirmed.\n\nPick-up: {{datetime .StartTime}}\nReturn: {{datetime .EndTime}}\n\nYou can change or cancel it from your bookings page.",
+		"Car Sharing: booking #{{.BookingID}} confirmed. {{.Vehicle}} from {{datetime .StartTime}} to {{datetime .EndTime}}."),
+	TemplateBookingReminder: newTemplate(TemplateBookingReminder,
+		"Your Rental Starts Soon",
+		"Hi {{.Name}},\n\nThis is a reminder that your booking #{{.BookingID}} of the {{.Vehicle}} starts at {{datetime .StartTime}}.\n\nPlease return the vehicle by {{datetime .EndTime}}.",
+		"Car Sharing: your {{.Vehicle}} is booked from {{datetime .StartTime}}. Return it by {{datetime .EndTime}}."),
+	TemplateReturnOverdue: newTemplate(TemplateReturnOverdue,
+		"Vehicle Return Overdue",
+		"Hi {{.Name}},\n\nYour booking #{{.BookingID}} of the {{.Vehicle}} ended at {{datetime .EndTime}}, but the vehicle has not been returned yet.\n\nPlease return it as soon as possible. Late returns may be charged.",
+		"Car Sharing: your {{.Vehicle}} was due back at {{datetime .EndTime}}. Please return it as soon as possible."),
+	TemplateInvoice: newTemplate(TemplateInvoice,
+		"Your Invoice",
+		"Hi {{.Name}},\n\nThank you for your payment.\n\nInvoice ID: {{.InvoiceID}}\nBooking ID: {{.BookingID}}\n{{if .PointsRedeemed}}Loyalty Points Discount: -{{money .PointsDiscount}} ({{.PointsRedeemed}} points)\n{{end}}Amount: {{money .Amount}}\nStatus: Paid\nDate: {{datetime .Date}}",
+		"Car Sharing: payment of {{money .Amount}} for booking #{{.BookingID}} received. Invoice {{.InvoiceID}}."),
+	TemplateOneTimeCode: newTemplate(TemplateOneTimeCode,
+		"",
+		"",
+		"Car Sharing: your code is {{.Code}}. It expires in {{.ExpiresMinutes}} minutes."),
+}
+
+// render fills in the template for the channel and returns the subject and body
+func render(name, channel string, data Data) (string, string, error) {
+	tmpl, ok := templates[name]
+	if !ok {
+		return "", "", fmt.Errorf("unknown notification template %q", name)
+	}
+
+	var subject, body *template.Template
+	switch channel {
+	case ChannelEmail:
+		subject, body = tmpl.subject, tmpl.body
+	case ChannelSMS:
+		body = tmpl.short
+	case ChannelPush:
+		subject, body = tmpl.subject, tmpl.short
+	default:
+		return "", "", fmt.Errorf("unknown notification channel %q", channel)
+	}
+	if body == nil {
+		return "", "", fmt.Errorf("notification template %q cannot be sent by %s", name, channel)
+	}
+
+	execute := func(t *template.Template) (string, error) {
+		if t == nil {
+			return "", nil
+		}
+		var buf bytes.Buffer
+		err := t.Execute(&buf, data)
+		return buf.String(), err
+	}
+	renderedSubject, err := execute(subject)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to render notification %q: %v", name, err)
+	}
+	renderedBody, err := execute(body)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to render notification %q: %v", name, err)
+	}
+	return renderedSubject, renderedBody, nil
+}
@@ -0,0 +1,168 @@
+package database
+
+import (
+	"cnad_assignment/user-service/models"
+	"database/sql"
+	"errors"
+)
+
+// ErrRentalInProgress is returned when an account cannot be deleted because a rental is under way.
+var ErrRentalInProgress = errors.New("rental in progress")
+
+// DeletedUserName replaces the name of deleted accounts
+const DeletedUserName = "Deleted user"
+
+// accountColumns selects the account details of users u joined with membership_tiers mt
+const accountColumns = `u.id, COALESCE(u.email, ''), COALESCE(u.phone, ''), u.name, mt.name, u.is_verified,
+               u.mfa_enabled, u.mfa_required, u.created_at, u.suspended_at, COALESCE(u.suspension_reason, '')`
+
+// scanAccount reads a row selected with accountColumns
+func scanAccount(row interface{ Scan(...interface{}) error }) (models.User, error) {
+	var user models.User
+	var suspendedAt sql.NullTime
+	err := row.Scan(&user.ID, &user.Email, &user.Phone, &user.Name, &user.MembershipTier, &user.IsVerified,
+		&user.MFAEnabled, &user.MFARequired, &user.CreatedAt, &suspendedAt, &user.SuspensionReason)
+	if suspendedAt.Valid {
+		user.SuspendedAt = &suspendedAt.Time
+	}
+	return user, err
+}
+
+// FetchAccount returns the user's account details and staff roles, without the password hash
+func FetchAccount(userID int) (models.User, error) {
+	query := `
+        SELECT ` + accountColumns + `
+        FROM users u
+        JOIN membership_tiers mt ON mt.id = u.membership_tier_id
+        WHERE u.id = ?
+    `
+	user, err := scanAccount(DB.QueryRow(query, userID))
+	if err != nil {
+		return user, err
+	}
+
+	user.Roles, err = FetchUserRoles(userID)
+	return user, err
+}
+
+// FetchSessions returns every login session of the user, newest first
+func FetchSessions(userID int) ([]models.Session, error) {
+	query := `
+        SELECT id, user_id, COALESCE(user_agent, ''), COALESCE(ip_address, ''), expires_at, revoked_at, last_used_at, created_at
+        FROM user_sessions
+        WHERE user_id = ?
+        ORDER BY created_at DESC
+    `
+	rows, err := DB.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		var session models.Session
+		var revokedAt, lastUsedAt sql.NullTime
+		err := rows.Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IPAddress, &session.ExpiresAt,
+			&revokedAt, &lastUsedAt, &session.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if revokedAt.Valid {
+			session.RevokedAt = &revokedAt.Time
+		}
+		if lastUsedAt.Valid {
+			session.LastUsedAt = &lastUsedAt.Time
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// FetchSecurityEvents returns the user's security audit trail, newest first
+func FetchSecurityEvents(userID int) ([]models.SecurityEvent, error) {
+	query := `
+        SELECT event_type, COALESCE(ip_address, ''), COALESCE(details, ''), created_at
+        FROM security_events
+        WHERE user_id = ?
+        ORDER BY created_at DESC
+    `
+	rows, err := DB.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []models.SecurityEvent{}
+	for rows.Next() {
+		var event models.SecurityEvent
+		if err := rows.Scan(&event.EventType, &event.IPAddress, &event.Details, &event.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// DeleteAccount anonymises the user's personal fields, removes their credentials and
+// cancels their upcoming bookings. The user row itself stays so bookings, payments and
+// invoices keep a valid reference for accounting.
+func DeleteAccount(userID int) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	var email, phone sql.NullString
+	if err := tx.QueryRow("SELECT email, phone FROM users WHERE id = ? FOR UPDATE", userID).Scan(&email, &phone); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	var inProgress bool
+	query := "SELECT EXISTS (SELECT 1 FROM bookings WHERE user_id = ? AND status = 'confirmed' AND start_time <= NOW() AND end_time > NOW())"
+	if err := tx.QueryRow(query, userID).Scan(&inProgress); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if inProgress {
+		tx.Rollback()
+		return ErrRentalInProgress
+	}
+
+	statements := []struct {
+		query string
+		args  []interface{}
+	}{
+		{"UPDATE bookings SET status = 'canceled' WHERE user_id = ? AND status IN ('confirmed', 'modified') AND start_time > NOW()", []interface{}{userID}},
+		{"DELETE FROM user_sessions WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE FROM password_reset_tokens WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE FROM email_verification_tokens WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE FROM email_change_requests WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE FROM account_unlock_tokens WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE FROM mfa_recovery_codes WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE FROM api_keys WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE FROM notification_preferences WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE FROM notification_outbox WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE FROM user_roles WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE FROM driver_licences WHERE user_id = ?", []interface{}{userID}},
+		{"UPDATE membership_changes SET status = 'canceled' WHERE user_id = ? AND status IN ('pending_payment', 'scheduled')", []interface{}{userID}},
+		{"DELETE FROM login_attempts WHERE user_id = ? OR identifier IN (?, ?)", []interface{}{userID, email.String, phone.String}},
+		{"DELETE FROM otp_codes WHERE phone = ?", []interface{}{phone.String}},
+		{"UPDATE security_events SET ip_address = NULL WHERE user_id = ?", []interface{}{userID}},
+		{`UPDATE users
+          SET email = NULL, phone = NULL, phone_verified = FALSE, name = ?, password = '', is_verified = FALSE,
+              mfa_enabled = FALSE, mfa_secret = NULL, mfa_last_step = NULL, mfa_required = FALSE,
+              locked_until = NULL, membership_billing_anchor = NULL, membership_paid_until = NULL,
+              deleted_at = NOW()
+          WHERE id = ?`, []interface{}{DeletedUserName, userID}},
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt.query, stmt.args...); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,111 @@
+package database
+
+import (
+	"cnad_assignment/user-service/models"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrAPIKeyLimitReached is returned when the user already holds the maximum number of active API keys.
+var ErrAPIKeyLimitReached = errors.New("API key limit reached")
+
+// ErrAPIKeyNotFound is returned when the user has no active API key with the ID.
+var ErrAPIKeyNotFound = errors.New("API key not found")
+
+// CreateAPIKey stores a new API key of the user by its hash, unless the user already has
+// maxKeys active keys. It returns the ID of the key.
+func CreateAPIKey(userID int, name, prefix, keyHash string, scopes []string, expiresAt time.Time, maxKeys int) (int, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	// Lock the user so concurrent requests cannot both slip under the limit
+	var lockedID int
+	if err := tx.QueryRow("SELECT id FROM users WHERE id = ? FOR UPDATE", userID).Scan(&lockedID); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	var active int
+	query := "SELECT COUNT(*) FROM api_keys WHERE user_id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())"
+	if err := tx.QueryRow(query, userID).Scan(&active); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	if active >= maxKeys {
+		tx.Rollback()
+		return 0, ErrAPIKeyLimitReached
+	}
+
+	insertQuery := "INSERT INTO api_keys (user_id, name, key_prefix, key_hash, scopes, expires_at) VALUES (?, ?, ?, ?, ?, ?)"
+	result, err := tx.Exec(insertQuery, userID, name, prefix, keyHash, strings.Join(scopes, ","), expiresAt)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	keyID, err := result.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	return int(keyID), tx.Commit()
+}
+
+// FetchAPIKeys returns every API key of the user, newest first
+func FetchAPIKeys(userID int) ([]models.APIKey, error) {
+	query := `
+        SELECT id, name, key_prefix, scopes, expires_at, last_used_at, created_at, revoked_at
+        FROM api_keys
+        WHERE user_id = ?
+        ORDER BY created_at DESC, id DESC
+    `
+	rows, err := DB.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		var key models.APIKey
+		var scopes string
+		var expiresAt, lastUsedAt, revokedAt sql.NullTime
+		err := rows.Scan(&key.ID, &key.Name, &key.Prefix, &scopes, &expiresAt, &lastUsedAt, &key.CreatedAt, &revokedAt)
+		if err != nil {
+			return nil, err
+		}
+		key.Scopes = []string{}
+		if scopes != "" {
+			key.Scopes = strings.Split(scopes, ",")
+		}
+		if expiresAt.Valid {
+			key.ExpiresAt = &expiresAt.Time
+		}
+		if lastUsedAt.Valid {
+			key.LastUsedAt = &lastUsedAt.Time
+		}
+		if revokedAt.Valid {
+			key.RevokedAt = &revokedAt.Time
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// RevokeAPIKey stops one of the user's API keys from working
+func RevokeAPIKey(userID, keyID int) error {
+	result, err := DB.Exec("UPDATE api_keys SET revoked_at = NOW() WHERE id = ? AND user_id = ? AND revoked_at IS NULL", keyID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err == nil && rowsAffected == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return err
+}
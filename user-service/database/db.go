@@ -2,9 +2,10 @@ package database
 
 import (
 	"database/sql"
+	"errors"
 	"log"
 
-	_ "github.com/go-sql-driver/mysql" // Import MySQL driver to establish database connection
+	"github.com/go-sql-driver/mysql" // MySQL driver, also used to inspect MySQL error codes
 )
 
 // DB is a global variable that holds the database connection pool.
@@ -21,7 +22,7 @@ func InitDB() {
 	// The connection string format is "username:password@tcp(host:port)/database_name".
 	// Replace "user:password" with actual credentials, "127.0.0.1:3306" with the MySQL server's address and port,
 	// and "car_sharing" with the actual database name.
-	DB, err = sql.Open("mysql", "user:password@tcp(127.0.0.1:3306)/car_sharing")
+	DB, err = sql.Open("mysql", "user:password@tcp(127.0.0.1:3306)/car_sharing?parseTime=true&loc=Local")
 	if err != nil {
 		// If an error occurs while opening the connection, log the error and terminate the application.
 		log.Fatalf("Failed to connect to the database: %v", err)
@@ -37,3 +38,12 @@ func InitDB() {
 	// If the connection is successful, log a message indicating that the database has been connected.
 	log.Println("Database connected successfully")
 }
+
+// mysqlDuplicateEntry is the MySQL error number for a unique key violation
+const mysqlDuplicateEntry = 1062
+
+// IsDuplicateEntry reports whether err is a unique key violation, e.g. an email that is already registered
+func IsDuplicateEntry(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlDuplicateEntry
+}
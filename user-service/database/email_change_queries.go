@@ -0,0 +1,102 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrEmailChangeInvalid is returned when an email change token is unknown, expired or already used.
+var ErrEmailChangeInvalid = errors.New("invalid or expired confirmation link")
+
+// ErrEmailTaken is returned when the requested address already belongs to another account.
+var ErrEmailTaken = errors.New("email already registered")
+
+// EmailInUse reports whether any account is registered with the email address
+func EmailInUse(email string) (bool, error) {
+	var exists bool
+	err := DB.QueryRow("SELECT EXISTS (SELECT 1 FROM users WHERE email = ?)", email).Scan(&exists)
+	return exists, err
+}
+
+// CreateEmailChangeRequest stores a pending change to newEmail, replacing any earlier pending change
+func CreateEmailChangeRequest(userID int, newEmail, tokenHash string, expiresAt time.Time) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE email_change_requests SET used_at = NOW() WHERE user_id = ? AND used_at IS NULL", userID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	query := "INSERT INTO email_change_requests (user_id, new_email, token_hash, expires_at) VALUES (?, ?, ?, ?)"
+	if _, err := tx.Exec(query, userID, newEmail, tokenHash, expiresAt); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// EmailChange describes a confirmed email address change
+type EmailChange struct {
+	UserID   int
+	OldEmail string // Empty for accounts that registered with a phone number
+	NewEmail string
+}
+
+// ConfirmEmailChange consumes the token and swaps the user's email for the confirmed one.
+// ErrEmailTaken is returned when another account claimed the address in the meantime.
+func ConfirmEmailChange(tokenHash string) (EmailChange, error) {
+	var change EmailChange
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return change, err
+	}
+
+	var expiresAt time.Time
+	var usedAt sql.NullTime
+	query := "SELECT user_id, new_email, expires_at, used_at FROM email_change_requests WHERE token_hash = ? FOR UPDATE"
+	err = tx.QueryRow(query, tokenHash).Scan(&change.UserID, &change.NewEmail, &expiresAt, &usedAt)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		return change, ErrEmailChangeInvalid
+	}
+	if err != nil {
+		tx.Rollback()
+		return change, err
+	}
+
+	if usedAt.Valid || time.Now().After(expiresAt) {
+		tx.Rollback()
+		return change, ErrEmailChangeInvalid
+	}
+
+	if err := tx.QueryRow("SELECT COALESCE(email, '') FROM users WHERE id = ? FOR UPDATE", change.UserID).Scan(&change.OldEmail); err != nil {
+		tx.Rollback()
+		return change, err
+	}
+
+	// The unique index on users.email settles races with registrations and other changes
+	if _, err := tx.Exec("UPDATE users SET email = ? WHERE id = ?", change.NewEmail, change.UserID); err != nil {
+		tx.Rollback()
+		if IsDuplicateEntry(err) {
+			return change, ErrEmailTaken
+		}
+		return change, err
+	}
+
+	if _, err := tx.Exec("UPDATE email_change_requests SET used_at = NOW() WHERE user_id = ? AND used_at IS NULL", change.UserID); err != nil {
+		tx.Rollback()
+		return change, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return change, err
+	}
+	return change, nil
+}
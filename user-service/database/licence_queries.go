@@ -0,0 +1,105 @@
+package database
+
+import (
+	"cnad_assignment/user-service/models"
+	"database/sql"
+	"errors"
+)
+
+// ErrLicenceNotFound is returned when the user has not submitted a licence.
+var ErrLicenceNotFound = errors.New("licence not found")
+
+const licenceColumns = `user_id, licence_number, issuing_country, expiry_date, date_of_birth, document_ref,
+        status, COALESCE(rejection_reason, ''), submitted_at, reviewed_at`
+
+// scanLicence reads a row selected with licenceColumns
+func scanLicence(row interface{ Scan(...interface{}) error }) (models.DriverLicence, error) {
+	var licence models.DriverLicence
+	var reviewedAt sql.NullTime
+	err := row.Scan(&licence.UserID, &licence.LicenceNumber, &licence.IssuingCountry, &licence.ExpiryDate, &licence.DateOfBirth,
+		&licence.DocumentRef, &licence.Status, &licence.RejectionReason, &licence.SubmittedAt, &reviewedAt)
+	if reviewedAt.Valid {
+		licence.ReviewedAt = &reviewedAt.Time
+	}
+	return licence, err
+}
+
+// FetchLicence returns the licence the user submitted
+func FetchLicence(userID int) (models.DriverLicence, error) {
+	licence, err := scanLicence(DB.QueryRow("SELECT "+licenceColumns+" FROM driver_licences WHERE user_id = ?", userID))
+	if err == sql.ErrNoRows {
+		return licence, ErrLicenceNotFound
+	}
+	return licence, err
+}
+
+// SubmitLicence stores the user's licence for review, replacing any earlier submission.
+// It returns the document reference of the replaced submission, if any, so its file can be removed.
+func SubmitLicence(licence models.DriverLicence) (string, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return "", err
+	}
+
+	var previousDocument string
+	err = tx.QueryRow("SELECT document_ref FROM driver_licences WHERE user_id = ? FOR UPDATE", licence.UserID).Scan(&previousDocument)
+	if err != nil && err != sql.ErrNoRows {
+		tx.Rollback()
+		return "", err
+	}
+
+	query := `
+        INSERT INTO driver_licences (user_id, licence_number, issuing_country, expiry_date, date_of_birth, document_ref, status)
+        VALUES (?, ?, ?, ?, ?, ?, 'pending')
+        ON DUPLICATE KEY UPDATE
+            licence_number = VALUES(licence_number), issuing_country = VALUES(issuing_country),
+            expiry_date = VALUES(expiry_date), date_of_birth = VALUES(date_of_birth), document_ref = VALUES(document_ref),
+            status = 'pending', rejection_reason = NULL, submitted_at = NOW(), reviewed_at = NULL, reviewed_by = NULL
+    `
+	_, err = tx.Exec(query, licence.UserID, licence.LicenceNumber, licence.IssuingCountry, licence.ExpiryDate,
+		licence.DateOfBirth, licence.DocumentRef)
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
+	return previousDocument, tx.Commit()
+}
+
+// FetchLicencesByStatus returns the licences in a review state, oldest submission first
+func FetchLicencesByStatus(status string) ([]models.DriverLicence, error) {
+	rows, err := DB.Query("SELECT "+licenceColumns+" FROM driver_licences WHERE status = ? ORDER BY submitted_at", status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	licences := []models.DriverLicence{}
+	for rows.Next() {
+		licence, err := scanLicence(rows)
+		if err != nil {
+			return nil, err
+		}
+		licences = append(licences, licence)
+	}
+	return licences, rows.Err()
+}
+
+// ReviewLicence approves or rejects a pending licence
+func ReviewLicence(userID int, status, reason string, reviewerID int) error {
+	query := `
+        UPDATE driver_licences
+        SET status = ?, rejection_reason = NULLIF(?, ''), reviewed_at = NOW(), reviewed_by = ?
+        WHERE user_id = ? AND status = 'pending'
+    `
+	result, err := DB.Exec(query, status, reason, reviewerID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err == nil && rowsAffected == 0 {
+		return ErrLicenceNotFound
+	}
+	return err
+}
@@ -0,0 +1,155 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrUnlockTokenInvalid is returned when an unlock token is unknown, expired or already used.
+var ErrUnlockTokenInvalid = errors.New("invalid or expired unlock link")
+
+// LoginThrottle summarises recent failed logins for an identifier and an IP address
+type LoginThrottle struct {
+	IdentifierFailures int        // Uncleared failures for the email or phone within the window
+	LastFailureAt      *time.Time // Most recent of those failures
+	IPFailures         int        // Failures from the IP address across all identifiers within the window
+}
+
+// GetLoginThrottle counts failed logins since windowStart for the identifier and the IP address
+func GetLoginThrottle(identifier, ipAddress string, windowStart time.Time) (LoginThrottle, error) {
+	var throttle LoginThrottle
+	var lastFailureAt sql.NullTime
+
+	query := `
+        SELECT COUNT(*), MAX(created_at)
+        FROM login_attempts
+        WHERE identifier = ? AND succeeded = FALSE AND cleared = FALSE AND created_at > ?
+    `
+	if err := DB.QueryRow(query, identifier, windowStart).Scan(&throttle.IdentifierFailures, &lastFailureAt); err != nil {
+		return throttle, err
+	}
+	if lastFailureAt.Valid {
+		throttle.LastFailureAt = &lastFailureAt.Time
+	}
+
+	query = "SELECT COUNT(*) FROM login_attempts WHERE ip_address = ? AND succeeded = FALSE AND created_at > ?"
+	err := DB.QueryRow(query, ipAddress, windowStart).Scan(&throttle.IPFailures)
+	return throttle, err
+}
+
+// CountLoginFailures counts the uncleared failed logins for the identifier since the given time
+func CountLoginFailures(identifier string, since time.Time) (int, error) {
+	var failures int
+	query := "SELECT COUNT(*) FROM login_attempts WHERE identifier = ? AND succeeded = FALSE AND cleared = FALSE AND created_at >= ?"
+	err := DB.QueryRow(query, identifier, since).Scan(&failures)
+	return failures, err
+}
+
+// RecordLoginFailure stores a failed login. userID is 0 when no account matched.
+func RecordLoginFailure(identifier, ipAddress string, userID int) error {
+	query := "INSERT INTO login_attempts (identifier, user_id, ip_address, succeeded) VALUES (?, NULLIF(?, 0), ?, FALSE)"
+	_, err := DB.Exec(query, identifier, userID, ipAddress)
+	return err
+}
+
+// RecordLoginSuccess stores a successful login and resets the identifier's failure count
+func RecordLoginSuccess(identifier, ipAddress string, userID int) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("UPDATE login_attempts SET cleared = TRUE WHERE identifier = ? AND cleared = FALSE", identifier); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	query := "INSERT INTO login_attempts (identifier, user_id, ip_address, succeeded, cleared) VALUES (?, ?, ?, TRUE, TRUE)"
+	if _, err := tx.Exec(query, identifier, userID, ipAddress); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// LockAccount locks the user's account until lockedUntil. It reports false when the
+// account was already locked, so only one replica emails the user and records the event.
+func LockAccount(userID int, lockedUntil time.Time) (bool, error) {
+	query := "UPDATE users SET locked_until = ? WHERE id = ? AND (locked_until IS NULL OR locked_until <= NOW())"
+	result, err := DB.Exec(query, lockedUntil, userID)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	return rowsAffected > 0, err
+}
+
+// CreateUnlockToken stores a token for the emailed unlock link, invalidating earlier ones
+func CreateUnlockToken(userID int, tokenHash string, expiresAt time.Time) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE account_unlock_tokens SET used_at = NOW() WHERE user_id = ? AND used_at IS NULL", userID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO account_unlock_tokens (user_id, token_hash, expires_at) VALUES (?, ?, ?)", userID, tokenHash, expiresAt)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UnlockAccount consumes the unlock token, lifts the lockout and clears the failed logins
+// that caused it. It returns the user's ID.
+func UnlockAccount(tokenHash string) (int, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	var userID int
+	var expiresAt time.Time
+	var usedAt sql.NullTime
+	query := "SELECT user_id, expires_at, used_at FROM account_unlock_tokens WHERE token_hash = ? FOR UPDATE"
+	err = tx.QueryRow(query, tokenHash).Scan(&userID, &expiresAt, &usedAt)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		return 0, ErrUnlockTokenInvalid
+	}
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if usedAt.Valid || time.Now().After(expiresAt) {
+		tx.Rollback()
+		return 0, ErrUnlockTokenInvalid
+	}
+
+	statements := []string{
+		"UPDATE account_unlock_tokens SET used_at = NOW() WHERE user_id = ? AND used_at IS NULL",
+		"UPDATE users SET locked_until = NULL WHERE id = ?",
+		"UPDATE login_attempts SET cleared = TRUE WHERE user_id = ? AND cleared = FALSE",
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt, userID); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
@@ -0,0 +1,90 @@
+package database
+
+import (
+	"cnad_assignment/user-service/models"
+	"database/sql"
+)
+
+// FetchPointsBalance returns the user's loyalty points balance
+func FetchPointsBalance(userID int) (int, error) {
+	var balance int
+	err := DB.QueryRow("SELECT COALESCE(SUM(points), 0) FROM loyalty_points_ledger WHERE user_id = ?", userID).Scan(&balance)
+	return balance, err
+}
+
+// FetchPointsLedger returns the user's loyalty points entries, newest first
+func FetchPointsLedger(userID int) ([]models.PointsEntry, error) {
+	query := `
+        SELECT id, points, entry_type, booking_id, payment_id, COALESCE(description, ''), created_at
+        FROM loyalty_points_ledger
+        WHERE user_id = ?
+        ORDER BY created_at DESC, id DESC
+    `
+	rows, err := DB.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.PointsEntry{}
+	for rows.Next() {
+		var entry models.PointsEntry
+		var bookingID, paymentID sql.NullInt64
+		err := rows.Scan(&entry.ID, &entry.Points, &entry.EntryType, &bookingID, &paymentID, &entry.Description, &entry.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		entry.BookingID = int(bookingID.Int64)
+		entry.PaymentID = int(paymentID.Int64)
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// AwardPointsForCompletedRentals credits points for every completed rental whose payment
+// has been recorded and has not earned points yet. Points are the amount paid times
+// pointsPerDollar times the member's tier multiplier; refunded payments earn nothing.
+// It returns how many payments earned points.
+func AwardPointsForCompletedRentals(pointsPerDollar float64) (int, error) {
+	query := `
+        INSERT INTO loyalty_points_ledger (user_id, points, entry_type, booking_id, payment_id, description)
+        SELECT b.user_id, FLOOR(p.amount * ? * mt.points_multiplier), 'earn', b.id, p.id, CONCAT('Completed rental #', b.id)
+        FROM bookings b
+        JOIN payments p ON p.booking_id = b.id AND p.payment_status = 'completed'
+        JOIN users u ON u.id = b.user_id
+        JOIN membership_tiers mt ON mt.id = u.membership_tier_id
+        WHERE b.status = 'completed'
+          AND u.deleted_at IS NULL
+          AND FLOOR(p.amount * ? * mt.points_multiplier) > 0
+          AND NOT EXISTS (SELECT 1 FROM refunds r WHERE r.payment_id = p.id AND r.refund_status = 'completed')
+          AND NOT EXISTS (SELECT 1 FROM loyalty_points_ledger l WHERE l.payment_id = p.id AND l.entry_type = 'earn')
+    `
+	result, err := DB.Exec(query, pointsPerDollar, pointsPerDollar)
+	if err != nil {
+		return 0, err
+	}
+
+	awarded, err := result.RowsAffected()
+	return int(awarded), err
+}
+
+// ReversePointsForRefundedPayments takes back the points earned by payments that have since
+// been refunded, in full or in part, by adding a reversal entry for each. It returns how many
+// payments had their points reversed.
+func ReversePointsForRefundedPayments() (int, error) {
+	query := `
+        INSERT INTO loyalty_points_ledger (user_id, points, entry_type, booking_id, payment_id, description)
+        SELECT e.user_id, -e.points, 'reversal', e.booking_id, e.payment_id, CONCAT('Refunded rental #', e.booking_id)
+        FROM loyalty_points_ledger e
+        WHERE e.entry_type = 'earn'
+          AND EXISTS (SELECT 1 FROM refunds r WHERE r.payment_id = e.payment_id AND r.refund_status = 'completed')
+          AND NOT EXISTS (SELECT 1 FROM loyalty_points_ledger l WHERE l.payment_id = e.payment_id AND l.entry_type = 'reversal')
+    `
+	result, err := DB.Exec(query)
+	if err != nil {
+		return 0, err
+	}
+
+	reversed, err := result.RowsAffected()
+	return int(reversed), err
+}
@@ -0,0 +1,379 @@
+package database
+
+import (
+	"cnad_assignment/user-service/models"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrTierNotFound is returned when no membership tier has the requested name.
+var ErrTierNotFound = errors.New("membership tier not found")
+
+// ErrMembershipChangeNotFound is returned when the user has no pending or scheduled tier change.
+var ErrMembershipChangeNotFound = errors.New("no pending membership change")
+
+// openTierChange matches the upgrades and downgrades a user can still withdraw or replace.
+// Unpaid renewals are not among them; they end by being paid or by the membership lapsing.
+const openTierChange = "change_type IN ('upgrade', 'downgrade') AND status IN ('pending_payment', 'scheduled')"
+
+const tierColumns = "id, name, tier_rank, monthly_fee, hourly_rate_discount, priority_access, booking_limit"
+
+// scanTier reads a row selected with tierColumns
+func scanTier(row interface{ Scan(...interface{}) error }) (models.MembershipTier, error) {
+	var tier models.MembershipTier
+	err := row.Scan(&tier.ID, &tier.Name, &tier.Rank, &tier.MonthlyFee, &tier.HourlyRateDiscount, &tier.PriorityAccess, &tier.BookingLimit)
+	return tier, err
+}
+
+// FetchTierByName returns the membership tier with the given name
+func FetchTierByName(name string) (models.MembershipTier, error) {
+	tier, err := scanTier(DB.QueryRow("SELECT "+tierColumns+" FROM membership_tiers WHERE name = ?", name))
+	if err == sql.ErrNoRows {
+		return tier, ErrTierNotFound
+	}
+	return tier, err
+}
+
+// FetchUserMembership returns the user's current tier, the start of their first paid billing
+// period and the end of the last period they paid for. Both times are nil on a free tier.
+func FetchUserMembership(userID int) (models.MembershipTier, *time.Time, *time.Time, error) {
+	var anchor, paidUntil sql.NullTime
+	query := `
+        SELECT mt.id, mt.name, mt.tier_rank, mt.monthly_fee, mt.hourly_rate_discount, mt.priority_access, mt.booking_limit,
+               u.membership_billing_anchor, u.membership_paid_until
+        FROM users u
+        JOIN membership_tiers mt ON mt.id = u.membership_tier_id
+        WHERE u.id = ?
+    `
+	var tier models.MembershipTier
+	err := DB.QueryRow(query, userID).Scan(&tier.ID, &tier.Name, &tier.Rank, &tier.MonthlyFee, &tier.HourlyRateDiscount,
+		&tier.PriorityAccess, &tier.BookingLimit, &anchor, &paidUntil)
+	if err != nil || !anchor.Valid || !paidUntil.Valid {
+		return tier, nil, nil, err
+	}
+	return tier, &anchor.Time, &paidUntil.Time, nil
+}
+
+// CreateMembershipChange records a requested tier change, replacing any change the user
+// still had pending or scheduled. It returns the ID of the new change.
+func CreateMembershipChange(userID, fromTierID, toTierID int, changeType, status string, amount float64, effectiveAt *time.Time) (int, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	// Lock the user so concurrent requests cannot both leave an open change behind
+	var lockedID int
+	if err := tx.QueryRow("SELECT id FROM users WHERE id = ? FOR UPDATE", userID).Scan(&lockedID); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	cancelQuery := "UPDATE membership_changes SET status = 'canceled' WHERE user_id = ? AND " + openTierChange
+	if _, err := tx.Exec(cancelQuery, userID); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	insertQuery := `
+        INSERT INTO membership_changes (user_id, from_tier_id, to_tier_id, change_type, status, amount, effective_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?)
+    `
+	result, err := tx.Exec(insertQuery, userID, fromTierID, toTierID, changeType, status, amount, effectiveAt)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	changeID, err := result.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	return int(changeID), tx.Commit()
+}
+
+// CancelMembershipChange withdraws the user's pending upgrade or scheduled downgrade
+func CancelMembershipChange(userID int) error {
+	query := "UPDATE membership_changes SET status = 'canceled' WHERE user_id = ? AND " + openTierChange
+	result, err := DB.Exec(query, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err == nil && rowsAffected == 0 {
+		return ErrMembershipChangeNotFound
+	}
+	return err
+}
+
+// FetchMembershipChanges returns the user's tier change history, newest first
+func FetchMembershipChanges(userID int) ([]models.MembershipChange, error) {
+	query := `
+        SELECT mc.id, ft.name, tt.name, mc.change_type, mc.status, mc.amount, mc.effective_at, mc.period_end,
+               mc.created_at, mc.applied_at
+        FROM membership_changes mc
+        JOIN membership_tiers ft ON ft.id = mc.from_tier_id
+        JOIN membership_tiers tt ON tt.id = mc.to_tier_id
+        WHERE mc.user_id = ?
+        ORDER BY mc.created_at DESC, mc.id DESC
+    `
+	rows, err := DB.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []models.MembershipChange{}
+	for rows.Next() {
+		var change models.MembershipChange
+		var effectiveAt, periodEnd, appliedAt sql.NullTime
+		err := rows.Scan(&change.ID, &change.FromTier, &change.ToTier, &change.ChangeType, &change.Status, &change.Amount,
+			&effectiveAt, &periodEnd, &change.CreatedAt, &appliedAt)
+		if err != nil {
+			return nil, err
+		}
+		if effectiveAt.Valid {
+			change.EffectiveAt = &effectiveAt.Time
+		}
+		if periodEnd.Valid {
+			change.PeriodEnd = &periodEnd.Time
+		}
+		if appliedAt.Valid {
+			change.AppliedAt = &appliedAt.Time
+		}
+		changes = append(changes, change)
+	}
+	return changes, rows.Err()
+}
+
+// ApplyDueMembershipChanges moves users whose scheduled downgrade is due to their new tier and
+// withdraws any renewal they had not paid for the old one. A user dropping to a free tier stops
+// being billed. It returns how many changes were applied.
+func ApplyDueMembershipChanges(now time.Time) (int, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	query := `
+        SELECT mc.id, mc.user_id, mc.to_tier_id, tt.monthly_fee
+        FROM membership_changes mc
+        JOIN membership_tiers tt ON tt.id = mc.to_tier_id
+        WHERE mc.status = 'scheduled' AND mc.effective_at <= ?
+        FOR UPDATE
+    `
+	rows, err := tx.Query(query, now)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	type dueChange struct {
+		id, userID, toTierID int
+		monthlyFee           float64
+	}
+	var due []dueChange
+	for rows.Next() {
+		var change dueChange
+		if err := rows.Scan(&change.id, &change.userID, &change.toTierID, &change.monthlyFee); err != nil {
+			rows.Close()
+			tx.Rollback()
+			return 0, err
+		}
+		due = append(due, change)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	for _, change := range due {
+		userQuery := `
+            UPDATE users
+            SET membership_tier_id = ?,
+                membership_billing_anchor = IF(? > 0, membership_billing_anchor, NULL),
+                membership_paid_until = IF(? > 0, membership_paid_until, NULL)
+            WHERE id = ?
+        `
+		statements := []struct {
+			query string
+			args  []interface{}
+		}{
+			{userQuery, []interface{}{change.toTierID, change.monthlyFee, change.monthlyFee, change.userID}},
+			{"UPDATE membership_changes SET status = 'applied', applied_at = ? WHERE id = ?", []interface{}{now, change.id}},
+			{"UPDATE membership_changes SET status = 'canceled' WHERE user_id = ? AND change_type = 'renewal' AND status = 'pending_payment'",
+				[]interface{}{change.userID}},
+		}
+		for _, stmt := range statements {
+			if _, err := tx.Exec(stmt.query, stmt.args...); err != nil {
+				tx.Rollback()
+				return 0, err
+			}
+		}
+	}
+
+	return len(due), tx.Commit()
+}
+
+// DueRenewal is a paid membership whose last paid period has ended
+type DueRenewal struct {
+	UserID    int
+	TierID    int
+	Anchor    time.Time
+	PaidUntil time.Time
+}
+
+// FetchDueRenewals returns the paid memberships whose paid period ended by now and which
+// have no renewal waiting for payment yet
+func FetchDueRenewals(now time.Time) ([]DueRenewal, error) {
+	query := `
+        SELECT u.id, u.membership_tier_id, u.membership_billing_anchor, u.membership_paid_until
+        FROM users u
+        JOIN membership_tiers mt ON mt.id = u.membership_tier_id
+        WHERE mt.monthly_fee > 0 AND u.deleted_at IS NULL
+          AND u.membership_billing_anchor IS NOT NULL AND u.membership_paid_until <= ?
+          AND NOT EXISTS (
+              SELECT 1 FROM membership_changes mc
+              WHERE mc.user_id = u.id AND mc.change_type = 'renewal' AND mc.status = 'pending_payment'
+          )
+    `
+	rows, err := DB.Query(query, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var due []DueRenewal
+	for rows.Next() {
+		var renewal DueRenewal
+		if err := rows.Scan(&renewal.UserID, &renewal.TierID, &renewal.Anchor, &renewal.PaidUntil); err != nil {
+			return nil, err
+		}
+		due = append(due, renewal)
+	}
+	return due, rows.Err()
+}
+
+// CreateMembershipRenewal asks the member to pay the monthly fee of their tier for the period
+// ending at periodEnd. It returns false without creating anything when the membership changed
+// since it was found due or a renewal is already waiting for payment.
+func CreateMembershipRenewal(renewal DueRenewal, periodEnd time.Time) (bool, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return false, err
+	}
+
+	var tierID int
+	var paidUntil sql.NullTime
+	var monthlyFee float64
+	lockQuery := `
+        SELECT u.membership_tier_id, u.membership_paid_until, mt.monthly_fee
+        FROM users u
+        JOIN membership_tiers mt ON mt.id = u.membership_tier_id
+        WHERE u.id = ?
+        FOR UPDATE
+    `
+	if err := tx.QueryRow(lockQuery, renewal.UserID).Scan(&tierID, &paidUntil, &monthlyFee); err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	if tierID != renewal.TierID || !paidUntil.Valid || !paidUntil.Time.Equal(renewal.PaidUntil) {
+		tx.Rollback()
+		return false, nil
+	}
+
+	var pending bool
+	pendingQuery := "SELECT EXISTS(SELECT 1 FROM membership_changes WHERE user_id = ? AND change_type = 'renewal' AND status = 'pending_payment')"
+	if err := tx.QueryRow(pendingQuery, renewal.UserID).Scan(&pending); err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	if pending {
+		tx.Rollback()
+		return false, nil
+	}
+
+	insertQuery := `
+        INSERT INTO membership_changes (user_id, from_tier_id, to_tier_id, change_type, status, amount, effective_at, period_end)
+        VALUES (?, ?, ?, 'renewal', 'pending_payment', ?, ?, ?)
+    `
+	if _, err := tx.Exec(insertQuery, renewal.UserID, tierID, tierID, monthlyFee, renewal.PaidUntil, periodEnd); err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// LapseUnpaidMemberships moves members whose renewal fell due before cutoff and is still
+// unpaid to the free tier. Their other open changes are withdrawn and the drop is recorded
+// as an applied downgrade. It returns how many memberships lapsed.
+func LapseUnpaidMemberships(cutoff, now time.Time) (int, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	var freeTierID int
+	if err := tx.QueryRow("SELECT id FROM membership_tiers WHERE monthly_fee = 0 ORDER BY tier_rank LIMIT 1").Scan(&freeTierID); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	query := `
+        SELECT mc.id, mc.user_id, u.membership_tier_id
+        FROM membership_changes mc
+        JOIN users u ON u.id = mc.user_id
+        WHERE mc.change_type = 'renewal' AND mc.status = 'pending_payment' AND mc.effective_at <= ?
+        FOR UPDATE
+    `
+	rows, err := tx.Query(query, cutoff)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	type unpaidRenewal struct {
+		id, userID, tierID int
+	}
+	var unpaid []unpaidRenewal
+	for rows.Next() {
+		var renewal unpaidRenewal
+		if err := rows.Scan(&renewal.id, &renewal.userID, &renewal.tierID); err != nil {
+			rows.Close()
+			tx.Rollback()
+			return 0, err
+		}
+		unpaid = append(unpaid, renewal)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	for _, renewal := range unpaid {
+		statements := []struct {
+			query string
+			args  []interface{}
+		}{
+			{"UPDATE membership_changes SET status = 'canceled' WHERE user_id = ? AND status IN ('pending_payment', 'scheduled')",
+				[]interface{}{renewal.userID}},
+			{`INSERT INTO membership_changes (user_id, from_tier_id, to_tier_id, change_type, status, effective_at, applied_at)
+              VALUES (?, ?, ?, 'downgrade', 'applied', ?, ?)`, []interface{}{renewal.userID, renewal.tierID, freeTierID, now, now}},
+			{"UPDATE users SET membership_tier_id = ?, membership_billing_anchor = NULL, membership_paid_until = NULL WHERE id = ?",
+				[]interface{}{freeTierID, renewal.userID}},
+		}
+		for _, stmt := range statements {
+			if _, err := tx.Exec(stmt.query, stmt.args...); err != nil {
+				tx.Rollback()
+				return 0, err
+			}
+		}
+	}
+
+	return len(unpaid), tx.Commit()
+}
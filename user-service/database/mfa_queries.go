@@ -0,0 +1,145 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// MFAState is the second-factor configuration of a user
+type MFAState struct {
+	Email       string // Email, or phone for phone-only accounts; used as the authenticator label
+	Name        string
+	Secret      string
+	Enabled     bool
+	Required    bool
+	Suspended   bool
+	LockedUntil *time.Time // Set while the account is locked after too many failed logins
+	UnlockEmail string     // Where the unlock link is sent; empty for phone-only accounts
+}
+
+// GetMFAState loads the MFA configuration of the user
+func GetMFAState(userID int) (MFAState, error) {
+	var state MFAState
+	var secret sql.NullString
+	var lockedUntil sql.NullTime
+	query := `
+        SELECT COALESCE(email, phone), name, mfa_secret, mfa_enabled, mfa_required, suspended_at IS NOT NULL,
+               locked_until, COALESCE(email, '')
+        FROM users WHERE id = ?
+    `
+	err := DB.QueryRow(query, userID).Scan(&state.Email, &state.Name, &secret, &state.Enabled, &state.Required, &state.Suspended,
+		&lockedUntil, &state.UnlockEmail)
+	state.Secret = secret.String
+	if lockedUntil.Valid && time.Now().Before(lockedUntil.Time) {
+		state.LockedUntil = &lockedUntil.Time
+	}
+	return state, err
+}
+
+// SetPendingMFASecret stores a freshly generated secret that becomes active once confirmed
+func SetPendingMFASecret(userID int, secret string) error {
+	_, err := DB.Exec("UPDATE users SET mfa_secret = ?, mfa_last_step = NULL WHERE id = ? AND mfa_enabled = FALSE", secret, userID)
+	return err
+}
+
+// EnableMFA turns MFA on, records the confirming time step and replaces the recovery codes
+func EnableMFA(userID int, step int64, recoveryCodeHashes []string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE users SET mfa_enabled = TRUE, mfa_last_step = ? WHERE id = ?", step, userID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := replaceRecoveryCodes(tx, userID, recoveryCodeHashes); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DisableMFA removes the secret and recovery codes of the user
+func DisableMFA(userID int) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE users SET mfa_enabled = FALSE, mfa_secret = NULL, mfa_last_step = NULL WHERE id = ?", userID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM mfa_recovery_codes WHERE user_id = ?", userID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ConsumeTOTPStep records step as used. It returns false if the same or a later step
+// was already accepted, which means the code is being replayed.
+func ConsumeTOTPStep(userID int, step int64) (bool, error) {
+	query := "UPDATE users SET mfa_last_step = ? WHERE id = ? AND (mfa_last_step IS NULL OR mfa_last_step < ?)"
+	result, err := DB.Exec(query, step, userID, step)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	return rowsAffected == 1, err
+}
+
+// ConsumeRecoveryCode marks an unused recovery code as used and reports whether it was valid
+func ConsumeRecoveryCode(userID int, codeHash string) (bool, error) {
+	query := "UPDATE mfa_recovery_codes SET used_at = NOW() WHERE user_id = ? AND code_hash = ? AND used_at IS NULL LIMIT 1"
+	result, err := DB.Exec(query, userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	return rowsAffected == 1, err
+}
+
+// ReplaceRecoveryCodes discards all recovery codes of the user and stores new ones
+func ReplaceRecoveryCodes(userID int, codeHashes []string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := replaceRecoveryCodes(tx, userID, codeHashes); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func replaceRecoveryCodes(tx *sql.Tx, userID int, codeHashes []string) error {
+	if _, err := tx.Exec("DELETE FROM mfa_recovery_codes WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+
+	for _, hash := range codeHashes {
+		if _, err := tx.Exec("INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES (?, ?)", userID, hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CountUnusedRecoveryCodes returns how many recovery codes the user has left
+func CountUnusedRecoveryCodes(userID int) (int, error) {
+	var count int
+	err := DB.QueryRow("SELECT COUNT(*) FROM mfa_recovery_codes WHERE user_id = ? AND used_at IS NULL", userID).Scan(&count)
+	return count, err
+}
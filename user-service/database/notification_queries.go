@@ -0,0 +1,39 @@
+package database
+
+import (
+	"cnad_assignment/user-service/models"
+	"database/sql"
+)
+
+// FetchNotificationPreferences returns the user's notification channels. Users who never
+// saved preferences are notified by email only.
+func FetchNotificationPreferences(userID int) (models.NotificationPreferences, error) {
+	preferences := models.NotificationPreferences{Email: true}
+	var updatedAt sql.NullTime
+	query := `
+        SELECT email_enabled, sms_enabled, push_enabled, COALESCE(push_webhook_url, ''), updated_at
+        FROM notification_preferences
+        WHERE user_id = ?
+    `
+	err := DB.QueryRow(query, userID).Scan(&preferences.Email, &preferences.SMS, &preferences.Push, &preferences.PushWebhookURL, &updatedAt)
+	if err == sql.ErrNoRows {
+		return preferences, nil
+	}
+	if updatedAt.Valid {
+		preferences.UpdatedAt = &updatedAt.Time
+	}
+	return preferences, err
+}
+
+// SaveNotificationPreferences replaces the user's notification channels
+func SaveNotificationPreferences(userID int, preferences models.NotificationPreferences) error {
+	query := `
+        INSERT INTO notification_preferences (user_id, email_enabled, sms_enabled, push_enabled, push_webhook_url)
+        VALUES (?, ?, ?, ?, NULLIF(?, ''))
+        ON DUPLICATE KEY UPDATE
+            email_enabled = VALUES(email_enabled), sms_enabled = VALUES(sms_enabled),
+            push_enabled = VALUES(push_enabled), push_webhook_url = VALUES(push_webhook_url)
+    `
+	_, err := DB.Exec(query, userID, preferences.Email, preferences.SMS, preferences.Push, preferences.PushWebhookURL)
+	return err
+}
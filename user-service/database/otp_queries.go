@@ -0,0 +1,116 @@
+package database
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrOTPInvalid is returned when no unexpired code exists or the code does not match.
+var ErrOTPInvalid = errors.New("invalid or expired code")
+
+// ErrOTPAttemptsExceeded is returned when a code has been guessed wrong too many times.
+var ErrOTPAttemptsExceeded = errors.New("too many attempts, request a new code")
+
+// OTPSendStats describes the codes recently sent to a phone number for one purpose
+type OTPSendStats struct {
+	SentLastHour int
+	LastSentAt   *time.Time
+}
+
+// GetOTPSendStats returns how many codes were sent in the last hour and when the last one went out
+func GetOTPSendStats(phone, purpose string) (OTPSendStats, error) {
+	var stats OTPSendStats
+	var lastSentAt sql.NullTime
+	query := `
+        SELECT COUNT(*), MAX(created_at)
+        FROM otp_codes
+        WHERE phone = ? AND purpose = ? AND created_at > NOW() - INTERVAL 1 HOUR
+    `
+	if err := DB.QueryRow(query, phone, purpose).Scan(&stats.SentLastHour, &lastSentAt); err != nil {
+		return stats, err
+	}
+	if lastSentAt.Valid {
+		stats.LastSentAt = &lastSentAt.Time
+	}
+	return stats, nil
+}
+
+// CreateOTP stores a new code for the phone and purpose, invalidating any earlier one
+func CreateOTP(phone, purpose, codeHash string, expiresAt time.Time) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE otp_codes SET consumed_at = NOW() WHERE phone = ? AND purpose = ? AND consumed_at IS NULL", phone, purpose)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO otp_codes (phone, purpose, code_hash, expires_at) VALUES (?, ?, ?, ?)", phone, purpose, codeHash, expiresAt)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ConsumeOTP checks codeHash against the latest outstanding code for the phone and purpose.
+// A wrong guess counts towards maxAttempts; a correct one marks the code as consumed.
+func ConsumeOTP(phone, purpose, codeHash string, maxAttempts int) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	var id, attempts int
+	var storedHash string
+	var expiresAt time.Time
+	query := `
+        SELECT id, code_hash, attempts, expires_at
+        FROM otp_codes
+        WHERE phone = ? AND purpose = ? AND consumed_at IS NULL
+        ORDER BY created_at DESC
+        LIMIT 1
+        FOR UPDATE
+    `
+	err = tx.QueryRow(query, phone, purpose).Scan(&id, &storedHash, &attempts, &expiresAt)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		return ErrOTPInvalid
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if time.Now().After(expiresAt) {
+		tx.Rollback()
+		return ErrOTPInvalid
+	}
+	if attempts >= maxAttempts {
+		tx.Rollback()
+		return ErrOTPAttemptsExceeded
+	}
+
+	if subtle.ConstantTimeCompare([]byte(storedHash), []byte(codeHash)) != 1 {
+		if _, err := tx.Exec("UPDATE otp_codes SET attempts = attempts + 1 WHERE id = ?", id); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		return ErrOTPInvalid
+	}
+
+	if _, err := tx.Exec("UPDATE otp_codes SET consumed_at = NOW() WHERE id = ?", id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
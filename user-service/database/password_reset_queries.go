@@ -0,0 +1,82 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrResetTokenInvalid is returned when a reset token is unknown, expired or already used.
+var ErrResetTokenInvalid = errors.New("invalid or expired reset token")
+
+// CreatePasswordResetToken stores a new reset token for the user and invalidates any
+// token issued earlier, so only the most recent reset email works.
+func CreatePasswordResetToken(userID int, tokenHash string, expiresAt time.Time) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE password_reset_tokens SET used_at = NOW() WHERE user_id = ? AND used_at IS NULL", userID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO password_reset_tokens (user_id, token_hash, expires_at) VALUES (?, ?, ?)", userID, tokenHash, expiresAt)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ResetPassword consumes the reset token, stores the new password hash, lifts any lockout
+// and revokes every session of the user in a single transaction. It returns the user's ID.
+func ResetPassword(tokenHash, passwordHash string) (int, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	var userID int
+	var expiresAt time.Time
+	var usedAt sql.NullTime
+	query := "SELECT user_id, expires_at, used_at FROM password_reset_tokens WHERE token_hash = ? FOR UPDATE"
+	err = tx.QueryRow(query, tokenHash).Scan(&userID, &expiresAt, &usedAt)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		return 0, ErrResetTokenInvalid
+	}
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if usedAt.Valid || time.Now().After(expiresAt) {
+		tx.Rollback()
+		return 0, ErrResetTokenInvalid
+	}
+
+	statements := []struct {
+		query string
+		args  []interface{}
+	}{
+		{"UPDATE password_reset_tokens SET used_at = NOW() WHERE user_id = ? AND used_at IS NULL", []interface{}{userID}},
+		{"UPDATE users SET password = ?, locked_until = NULL WHERE id = ?", []interface{}{passwordHash, userID}},
+		{"UPDATE login_attempts SET cleared = TRUE WHERE user_id = ? AND cleared = FALSE", []interface{}{userID}},
+		{"UPDATE user_sessions SET revoked_at = NOW() WHERE user_id = ? AND revoked_at IS NULL", []interface{}{userID}},
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt.query, stmt.args...); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
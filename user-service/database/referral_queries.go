@@ -0,0 +1,248 @@
+package database
+
+import (
+	"cnad_assignment/user-service/models"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrReferralCodeNotFound is returned when no active account has the referral code.
+var ErrReferralCodeNotFound = errors.New("invalid referral code")
+
+// Reasons a referral is refused credit
+const (
+	ReferralRejectedSelf          = "referrer and referred user share an email address or phone number"
+	ReferralRejectedPaymentMethod = "referred user paid with a payment method registered to the referrer"
+	ReferralRejectedLimit         = "referrer reached the referral credit limit"
+)
+
+// FetchReferralCode returns the user's referral code, or an empty string if none was assigned yet
+func FetchReferralCode(userID int) (string, error) {
+	var code sql.NullString
+	err := DB.QueryRow("SELECT referral_code FROM users WHERE id = ?", userID).Scan(&code)
+	return code.String, err
+}
+
+// SetReferralCode assigns a referral code to a user who does not have one yet. A code
+// already taken by someone else fails with a duplicate entry error.
+func SetReferralCode(userID int, code string) error {
+	_, err := DB.Exec("UPDATE users SET referral_code = ? WHERE id = ? AND referral_code IS NULL", code, userID)
+	return err
+}
+
+// FetchReferrerByCode returns the active account that owns a referral code
+func FetchReferrerByCode(code string) (models.Referrer, error) {
+	var referrer models.Referrer
+	query := "SELECT id, COALESCE(email, ''), COALESCE(phone, '') FROM users WHERE referral_code = ? AND deleted_at IS NULL"
+	err := DB.QueryRow(query, code).Scan(&referrer.ID, &referrer.Email, &referrer.Phone)
+	if err == sql.ErrNoRows {
+		return referrer, ErrReferralCodeNotFound
+	}
+	return referrer, err
+}
+
+// CreateReferral records that a new user signed up with someone's referral code. A referral
+// already refused by the sign-up checks is stored as rejected with the reason.
+func CreateReferral(referrerID, referredID int, status, reason string) error {
+	query := `
+        INSERT INTO referrals (referrer_id, referred_id, status, rejection_reason, resolved_at)
+        VALUES (?, ?, ?, NULLIF(?, ''), IF(? = 'pending', NULL, NOW()))
+    `
+	_, err := DB.Exec(query, referrerID, referredID, status, reason, status)
+	return err
+}
+
+// FetchReferralsByReferrer returns the referrals made with the user's code, newest first
+func FetchReferralsByReferrer(userID int) ([]models.Referral, error) {
+	query := `
+        SELECT id, referrer_id, referred_id, status, COALESCE(rejection_reason, ''), created_at, resolved_at
+        FROM referrals
+        WHERE referrer_id = ?
+        ORDER BY created_at DESC, id DESC
+    `
+	rows, err := DB.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	referrals := []models.Referral{}
+	for rows.Next() {
+		var referral models.Referral
+		var resolvedAt sql.NullTime
+		err := rows.Scan(&referral.ID, &referral.ReferrerID, &referral.ReferredID, &referral.Status, &referral.RejectionReason,
+			&referral.CreatedAt, &resolvedAt)
+		if err != nil {
+			return nil, err
+		}
+		if resolvedAt.Valid {
+			referral.ResolvedAt = &resolvedAt.Time
+		}
+		referrals = append(referrals, referral)
+	}
+	return referrals, rows.Err()
+}
+
+// FetchReferralConversions summarises the referrals created in [from, to) per referrer,
+// best converting referrers first
+func FetchReferralConversions(from, to time.Time) ([]models.ReferralConversion, error) {
+	query := `
+        SELECT r.referrer_id, u.name, COALESCE(u.email, ''), COUNT(*),
+               SUM(r.status = 'pending'), SUM(r.status = 'rewarded'), SUM(r.status = 'rejected')
+        FROM referrals r
+        JOIN users u ON u.id = r.referrer_id
+        WHERE r.created_at >= ? AND r.created_at < ?
+        GROUP BY r.referrer_id, u.name, u.email
+        ORDER BY SUM(r.status = 'rewarded') DESC, COUNT(*) DESC
+    `
+	rows, err := DB.Query(query, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	conversions := []models.ReferralConversion{}
+	for rows.Next() {
+		var c models.ReferralConversion
+		err := rows.Scan(&c.ReferrerID, &c.ReferrerName, &c.ReferrerEmail, &c.Referrals, &c.Pending, &c.Rewarded, &c.Rejected)
+		if err != nil {
+			return nil, err
+		}
+		c.ConversionRate = float64(c.Rewarded) / float64(c.Referrals)
+		conversions = append(conversions, c)
+	}
+	return conversions, rows.Err()
+}
+
+// ProcessReferralRewards credits both sides of every pending referral whose referred user
+// has completed and paid for a rental, unless the anti-abuse checks refuse it. It returns
+// how many referrals were rewarded and how many rejected.
+func ProcessReferralRewards(referrerPoints, referredPoints, maxRewards int) (int, int, error) {
+	query := `
+        SELECT r.id, MIN(p.id)
+        FROM referrals r
+        JOIN users referrer ON referrer.id = r.referrer_id AND referrer.deleted_at IS NULL
+        JOIN users referred ON referred.id = r.referred_id AND referred.deleted_at IS NULL
+        JOIN bookings b ON b.user_id = r.referred_id AND b.status = 'completed'
+        JOIN payments p ON p.booking_id = b.id AND p.payment_status = 'completed'
+        WHERE r.status = 'pending'
+          AND NOT EXISTS (SELECT 1 FROM refunds rf WHERE rf.payment_id = p.id AND rf.refund_status = 'completed')
+        GROUP BY r.id
+    `
+	rows, err := DB.Query(query)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	type qualified struct{ referralID, paymentID int }
+	var due []qualified
+	for rows.Next() {
+		var q qualified
+		if err := rows.Scan(&q.referralID, &q.paymentID); err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		due = append(due, q)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	var rewarded, rejected int
+	for _, q := range due {
+		status, err := resolveReferral(q.referralID, q.paymentID, referrerPoints, referredPoints, maxRewards)
+		if err != nil {
+			return rewarded, rejected, err
+		}
+		switch status {
+		case models.ReferralRewarded:
+			rewarded++
+		case models.ReferralRejected:
+			rejected++
+		}
+	}
+	return rewarded, rejected, nil
+}
+
+// resolveReferral rewards or rejects one qualified referral and returns its new status,
+// or an empty string if it was already resolved elsewhere
+func resolveReferral(referralID, paymentID, referrerPoints, referredPoints, maxRewards int) (string, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return "", err
+	}
+
+	var referrerID, referredID int
+	query := "SELECT referrer_id, referred_id FROM referrals WHERE id = ? AND status = 'pending' FOR UPDATE"
+	err = tx.QueryRow(query, referralID).Scan(&referrerID, &referredID)
+	if err == sql.ErrNoRows {
+		// Another replica resolved it first
+		tx.Rollback()
+		return "", nil
+	}
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
+	var sharedPaymentMethod bool
+	query = `
+        SELECT EXISTS (
+            SELECT 1
+            FROM payments p
+            JOIN payment_methods used ON used.id = p.payment_method_id
+            JOIN payment_methods owned ON owned.user_id = ? AND owned.method_type = used.method_type
+                                      AND owned.method_details = used.method_details
+            WHERE p.user_id = ?
+        )
+    `
+	if err := tx.QueryRow(query, referrerID, referredID).Scan(&sharedPaymentMethod); err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
+	var alreadyRewarded int
+	query = "SELECT COUNT(*) FROM referrals WHERE referrer_id = ? AND status = 'rewarded'"
+	if err := tx.QueryRow(query, referrerID).Scan(&alreadyRewarded); err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
+	reason := ""
+	if sharedPaymentMethod {
+		reason = ReferralRejectedPaymentMethod
+	} else if alreadyRewarded >= maxRewards {
+		reason = ReferralRejectedLimit
+	}
+	if reason != "" {
+		query = "UPDATE referrals SET status = 'rejected', rejection_reason = ?, qualifying_payment_id = ?, resolved_at = NOW() WHERE id = ?"
+		if _, err := tx.Exec(query, reason, paymentID, referralID); err != nil {
+			tx.Rollback()
+			return "", err
+		}
+		return models.ReferralRejected, tx.Commit()
+	}
+
+	ledgerQuery := `
+        INSERT INTO loyalty_points_ledger (user_id, points, entry_type, referral_id, description)
+        VALUES (?, ?, 'referral', ?, ?)
+    `
+	statements := []struct {
+		query string
+		args  []interface{}
+	}{
+		{ledgerQuery, []interface{}{referrerID, referrerPoints, referralID, "Referral credit for inviting a friend"}},
+		{ledgerQuery, []interface{}{referredID, referredPoints, referralID, "Referral credit for your first rental"}},
+		{"UPDATE referrals SET status = 'rewarded', qualifying_payment_id = ?, resolved_at = NOW() WHERE id = ?", []interface{}{paymentID, referralID}},
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt.query, stmt.args...); err != nil {
+			tx.Rollback()
+			return "", err
+		}
+	}
+
+	return models.ReferralRewarded, tx.Commit()
+}
@@ -0,0 +1,151 @@
+package database
+
+import (
+	"cnad_assignment/user-service/models"
+	"database/sql"
+	"errors"
+)
+
+// ErrRoleNotFound is returned when a role name does not exist
+var ErrRoleNotFound = errors.New("role not found")
+
+// AdminRole is the role whose holders are always required to use MFA
+const AdminRole = "admin"
+
+// FetchUserRoles returns the names of the roles granted to the user
+func FetchUserRoles(userID int) ([]string, error) {
+	query := `
+        SELECT r.name
+        FROM user_roles ur
+        JOIN roles r ON r.id = ur.role_id
+        WHERE ur.user_id = ?
+        ORDER BY r.name
+    `
+	rows, err := DB.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		roles = append(roles, name)
+	}
+	return roles, rows.Err()
+}
+
+// FetchRoles returns every role together with the permissions it grants
+func FetchRoles() ([]models.Role, error) {
+	query := `
+        SELECT r.id, r.name, COALESCE(r.description, ''), p.name
+        FROM roles r
+        LEFT JOIN role_permissions rp ON rp.role_id = r.id
+        LEFT JOIN permissions p ON p.id = rp.permission_id
+        ORDER BY r.name, p.name
+    `
+	rows, err := DB.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []models.Role
+	for rows.Next() {
+		var role models.Role
+		var permission sql.NullString
+		if err := rows.Scan(&role.ID, &role.Name, &role.Description, &permission); err != nil {
+			return nil, err
+		}
+
+		// Rows arrive grouped by role; start a new entry when the role changes
+		if len(roles) == 0 || roles[len(roles)-1].ID != role.ID {
+			role.Permissions = []string{}
+			roles = append(roles, role)
+		}
+		if permission.Valid {
+			last := &roles[len(roles)-1]
+			last.Permissions = append(last.Permissions, permission.String)
+		}
+	}
+	return roles, rows.Err()
+}
+
+// GrantRole gives the user a role. Granting the admin role also forces the user into MFA.
+func GrantRole(userID int, roleName string, grantedBy int) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	var roleID int
+	err = tx.QueryRow("SELECT id FROM roles WHERE name = ?", roleName).Scan(&roleID)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		return ErrRoleNotFound
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec("INSERT IGNORE INTO user_roles (user_id, role_id, granted_by) VALUES (?, ?, ?)", userID, roleID, grantedBy)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if roleName == AdminRole {
+		if _, err := tx.Exec("UPDATE users SET mfa_required = TRUE WHERE id = ?", userID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// RevokeRole removes a role from the user and reports whether the user had it
+func RevokeRole(userID int, roleName string) (bool, error) {
+	query := `
+        DELETE ur FROM user_roles ur
+        JOIN roles r ON r.id = ur.role_id
+        WHERE ur.user_id = ? AND r.name = ?
+    `
+	result, err := DB.Exec(query, userID, roleName)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	return rowsAffected > 0, err
+}
+
+// SetMFARequired forces or stops forcing the user to use MFA at login
+func SetMFARequired(userID int, required bool) error {
+	_, err := DB.Exec("UPDATE users SET mfa_required = ? WHERE id = ?", required, userID)
+	return err
+}
+
+// UserExists reports whether a user with the ID exists
+func UserExists(userID int) (bool, error) {
+	var exists bool
+	err := DB.QueryRow("SELECT EXISTS (SELECT 1 FROM users WHERE id = ?)", userID).Scan(&exists)
+	return exists, err
+}
+
+// FetchMembershipTier returns the name of the user's membership tier
+func FetchMembershipTier(userID int) (string, error) {
+	var tier string
+	query := `
+        SELECT mt.name
+        FROM users u
+        JOIN membership_tiers mt ON mt.id = u.membership_tier_id
+        WHERE u.id = ?
+    `
+	err := DB.QueryRow(query, userID).Scan(&tier)
+	return tier, err
+}
@@ -0,0 +1,23 @@
+package database
+
+// Security event types
+const (
+	SecurityEventAccountLocked   = "account_locked"
+	SecurityEventAccountUnlocked = "account_unlocked"
+	SecurityEventEmailChanged    = "email_changed"
+	SecurityEventAccountDeleted  = "account_deleted"
+
+	SecurityEventAccountSuspended   = "account_suspended"
+	SecurityEventAccountReactivated = "account_reactivated"
+	SecurityEventVerifiedByStaff    = "verified_by_staff"
+	SecurityEventMFAReset           = "mfa_reset"
+	SecurityEventAPIKeyCreated      = "api_key_created"
+	SecurityEventAPIKeyRevoked      = "api_key_revoked"
+)
+
+// RecordSecurityEvent appends an entry to the security audit trail. userID is 0 when no account is involved.
+func RecordSecurityEvent(userID int, eventType, ipAddress, details string) error {
+	query := "INSERT INTO security_events (user_id, event_type, ip_address, details) VALUES (NULLIF(?, 0), ?, ?, ?)"
+	_, err := DB.Exec(query, userID, eventType, ipAddress, details)
+	return err
+}
@@ -0,0 +1,122 @@
+package database
+
+import (
+	"cnad_assignment/user-service/models"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrSessionNotFound is returned when no usable session matches a refresh token.
+var ErrSessionNotFound = errors.New("session not found")
+
+// ErrRefreshTokenReused is returned when an already rotated refresh token is presented again.
+// The owning session is revoked before this error is returned.
+var ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+
+// CreateSession stores a new login session for the user and returns its ID.
+func CreateSession(userID int, refreshTokenHash, userAgent, ipAddress string, expiresAt time.Time) (int, error) {
+	query := `
+        INSERT INTO user_sessions (user_id, refresh_token_hash, user_agent, ip_address, expires_at)
+        VALUES (?, ?, ?, ?, ?)
+    `
+	result, err := DB.Exec(query, userID, refreshTokenHash, userAgent, ipAddress, expiresAt)
+	if err != nil {
+		return 0, err
+	}
+
+	sessionID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(sessionID), nil
+}
+
+// RotateSession swaps the refresh token of the session matching oldHash for newHash.
+// If oldHash is a token that was already rotated away, the session is revoked and
+// ErrRefreshTokenReused is returned, since only a copied token can be presented twice.
+func RotateSession(oldHash, newHash string, expiresAt time.Time) (models.Session, error) {
+	var session models.Session
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return session, err
+	}
+
+	query := `
+        SELECT id, user_id, expires_at, revoked_at
+        FROM user_sessions
+        WHERE refresh_token_hash = ?
+        FOR UPDATE
+    `
+	err = tx.QueryRow(query, oldHash).Scan(&session.ID, &session.UserID, &session.ExpiresAt, &session.RevokedAt)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		if revokeErr := revokeReusedSession(oldHash); revokeErr != nil {
+			return session, revokeErr
+		}
+		return session, ErrSessionNotFound
+	}
+	if err != nil {
+		tx.Rollback()
+		return session, err
+	}
+
+	if session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		tx.Rollback()
+		return session, ErrSessionNotFound
+	}
+
+	updateQuery := `
+        UPDATE user_sessions
+        SET refresh_token_hash = ?, previous_token_hash = ?, expires_at = ?, last_used_at = NOW()
+        WHERE id = ?
+    `
+	if _, err := tx.Exec(updateQuery, newHash, oldHash, expiresAt, session.ID); err != nil {
+		tx.Rollback()
+		return session, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return session, err
+	}
+
+	session.ExpiresAt = expiresAt
+	return session, nil
+}
+
+// revokeReusedSession revokes the session whose previous refresh token matches hash.
+// It returns ErrRefreshTokenReused when such a session existed.
+func revokeReusedSession(hash string) error {
+	result, err := DB.Exec("UPDATE user_sessions SET revoked_at = NOW() WHERE previous_token_hash = ? AND revoked_at IS NULL", hash)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected > 0 {
+		return ErrRefreshTokenReused
+	}
+	return nil
+}
+
+// RevokeSession revokes a single session belonging to the user.
+func RevokeSession(userID, sessionID int) error {
+	_, err := DB.Exec("UPDATE user_sessions SET revoked_at = NOW() WHERE id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userID)
+	return err
+}
+
+// RevokeSessionByRefreshHash revokes the session that currently holds the given refresh token.
+func RevokeSessionByRefreshHash(refreshTokenHash string) error {
+	_, err := DB.Exec("UPDATE user_sessions SET revoked_at = NOW() WHERE refresh_token_hash = ? AND revoked_at IS NULL", refreshTokenHash)
+	return err
+}
+
+// RevokeAllSessions revokes every active session of the user and returns how many were revoked.
+func RevokeAllSessions(userID int) (int64, error) {
+	result, err := DB.Exec("UPDATE user_sessions SET revoked_at = NOW() WHERE user_id = ? AND revoked_at IS NULL", userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,52 @@
+package database
+
+import "time"
+
+// StoredSigningKey is a token signing key as kept in the database
+type StoredSigningKey struct {
+	ID            string
+	PrivateKeyPEM string
+	CreatedAt     time.Time
+	ActiveFrom    time.Time
+}
+
+// FetchSigningKeys returns every stored signing key, ordered by when it starts signing
+func FetchSigningKeys() ([]StoredSigningKey, error) {
+	rows, err := DB.Query("SELECT id, private_key, created_at, active_from FROM signing_keys ORDER BY active_from, created_at, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []StoredSigningKey
+	for rows.Next() {
+		var key StoredSigningKey
+		if err := rows.Scan(&key.ID, &key.PrivateKeyPEM, &key.CreatedAt, &key.ActiveFrom); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// CreateSigningKey stores a new signing key unless another replica already stored one
+// after createdAfter. It returns whether the key was stored.
+func CreateSigningKey(key StoredSigningKey, createdAfter time.Time) (bool, error) {
+	query := `
+        INSERT INTO signing_keys (id, private_key, created_at, active_from)
+        SELECT ?, ?, ?, ? FROM DUAL
+        WHERE NOT EXISTS (SELECT 1 FROM signing_keys WHERE created_at > ?)
+    `
+	result, err := DB.Exec(query, key.ID, key.PrivateKeyPEM, key.CreatedAt, key.ActiveFrom, createdAfter)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	return rowsAffected > 0, err
+}
+
+// DeleteSigningKey removes a retired signing key
+func DeleteSigningKey(id string) error {
+	_, err := DB.Exec("DELETE FROM signing_keys WHERE id = ?", id)
+	return err
+}
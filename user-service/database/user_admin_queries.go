@@ -0,0 +1,177 @@
+package database
+
+import (
+	"cnad_assignment/user-service/models"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrUserSuspended is returned when suspending a user who is already suspended.
+var ErrUserSuspended = errors.New("user is already suspended")
+
+// ErrUserNotSuspended is returned when reactivating a user who is not suspended.
+var ErrUserNotSuspended = errors.New("user is not suspended")
+
+// UserSortColumns maps the sort keys accepted by the admin user search to their columns
+var UserSortColumns = map[string]string{
+	"id":         "u.id",
+	"name":       "u.name",
+	"email":      "u.email",
+	"created_at": "u.created_at",
+}
+
+// UserSearch filters and orders the admin user search. Zero values leave a filter unset.
+type UserSearch struct {
+	Query       string // Matched against email, name and phone
+	Verified    *bool
+	Suspended   *bool
+	Tier        string
+	CreatedFrom *time.Time // Inclusive
+	CreatedTo   *time.Time // Exclusive
+	Sort        string     // A key of UserSortColumns
+	Descending  bool
+	Limit       int
+	Offset      int
+}
+
+// likePattern matches value anywhere in a column, treating LIKE wildcards in it literally
+func likePattern(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return "%" + replacer.Replace(value) + "%"
+}
+
+// SearchUsers returns one page of the accounts matching the search, without deleted
+// accounts, along with the total number of matches
+func SearchUsers(search UserSearch) ([]models.User, int, error) {
+	conditions := []string{"u.deleted_at IS NULL"}
+	var args []interface{}
+	if search.Query != "" {
+		pattern := likePattern(search.Query)
+		conditions = append(conditions, "(u.email LIKE ? OR u.name LIKE ? OR u.phone LIKE ?)")
+		args = append(args, pattern, pattern, pattern)
+	}
+	if search.Verified != nil {
+		conditions = append(conditions, "u.is_verified = ?")
+		args = append(args, *search.Verified)
+	}
+	if search.Suspended != nil {
+		if *search.Suspended {
+			conditions = append(conditions, "u.suspended_at IS NOT NULL")
+		} else {
+			conditions = append(conditions, "u.suspended_at IS NULL")
+		}
+	}
+	if search.Tier != "" {
+		conditions = append(conditions, "mt.name = ?")
+		args = append(args, search.Tier)
+	}
+	if search.CreatedFrom != nil {
+		conditions = append(conditions, "u.created_at >= ?")
+		args = append(args, *search.CreatedFrom)
+	}
+	if search.CreatedTo != nil {
+		conditions = append(conditions, "u.created_at < ?")
+		args = append(args, *search.CreatedTo)
+	}
+	from := " FROM users u JOIN membership_tiers mt ON mt.id = u.membership_tier_id WHERE " + strings.Join(conditions, " AND ")
+
+	var total int
+	if err := DB.QueryRow("SELECT COUNT(*)"+from, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	column, ok := UserSortColumns[search.Sort]
+	if !ok {
+		column = UserSortColumns["created_at"]
+	}
+	direction := "ASC"
+	if search.Descending {
+		direction = "DESC"
+	}
+	// The ID breaks ties so pages do not overlap
+	query := "SELECT " + accountColumns + from + " ORDER BY " + column + " " + direction + ", u.id " + direction + " LIMIT ? OFFSET ?"
+	rows, err := DB.Query(query, append(args, search.Limit, search.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		user, err := scanAccount(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		users = append(users, user)
+	}
+	return users, total, rows.Err()
+}
+
+// SuspendUser blocks the user from logging in and booking, and ends all their sessions
+func SuspendUser(userID int, reason string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	query := "UPDATE users SET suspended_at = NOW(), suspension_reason = ? WHERE id = ? AND suspended_at IS NULL"
+	result, err := tx.Exec(query, reason, userID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if rowsAffected == 0 {
+		tx.Rollback()
+		return ErrUserSuspended
+	}
+
+	if _, err := tx.Exec("UPDATE user_sessions SET revoked_at = NOW() WHERE user_id = ? AND revoked_at IS NULL", userID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ReactivateUser lifts the suspension of the user
+func ReactivateUser(userID int) error {
+	query := "UPDATE users SET suspended_at = NULL, suspension_reason = NULL WHERE id = ? AND suspended_at IS NOT NULL"
+	result, err := DB.Exec(query, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err == nil && rowsAffected == 0 {
+		return ErrUserNotSuspended
+	}
+	return err
+}
+
+// ForceVerifyUser marks the user's account as verified and invalidates any verification
+// links still outstanding
+func ForceVerifyUser(userID int) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	statements := []string{
+		"UPDATE email_verification_tokens SET used_at = NOW() WHERE user_id = ? AND used_at IS NULL",
+		"UPDATE users SET is_verified = TRUE WHERE id = ?",
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt, userID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
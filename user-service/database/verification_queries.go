@@ -0,0 +1,103 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrVerificationTokenInvalid is returned when a verification token is unknown or already used.
+var ErrVerificationTokenInvalid = errors.New("invalid verification link")
+
+// ErrVerificationTokenExpired is returned when a verification token is past its expiry.
+var ErrVerificationTokenExpired = errors.New("verification link has expired, request a new one")
+
+// VerificationSendStats describes the verification emails recently sent to a user
+type VerificationSendStats struct {
+	SentLastHour int
+	LastSentAt   *time.Time
+}
+
+// GetVerificationSendStats returns how many verification emails were sent to the user in
+// the last hour and when the last one went out
+func GetVerificationSendStats(userID int) (VerificationSendStats, error) {
+	var stats VerificationSendStats
+	var lastSentAt sql.NullTime
+	query := `
+        SELECT COUNT(*), MAX(created_at)
+        FROM email_verification_tokens
+        WHERE user_id = ? AND created_at > NOW() - INTERVAL 1 HOUR
+    `
+	if err := DB.QueryRow(query, userID).Scan(&stats.SentLastHour, &lastSentAt); err != nil {
+		return stats, err
+	}
+	if lastSentAt.Valid {
+		stats.LastSentAt = &lastSentAt.Time
+	}
+	return stats, nil
+}
+
+// CreateVerificationToken stores a new verification token for the user and invalidates
+// any token issued earlier, so only the most recent email works
+func CreateVerificationToken(userID int, tokenHash string, expiresAt time.Time) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE email_verification_tokens SET used_at = NOW() WHERE user_id = ? AND used_at IS NULL", userID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO email_verification_tokens (user_id, token_hash, expires_at) VALUES (?, ?, ?)", userID, tokenHash, expiresAt)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ConsumeVerificationToken marks the token as used and the user's account as verified.
+// It returns the user's ID.
+func ConsumeVerificationToken(tokenHash string) (int, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	var userID int
+	var expiresAt time.Time
+	var usedAt sql.NullTime
+	query := "SELECT user_id, expires_at, used_at FROM email_verification_tokens WHERE token_hash = ? FOR UPDATE"
+	err = tx.QueryRow(query, tokenHash).Scan(&userID, &expiresAt, &usedAt)
+	if err == sql.ErrNoRows || (err == nil && usedAt.Valid) {
+		tx.Rollback()
+		return 0, ErrVerificationTokenInvalid
+	}
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if time.Now().After(expiresAt) {
+		tx.Rollback()
+		return 0, ErrVerificationTokenExpired
+	}
+
+	if _, err := tx.Exec("UPDATE email_verification_tokens SET used_at = NOW() WHERE user_id = ? AND used_at IS NULL", userID); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	if _, err := tx.Exec("UPDATE users SET is_verified = TRUE WHERE id = ?", userID); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
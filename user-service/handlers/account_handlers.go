@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"cnad_assignment/shared/auth"
+	"cnad_assignment/user-service/database"
+	"cnad_assignment/user-service/models"
+	"cnad_assignment/user-service/utils"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// ExportAccountData returns everything held about the caller as one JSON archive: the
+// profile, sessions and security events from this service, bookings from vehicle-service
+// and payments and invoices from billing-service
+func ExportAccountData(w http.ResponseWriter, r *http.Request) {
+	userID, ok := authorizeAccount(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	export := models.AccountExport{ExportedAt: time.Now()}
+
+	var err error
+	if export.Profile, err = database.FetchAccount(userID); err != nil {
+		log.Printf("Error exporting profile of user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to export account data")
+		return
+	}
+	licence, err := database.FetchLicence(userID)
+	if err != nil && err != database.ErrLicenceNotFound {
+		log.Printf("Error exporting licence of user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to export account data")
+		return
+	}
+	if err == nil {
+		export.Licence = &licence
+	}
+	if export.MembershipChanges, err = database.FetchMembershipChanges(userID); err != nil {
+		log.Printf("Error exporting membership changes of user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to export account data")
+		return
+	}
+	if export.LoyaltyPoints, err = database.FetchPointsLedger(userID); err != nil {
+		log.Printf("Error exporting loyalty points of user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to export account data")
+		return
+	}
+	if export.Referrals, err = database.FetchReferralsByReferrer(userID); err != nil {
+		log.Printf("Error exporting referrals of user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to export account data")
+		return
+	}
+	if export.Sessions, err = database.FetchSessions(userID); err != nil {
+		log.Printf("Error exporting sessions of user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to export account data")
+		return
+	}
+	if export.APIKeys, err = database.FetchAPIKeys(userID); err != nil {
+		log.Printf("Error exporting API keys of user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to export account data")
+		return
+	}
+	if export.NotificationPreferences, err = database.FetchNotificationPreferences(userID); err != nil {
+		log.Printf("Error exporting notification preferences of user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to export account data")
+		return
+	}
+	if export.SecurityEvents, err = database.FetchSecurityEvents(userID); err != nil {
+		log.Printf("Error exporting security events of user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to export account data")
+		return
+	}
+
+	// Other services are asked on the caller's behalf so they apply their own access checks
+	accessToken, _ := auth.BearerToken(r)
+
+	bookingsURL := fmt.Sprintf("%s/api/v1/users/%d/rental-history", utils.VehicleServiceURL, userID)
+	if err := utils.FetchFromService(bookingsURL, accessToken, &export.Bookings); err != nil {
+		log.Printf("Error exporting bookings of user ID=%d: %v", userID, err)
+		writeError(w, http.StatusBadGateway, "Failed to collect bookings for the export")
+		return
+	}
+
+	var billing struct {
+		Payments interface{} `json:"payments"`
+		Invoices interface{} `json:"invoices"`
+	}
+	if err := utils.FetchFromService(utils.BillingServiceURL+"/api/v1/billing/history", accessToken, &billing); err != nil {
+		log.Printf("Error exporting billing history of user ID=%d: %v", userID, err)
+		writeError(w, http.StatusBadGateway, "Failed to collect payments for the export")
+		return
+	}
+	export.Payments = billing.Payments
+	export.Invoices = billing.Invoices
+
+	log.Printf("Exported account data of user ID=%d", userID)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="account-data-%d.json"`, userID))
+	writeJSON(w, http.StatusOK, export)
+}
+
+// DeleteAccount deletes the caller's account after re-checking their password, and their
+// second factor when MFA is enabled. Personal fields are anonymised while bookings,
+// payments and invoices are kept for accounting.
+func DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	userID, ok := authorizeAccount(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Password     string `json:"password"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+
+	var passwordHash string
+	if err := database.DB.QueryRow("SELECT password FROM users WHERE id = ?", userID).Scan(&passwordHash); err != nil {
+		log.Printf("Error fetching password for user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to delete account")
+		return
+	}
+	if !utils.CheckPasswordHash(request.Password, passwordHash) {
+		writeError(w, http.StatusUnauthorized, "Invalid password")
+		return
+	}
+
+	state, err := database.GetMFAState(userID)
+	if err != nil {
+		log.Printf("Error fetching MFA state for user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to delete account")
+		return
+	}
+	if state.Enabled {
+		ok, err := verifySecondFactor(userID, state.Secret, request.Code, request.RecoveryCode)
+		if err != nil {
+			log.Printf("Error verifying second factor for user ID=%d: %v", userID, err)
+			writeError(w, http.StatusInternalServerError, "Failed to delete account")
+			return
+		}
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "Invalid code")
+			return
+		}
+	}
+
+	// Remember the licence scan so it can be removed along with the account
+	licence, err := database.FetchLicence(userID)
+	if err != nil && err != database.ErrLicenceNotFound {
+		log.Printf("Error fetching licence of user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to delete account")
+		return
+	}
+
+	err = database.DeleteAccount(userID)
+	if err == database.ErrRentalInProgress {
+		writeError(w, http.StatusConflict, "You cannot delete your account while a rental is in progress")
+		return
+	}
+	if err != nil {
+		log.Printf("Error deleting account of user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to delete account")
+		return
+	}
+
+	if licence.DocumentRef != "" {
+		if err := utils.RemoveLicenceDocument(licence.DocumentRef); err != nil {
+			log.Printf("Error removing licence document of deleted user ID=%d: %v", userID, err)
+		}
+	}
+
+	// No IP address is kept for a deleted account
+	if err := database.RecordSecurityEvent(userID, database.SecurityEventAccountDeleted, "", ""); err != nil {
+		log.Printf("Error recording deletion of user ID=%d: %v", userID, err)
+	}
+
+	log.Printf("Account of user ID=%d deleted", userID)
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Your account has been deleted"})
+}
@@ -0,0 +1,365 @@
+package handlers
+
+import (
+	"cnad_assignment/shared/auth"
+	"cnad_assignment/user-service/database"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// adminTargetUser parses the {id} URL parameter and checks that the user exists.
+// On failure it writes the error response and returns false.
+func adminTargetUser(w http.ResponseWriter, r *http.Request) (int, bool) {
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || userID <= 0 {
+		writeError(w, http.StatusBadRequest, "Invalid user ID")
+		return 0, false
+	}
+
+	exists, err := database.UserExists(userID)
+	if err != nil {
+		log.Printf("Error checking user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to fetch user")
+		return 0, false
+	}
+	if !exists {
+		writeError(w, http.StatusNotFound, "User not found")
+		return 0, false
+	}
+	return userID, true
+}
+
+// AdminGetUser returns a user's account details, membership tier and staff roles
+func AdminGetUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || userID <= 0 {
+		writeError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	user, err := database.FetchAccount(userID)
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to fetch user")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, user)
+}
+
+// AdminSearchUsers finds accounts for support staff. q matches email, name and phone;
+// verified, suspended, tier and created_from/created_to (YYYY-MM-DD, inclusive) filter the
+// results; sort and order choose the ordering; page and page_size select the page.
+func AdminSearchUsers(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	search := database.UserSearch{
+		Query: strings.TrimSpace(params.Get("q")),
+		Tier:  params.Get("tier"),
+		Sort:  params.Get("sort"),
+	}
+
+	var err error
+	if search.Verified, err = optionalBool(params.Get("verified")); err != nil {
+		writeError(w, http.StatusBadRequest, "verified must be true or false")
+		return
+	}
+	if search.Suspended, err = optionalBool(params.Get("suspended")); err != nil {
+		writeError(w, http.StatusBadRequest, "suspended must be true or false")
+		return
+	}
+	if value := params.Get("created_from"); value != "" {
+		from, err := time.Parse(dateLayout, value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "created_from must be a date in YYYY-MM-DD format")
+			return
+		}
+		search.CreatedFrom = &from
+	}
+	if value := params.Get("created_to"); value != "" {
+		to, err := time.Parse(dateLayout, value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "created_to must be a date in YYYY-MM-DD format")
+			return
+		}
+		to = to.AddDate(0, 0, 1)
+		search.CreatedTo = &to
+	}
+
+	if search.Sort == "" {
+		search.Sort = "created_at"
+	}
+	if _, ok := database.UserSortColumns[search.Sort]; !ok {
+		writeError(w, http.StatusBadRequest, "sort must be one of id, name, email or created_at")
+		return
+	}
+	switch params.Get("order") {
+	case "", "desc":
+		search.Descending = true
+	case "asc":
+	default:
+		writeError(w, http.StatusBadRequest, "order must be asc or desc")
+		return
+	}
+
+	page, pageSize, ok := parsePagination(w, r)
+	if !ok {
+		return
+	}
+	search.Limit = pageSize
+	search.Offset = (page - 1) * pageSize
+
+	users, total, err := database.SearchUsers(search)
+	if err != nil {
+		log.Printf("Error searching users: %v", err)
+		writeError(w, http.StatusInternalServerError, "Failed to search users")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"users":     users,
+		"page":      page,
+		"page_size": pageSize,
+		"total":     total,
+	})
+}
+
+// optionalBool parses a boolean query parameter, returning nil when it was not given
+func optionalBool(value string) (*bool, error) {
+	if value == "" {
+		return nil, nil
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, err
+	}
+	return &parsed, nil
+}
+
+// AdminSuspendUser blocks a user from logging in and booking and logs them out everywhere
+func AdminSuspendUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || strings.TrimSpace(request.Reason) == "" {
+		writeError(w, http.StatusBadRequest, "A reason is required to suspend a user")
+		return
+	}
+	if userID == auth.UserID(r) {
+		writeError(w, http.StatusBadRequest, "You cannot suspend your own account")
+		return
+	}
+
+	err := database.SuspendUser(userID, strings.TrimSpace(request.Reason))
+	if err == database.ErrUserSuspended {
+		writeError(w, http.StatusConflict, "User is already suspended")
+		return
+	}
+	if err != nil {
+		log.Printf("Error suspending user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to suspend user")
+		return
+	}
+
+	recordStaffAction(r, userID, database.SecurityEventAccountSuspended, request.Reason)
+	writeJSON(w, http.StatusOK, map[string]string{"message": "User suspended"})
+}
+
+// AdminReactivateUser lifts a user's suspension
+func AdminReactivateUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := database.ReactivateUser(userID)
+	if err == database.ErrUserNotSuspended {
+		writeError(w, http.StatusConflict, "User is not suspended")
+		return
+	}
+	if err != nil {
+		log.Printf("Error reactivating user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to reactivate user")
+		return
+	}
+
+	recordStaffAction(r, userID, database.SecurityEventAccountReactivated, "")
+	writeJSON(w, http.StatusOK, map[string]string{"message": "User reactivated"})
+}
+
+// AdminVerifyUser marks a user's account as verified without the verification link
+func AdminVerifyUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := database.ForceVerifyUser(userID); err != nil {
+		log.Printf("Error verifying user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to verify user")
+		return
+	}
+
+	recordStaffAction(r, userID, database.SecurityEventVerifiedByStaff, "")
+	writeJSON(w, http.StatusOK, map[string]string{"message": "User verified"})
+}
+
+// AdminResetUserMFA removes the authenticator and recovery codes of a user who lost access
+// to them, and ends their sessions. Users required to use MFA enrol again at their next login.
+func AdminResetUserMFA(w http.ResponseWriter, r *http.Request) {
+	userID, ok := adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := database.DisableMFA(userID); err != nil {
+		log.Printf("Error resetting MFA of user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to reset MFA")
+		return
+	}
+	if _, err := database.RevokeAllSessions(userID); err != nil {
+		log.Printf("Error revoking sessions of user ID=%d after MFA reset: %v", userID, err)
+	}
+
+	recordStaffAction(r, userID, database.SecurityEventMFAReset, "")
+	writeJSON(w, http.StatusOK, map[string]string{"message": "MFA reset"})
+}
+
+// recordStaffAction logs an action taken by staff on a user's account and adds it to the
+// user's security audit trail
+func recordStaffAction(r *http.Request, userID int, eventType, details string) {
+	staffID := auth.UserID(r)
+	log.Printf("User ID=%d performed %s on user ID=%d", staffID, eventType, userID)
+
+	details = strings.TrimSpace("by staff user ID=" + strconv.Itoa(staffID) + " " + details)
+	if err := database.RecordSecurityEvent(userID, eventType, clientIP(r), details); err != nil {
+		log.Printf("Error recording %s event for user ID=%d: %v", eventType, userID, err)
+	}
+}
+
+// ListRoles returns every staff role with its permissions
+func ListRoles(w http.ResponseWriter, r *http.Request) {
+	roles, err := database.FetchRoles()
+	if err != nil {
+		log.Printf("Error fetching roles: %v", err)
+		writeError(w, http.StatusInternalServerError, "Failed to fetch roles")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, roles)
+}
+
+// GrantUserRole gives a staff role to a user
+func GrantUserRole(w http.ResponseWriter, r *http.Request) {
+	userID, ok := adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Role == "" {
+		writeError(w, http.StatusBadRequest, "Role is required")
+		return
+	}
+
+	err := database.GrantRole(userID, request.Role, auth.UserID(r))
+	if err == database.ErrRoleNotFound {
+		writeError(w, http.StatusBadRequest, "Unknown role")
+		return
+	}
+	if err != nil {
+		log.Printf("Error granting role %s to user ID=%d: %v", request.Role, userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to grant role")
+		return
+	}
+
+	log.Printf("User ID=%d granted role %s to user ID=%d", auth.UserID(r), request.Role, userID)
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Role granted"})
+}
+
+// RevokeUserRole removes a staff role from a user
+func RevokeUserRole(w http.ResponseWriter, r *http.Request) {
+	userID, ok := adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+	role := mux.Vars(r)["role"]
+
+	// Stop admins from locking everyone out by removing their own admin role
+	if userID == auth.UserID(r) && role == database.AdminRole {
+		writeError(w, http.StatusBadRequest, "You cannot revoke your own admin role")
+		return
+	}
+
+	revoked, err := database.RevokeRole(userID, role)
+	if err != nil {
+		log.Printf("Error revoking role %s from user ID=%d: %v", role, userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to revoke role")
+		return
+	}
+	if !revoked {
+		writeError(w, http.StatusNotFound, "User does not have this role")
+		return
+	}
+
+	log.Printf("User ID=%d revoked role %s from user ID=%d", auth.UserID(r), role, userID)
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Role revoked"})
+}
+
+// SetUserMFARequirement forces a user to enrol in MFA at their next login, or lifts that requirement
+func SetUserMFARequirement(w http.ResponseWriter, r *http.Request) {
+	userID, ok := adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Required *bool `json:"required"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Required == nil {
+		writeError(w, http.StatusBadRequest, "required must be true or false")
+		return
+	}
+
+	// Admins must always use MFA
+	if !*request.Required {
+		roles, err := database.FetchUserRoles(userID)
+		if err != nil {
+			log.Printf("Error fetching roles for user ID=%d: %v", userID, err)
+			writeError(w, http.StatusInternalServerError, "Failed to update MFA requirement")
+			return
+		}
+		for _, role := range roles {
+			if role == database.AdminRole {
+				writeError(w, http.StatusBadRequest, "MFA cannot be made optional for admin accounts")
+				return
+			}
+		}
+	}
+
+	if err := database.SetMFARequired(userID, *request.Required); err != nil {
+		log.Printf("Error updating MFA requirement for user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to update MFA requirement")
+		return
+	}
+
+	log.Printf("User ID=%d set mfa_required=%t for user ID=%d", auth.UserID(r), *request.Required, userID)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"mfa_required": *request.Required})
+}
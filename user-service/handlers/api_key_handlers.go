@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"cnad_assignment/shared/auth"
+	"cnad_assignment/user-service/database"
+	"cnad_assignment/user-service/utils"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// CreateAPIKey issues a personal API key for scripts. The key is only shown in this
+// response; afterwards only its prefix is listed.
+func CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	userID, ok := authorizeAccount(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+
+	name := strings.TrimSpace(request.Name)
+	if name == "" || len(name) > 100 {
+		writeError(w, http.StatusBadRequest, "Name is required and must be at most 100 characters")
+		return
+	}
+	scopes, ok := validScopes(request.Scopes)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "scopes must list one or more of "+strings.Join(auth.Scopes, ", "))
+		return
+	}
+
+	ttl := utils.APIKeyDefaultTTL
+	if request.ExpiresInDays != 0 {
+		ttl = time.Duration(request.ExpiresInDays) * 24 * time.Hour
+		if request.ExpiresInDays < 0 || ttl > utils.APIKeyMaxTTL {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("expires_in_days must be between 1 and %d", int(utils.APIKeyMaxTTL.Hours()/24)))
+			return
+		}
+	}
+	expiresAt := time.Now().Add(ttl)
+
+	key, err := utils.GenerateAPIKey()
+	if err != nil {
+		log.Printf("Error generating API key: %v", err)
+		writeError(w, http.StatusInternalServerError, "Failed to create API key")
+		return
+	}
+	prefix := key[:utils.APIKeyDisplayLength]
+
+	keyID, err := database.CreateAPIKey(userID, name, prefix, auth.HashAPIKey(key), scopes, expiresAt, utils.MaxAPIKeysPerUser)
+	if err == database.ErrAPIKeyLimitReached {
+		writeError(w, http.StatusConflict, fmt.Sprintf("You can have at most %d active API keys. Revoke one first.", utils.MaxAPIKeysPerUser))
+		return
+	}
+	if err != nil {
+		log.Printf("Error creating API key for user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to create API key")
+		return
+	}
+
+	details := fmt.Sprintf("key %s (%s) with scopes %s", prefix, name, strings.Join(scopes, ","))
+	if err := database.RecordSecurityEvent(userID, database.SecurityEventAPIKeyCreated, clientIP(r), details); err != nil {
+		log.Printf("Error recording API key creation for user ID=%d: %v", userID, err)
+	}
+
+	log.Printf("User ID=%d created API key ID=%d", userID, keyID)
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"message":    "Store this key somewhere safe. It will not be shown again.",
+		"id":         keyID,
+		"name":       name,
+		"key":        key,
+		"prefix":     prefix,
+		"scopes":     scopes,
+		"expires_at": expiresAt,
+	})
+}
+
+// validScopes checks that every requested scope exists and drops duplicates
+func validScopes(requested []string) ([]string, bool) {
+	known := map[string]bool{}
+	for _, scope := range auth.Scopes {
+		known[scope] = true
+	}
+
+	var scopes []string
+	seen := map[string]bool{}
+	for _, scope := range requested {
+		if !known[scope] {
+			return nil, false
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, len(scopes) > 0
+}
+
+// ListAPIKeys returns the caller's API keys, including revoked and expired ones
+func ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	userID, ok := authorizeAccount(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	keys, err := database.FetchAPIKeys(userID)
+	if err != nil {
+		log.Printf("Error fetching API keys of user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to fetch API keys")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, keys)
+}
+
+// RevokeAPIKey stops one of the caller's API keys from working
+func RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	userID, ok := authorizeAccount(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+	keyID, err := strconv.Atoi(mux.Vars(r)["keyId"])
+	if err != nil || keyID <= 0 {
+		writeError(w, http.StatusBadRequest, "Invalid API key ID")
+		return
+	}
+
+	err = database.RevokeAPIKey(userID, keyID)
+	if err == database.ErrAPIKeyNotFound {
+		writeError(w, http.StatusNotFound, "API key not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error revoking API key ID=%d of user ID=%d: %v", keyID, userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to revoke API key")
+		return
+	}
+
+	details := fmt.Sprintf("key ID=%d", keyID)
+	if err := database.RecordSecurityEvent(userID, database.SecurityEventAPIKeyRevoked, clientIP(r), details); err != nil {
+		log.Printf("Error recording API key revocation for user ID=%d: %v", userID, err)
+	}
+
+	log.Printf("User ID=%d revoked API key ID=%d", userID, keyID)
+	writeJSON(w, http.StatusOK, map[string]string{"message": "API key revoked"})
+}
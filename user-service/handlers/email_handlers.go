@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"cnad_assignment/user-service/database"
+	"cnad_assignment/user-service/utils"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// RequestEmailChange starts changing the caller's login email. The new address must be
+// confirmed from a link sent to it; the current address is told about the request.
+func RequestEmailChange(w http.ResponseWriter, r *http.Request) {
+	userID, ok := authorizeAccount(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	var request struct {
+		NewEmail string `json:"new_email"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+	newEmail := strings.TrimSpace(request.NewEmail)
+	if !utils.ValidateEmail(newEmail) {
+		writeError(w, http.StatusBadRequest, "Invalid email address")
+		return
+	}
+
+	// Re-check the password so a stolen access token cannot take over the account
+	var currentEmail, passwordHash string
+	err := database.DB.QueryRow("SELECT COALESCE(email, ''), password FROM users WHERE id = ?", userID).Scan(&currentEmail, &passwordHash)
+	if err != nil {
+		log.Printf("Error fetching user ID=%d for email change: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to change email")
+		return
+	}
+	if !utils.CheckPasswordHash(request.Password, passwordHash) {
+		writeError(w, http.StatusUnauthorized, "Incorrect password")
+		return
+	}
+	if strings.EqualFold(newEmail, currentEmail) {
+		writeError(w, http.StatusBadRequest, "That is already your email address")
+		return
+	}
+
+	inUse, err := database.EmailInUse(newEmail)
+	if err != nil {
+		log.Printf("Error checking email availability: %v", err)
+		writeError(w, http.StatusInternalServerError, "Failed to change email")
+		return
+	}
+	if inUse {
+		writeError(w, http.StatusConflict, "Email already registered")
+		return
+	}
+
+	token, err := utils.GenerateVerificationToken()
+	if err != nil {
+		log.Printf("Error generating email change token: %v", err)
+		writeError(w, http.StatusInternalServerError, "Failed to change email")
+		return
+	}
+
+	expiresAt := time.Now().Add(utils.EmailChangeTokenTTL)
+	if err := database.CreateEmailChangeRequest(userID, newEmail, utils.HashToken(token), expiresAt); err != nil {
+		log.Printf("Error storing email change for user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to change email")
+		return
+	}
+
+	confirmLink := fmt.Sprintf("http://localhost:8081/api/v1/users/email/confirm?token=%s", token)
+	if err := utils.SendEmailChangeConfirmation(newEmail, confirmLink); err != nil {
+		log.Printf("Error sending email change confirmation: %v", err)
+		writeError(w, http.StatusInternalServerError, "Failed to send confirmation email")
+		return
+	}
+	if currentEmail != "" {
+		if err := utils.SendEmailChangeNotice(currentEmail, newEmail); err != nil {
+			log.Printf("Error sending email change notice to user ID=%d: %v", userID, err)
+		}
+	}
+
+	log.Printf("Email change requested for user ID=%d", userID)
+	writeJSON(w, http.StatusAccepted, map[string]string{
+		"message": "Check your new email address for a confirmation link. Your email will change once it is confirmed.",
+	})
+}
+
+// ConfirmEmailChange swaps the account's email for the new address using the emailed link
+func ConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		writeError(w, http.StatusBadRequest, "Missing token")
+		return
+	}
+
+	change, err := database.ConfirmEmailChange(utils.HashToken(token))
+	if err == database.ErrEmailChangeInvalid {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err == database.ErrEmailTaken {
+		writeError(w, http.StatusConflict, "Email already registered")
+		return
+	}
+	if err != nil {
+		log.Printf("Error confirming email change: %v", err)
+		writeError(w, http.StatusInternalServerError, "Failed to change email")
+		return
+	}
+
+	details := fmt.Sprintf("changed from %q to %q", change.OldEmail, change.NewEmail)
+	if err := database.RecordSecurityEvent(change.UserID, database.SecurityEventEmailChanged, clientIP(r), details); err != nil {
+		log.Printf("Error recording email change of user ID=%d: %v", change.UserID, err)
+	}
+
+	log.Printf("Email changed for user ID=%d", change.UserID)
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Email address updated", "email": change.NewEmail})
+}
@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"cnad_assignment/shared/auth"
+	"cnad_assignment/user-service/database"
+	"cnad_assignment/user-service/models"
+	"cnad_assignment/user-service/utils"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// dateLayout is the format of licence expiry dates and dates of birth
+const dateLayout = "2006-01-02"
+
+// SubmitLicence uploads the caller's driver licence for review. It takes a multipart form
+// with licence_number, issuing_country, expiry_date, date_of_birth and a document file.
+// Resubmitting replaces the previous licence and puts it back into review.
+func SubmitLicence(w http.ResponseWriter, r *http.Request) {
+	userID, ok := authorizeAccount(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, utils.MaxLicenceDocumentSize+1<<20)
+	if err := r.ParseMultipartForm(utils.MaxLicenceDocumentSize); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid form or document larger than 5 MB")
+		return
+	}
+
+	licence := models.DriverLicence{
+		UserID:         userID,
+		LicenceNumber:  strings.TrimSpace(r.FormValue("licence_number")),
+		IssuingCountry: strings.ToUpper(strings.TrimSpace(r.FormValue("issuing_country"))),
+	}
+	if licence.LicenceNumber == "" || len(licence.LicenceNumber) > 50 {
+		writeError(w, http.StatusBadRequest, "Licence number is required")
+		return
+	}
+	if !utils.ValidateCountryCode(licence.IssuingCountry) {
+		writeError(w, http.StatusBadRequest, "Issuing country must be a two-letter country code, e.g. SG")
+		return
+	}
+
+	var err error
+	if licence.ExpiryDate, err = time.ParseInLocation(dateLayout, r.FormValue("expiry_date"), time.Local); err != nil {
+		writeError(w, http.StatusBadRequest, "Expiry date must be in YYYY-MM-DD format")
+		return
+	}
+	if licence.DateOfBirth, err = time.ParseInLocation(dateLayout, r.FormValue("date_of_birth"), time.Local); err != nil {
+		writeError(w, http.StatusBadRequest, "Date of birth must be in YYYY-MM-DD format")
+		return
+	}
+	if licence.ExpiryDate.Before(time.Now()) {
+		writeError(w, http.StatusBadRequest, "Licence has expired")
+		return
+	}
+	if utils.AgeOn(licence.DateOfBirth, time.Now()) < utils.MinDriverAge {
+		writeError(w, http.StatusBadRequest, "Drivers must be at least 18 years old")
+		return
+	}
+
+	file, _, err := r.FormFile("document")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "A scan of the licence is required")
+		return
+	}
+	defer file.Close()
+
+	licence.DocumentRef, err = utils.SaveLicenceDocument(file)
+	if err == utils.ErrUnsupportedDocument {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Error saving licence document for user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to save licence document")
+		return
+	}
+
+	previousDocument, err := database.SubmitLicence(licence)
+	if err != nil {
+		log.Printf("Error storing licence for user ID=%d: %v", userID, err)
+		utils.RemoveLicenceDocument(licence.DocumentRef)
+		writeError(w, http.StatusInternalServerError, "Failed to submit licence")
+		return
+	}
+	if previousDocument != "" {
+		if err := utils.RemoveLicenceDocument(previousDocument); err != nil {
+			log.Printf("Error removing replaced licence document of user ID=%d: %v", userID, err)
+		}
+	}
+
+	log.Printf("Licence submitted for review by user ID=%d", userID)
+	writeJSON(w, http.StatusAccepted, map[string]string{
+		"message": "Licence submitted. You can book once it has been approved.",
+		"status":  models.LicenceStatusPending,
+	})
+}
+
+// GetLicence returns the caller's licence and its review status
+func GetLicence(w http.ResponseWriter, r *http.Request) {
+	userID, ok := authorizeAccount(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	licence, err := database.FetchLicence(userID)
+	if err == database.ErrLicenceNotFound {
+		writeError(w, http.StatusNotFound, "No licence submitted")
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching licence of user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to fetch licence")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, licence)
+}
+
+// AdminListLicences returns licences in a review state, pending ones by default
+func AdminListLicences(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = models.LicenceStatusPending
+	}
+	if status != models.LicenceStatusPending && status != models.LicenceStatusApproved && status != models.LicenceStatusRejected {
+		writeError(w, http.StatusBadRequest, "status must be pending, approved or rejected")
+		return
+	}
+
+	licences, err := database.FetchLicencesByStatus(status)
+	if err != nil {
+		log.Printf("Error fetching %s licences: %v", status, err)
+		writeError(w, http.StatusInternalServerError, "Failed to fetch licences")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, licences)
+}
+
+// AdminGetLicenceDocument serves the uploaded licence scan of a user to a reviewer
+func AdminGetLicenceDocument(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || userID <= 0 {
+		writeError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	licence, err := database.FetchLicence(userID)
+	if err == database.ErrLicenceNotFound {
+		writeError(w, http.StatusNotFound, "No licence submitted")
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching licence of user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to fetch licence")
+		return
+	}
+
+	path, err := utils.LicenceDocumentPath(licence.DocumentRef)
+	if err != nil {
+		log.Printf("Licence of user ID=%d has an invalid document reference: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to fetch licence document")
+		return
+	}
+
+	log.Printf("User ID=%d viewed the licence document of user ID=%d", auth.UserID(r), userID)
+	w.Header().Set("Cache-Control", "no-store")
+	http.ServeFile(w, r, path)
+}
+
+// AdminReviewLicence approves or rejects a pending licence
+func AdminReviewLicence(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || userID <= 0 {
+		writeError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	var request struct {
+		Status string `json:"status"`
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+	if request.Status != models.LicenceStatusApproved && request.Status != models.LicenceStatusRejected {
+		writeError(w, http.StatusBadRequest, "status must be approved or rejected")
+		return
+	}
+	if request.Status == models.LicenceStatusRejected && strings.TrimSpace(request.Reason) == "" {
+		writeError(w, http.StatusBadRequest, "A reason is required when rejecting a licence")
+		return
+	}
+	if request.Status == models.LicenceStatusApproved {
+		request.Reason = ""
+	}
+
+	err = database.ReviewLicence(userID, request.Status, strings.TrimSpace(request.Reason), auth.UserID(r))
+	if err == database.ErrLicenceNotFound {
+		writeError(w, http.StatusNotFound, "No pending licence for this user")
+		return
+	}
+	if err != nil {
+		log.Printf("Error reviewing licence of user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to review licence")
+		return
+	}
+
+	log.Printf("User ID=%d %s the licence of user ID=%d", auth.UserID(r), request.Status, userID)
+	writeJSON(w, http.StatusOK, map[string]string{"status": request.Status})
+}
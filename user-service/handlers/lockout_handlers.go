@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"cnad_assignment/user-service/database"
+	"cnad_assignment/user-service/utils"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// checkLoginThrottle enforces the per-IP failure limit and the progressive delay between
+// attempts for one email or phone. On rejection it writes a 429 response and returns false.
+func checkLoginThrottle(w http.ResponseWriter, identifier, ipAddress string) bool {
+	throttle, err := database.GetLoginThrottle(identifier, ipAddress, time.Now().Add(-utils.LoginFailureWindow))
+	if err != nil {
+		log.Printf("Error checking login throttle: %v", err)
+		writeError(w, http.StatusInternalServerError, "Failed to log in")
+		return false
+	}
+
+	if throttle.IPFailures >= utils.LoginMaxFailuresPerIP {
+		log.Printf("Login throttled for IP %s after %d failures", ipAddress, throttle.IPFailures)
+		writeLoginThrottled(w, utils.LoginFailureWindow)
+		return false
+	}
+
+	if throttle.LastFailureAt != nil {
+		if wait := utils.LoginDelay(throttle.IdentifierFailures) - time.Since(*throttle.LastFailureAt); wait > 0 {
+			writeLoginThrottled(w, wait)
+			return false
+		}
+	}
+	return true
+}
+
+// writeLoginThrottled tells the client how long to wait before the next login attempt
+func writeLoginThrottled(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", fmt.Sprint(int(wait.Seconds())+1))
+	writeError(w, http.StatusTooManyRequests, "Too many failed login attempts. Please wait before trying again.")
+}
+
+// recordFailedLogin stores a failed attempt and locks the account once it reaches the
+// lockout threshold. userID is 0 when no account matched. It reports whether the account
+// is now locked.
+func recordFailedLogin(r *http.Request, identifier string, userID int, email string) bool {
+	ipAddress := clientIP(r)
+	if err := database.RecordLoginFailure(identifier, ipAddress, userID); err != nil {
+		log.Printf("Error recording failed login: %v", err)
+	}
+	if userID == 0 {
+		return false
+	}
+
+	throttle, err := database.GetLoginThrottle(identifier, ipAddress, time.Now().Add(-utils.LoginFailureWindow))
+	if err != nil {
+		log.Printf("Error counting failed logins for user ID=%d: %v", userID, err)
+		return false
+	}
+	if throttle.IdentifierFailures < utils.LoginLockoutThreshold {
+		return false
+	}
+
+	locked, err := database.LockAccount(userID, time.Now().Add(utils.LoginLockoutDuration))
+	if err != nil {
+		log.Printf("Error locking account of user ID=%d: %v", userID, err)
+		return false
+	}
+	if !locked {
+		// Another request already locked the account and notified the user
+		return true
+	}
+
+	log.Printf("Account of user ID=%d locked after %d failed logins", userID, throttle.IdentifierFailures)
+	details := fmt.Sprintf("%d failed logins for %s", throttle.IdentifierFailures, identifier)
+	if err := database.RecordSecurityEvent(userID, database.SecurityEventAccountLocked, ipAddress, details); err != nil {
+		log.Printf("Error recording lockout of user ID=%d: %v", userID, err)
+	}
+
+	if email != "" {
+		sendUnlockEmail(userID, email)
+	}
+	return true
+}
+
+// sendUnlockEmail emails the user a link that lifts the lockout early
+func sendUnlockEmail(userID int, email string) {
+	token, err := utils.GenerateVerificationToken()
+	if err != nil {
+		log.Printf("Error generating unlock token: %v", err)
+		return
+	}
+
+	if err := database.CreateUnlockToken(userID, utils.HashToken(token), time.Now().Add(utils.UnlockTokenTTL)); err != nil {
+		log.Printf("Error storing unlock token for user ID=%d: %v", userID, err)
+		return
+	}
+
+	unlockLink := fmt.Sprintf("http://localhost:8081/unlock-account.html?token=%s", token)
+	if err := utils.SendAccountLockedEmail(email, unlockLink); err != nil {
+		log.Printf("Error sending unlock email to user ID=%d: %v", userID, err)
+	}
+}
+
+// writeAccountLocked tells the client the account is locked and until when
+func writeAccountLocked(w http.ResponseWriter, lockedUntil time.Time) {
+	w.Header().Set("Retry-After", fmt.Sprint(int(time.Until(lockedUntil).Seconds())+1))
+	writeError(w, http.StatusLocked, "Account temporarily locked after too many failed login attempts. Check your email for an unlock link.")
+}
+
+// UnlockAccount lifts a lockout using the token from the link emailed when the account was
+// locked. The link opens a confirmation page that posts here, so merely fetching the link
+// does not unlock the account.
+func UnlockAccount(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Token == "" {
+		writeError(w, http.StatusBadRequest, "Missing token")
+		return
+	}
+
+	userID, err := database.UnlockAccount(utils.HashToken(request.Token))
+	if err == database.ErrUnlockTokenInvalid {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Error unlocking account: %v", err)
+		writeError(w, http.StatusInternalServerError, "Failed to unlock account")
+		return
+	}
+
+	if err := database.RecordSecurityEvent(userID, database.SecurityEventAccountUnlocked, clientIP(r), "unlocked by email link"); err != nil {
+		log.Printf("Error recording unlock of user ID=%d: %v", userID, err)
+	}
+
+	log.Printf("Account of user ID=%d unlocked by email link", userID)
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Account unlocked. You can log in again."})
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"cnad_assignment/user-service/database"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// GetPointsBalance returns the caller's loyalty points balance
+func GetPointsBalance(w http.ResponseWriter, r *http.Request) {
+	userID, ok := authorizeAccount(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	balance, err := database.FetchPointsBalance(userID)
+	if err != nil {
+		log.Printf("Error fetching points balance of user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to fetch points balance")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]int{"balance": balance})
+}
+
+// GetPointsHistory returns every loyalty points entry of the caller
+func GetPointsHistory(w http.ResponseWriter, r *http.Request) {
+	userID, ok := authorizeAccount(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	entries, err := database.FetchPointsLedger(userID)
+	if err != nil {
+		log.Printf("Error fetching points history of user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to fetch points history")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, entries)
+}
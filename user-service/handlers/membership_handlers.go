@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"cnad_assignment/user-service/database"
+	"cnad_assignment/user-service/models"
+	"cnad_assignment/user-service/utils"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// membershipPaymentURL is where the client pays for a pending upgrade or renewal
+const membershipPaymentURL = utils.BillingServiceURL + "/api/v1/payment/membership"
+
+// UpdateUserMembership requests a move to another membership tier. Upgrades take effect
+// once they are paid through billing-service; downgrades are scheduled for the end of the
+// current billing period. A new request replaces any change still pending. A member whose
+// monthly renewal is unpaid has to pay it before upgrading.
+func UpdateUserMembership(w http.ResponseWriter, r *http.Request) {
+	userID, ok := authorizeAccount(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	var request struct {
+		MembershipTier string `json:"membership_tier"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+
+	target, err := database.FetchTierByName(request.MembershipTier)
+	if err == database.ErrTierNotFound {
+		writeError(w, http.StatusBadRequest, "Invalid membership tier")
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching membership tier %q: %v", request.MembershipTier, err)
+		writeError(w, http.StatusInternalServerError, "Failed to change membership tier")
+		return
+	}
+
+	current, anchor, paidUntil, err := database.FetchUserMembership(userID)
+	if err != nil {
+		log.Printf("Error fetching membership of user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to change membership tier")
+		return
+	}
+	if target.ID == current.ID {
+		writeError(w, http.StatusBadRequest, "You are already on this membership tier")
+		return
+	}
+
+	now := time.Now()
+	if target.Rank > current.Rank {
+		if paidUntil != nil && !paidUntil.After(now) {
+			writeError(w, http.StatusConflict, "Please pay your membership renewal before upgrading")
+			return
+		}
+
+		amount := utils.UpgradeCharge(current, target, anchor, now)
+		changeID, err := database.CreateMembershipChange(userID, current.ID, target.ID, models.MembershipUpgrade,
+			models.MembershipChangePendingPayment, amount, nil)
+		if err != nil {
+			log.Printf("Error creating membership upgrade for user ID=%d: %v", userID, err)
+			writeError(w, http.StatusInternalServerError, "Failed to change membership tier")
+			return
+		}
+
+		log.Printf("User ID=%d requested an upgrade from %s to %s (change ID=%d)", userID, current.Name, target.Name, changeID)
+		writeJSON(w, http.StatusAccepted, map[string]interface{}{
+			"message":     "Pay for the upgrade to activate your new tier.",
+			"change_id":   changeID,
+			"change_type": models.MembershipUpgrade,
+			"to_tier":     target.Name,
+			"amount":      amount,
+			"status":      models.MembershipChangePendingPayment,
+			"payment_url": membershipPaymentURL,
+		})
+		return
+	}
+
+	// Downgrades keep the current benefits until the period already paid for ends
+	effectiveAt := now
+	if paidUntil != nil && paidUntil.After(now) {
+		effectiveAt = *paidUntil
+	}
+	changeID, err := database.CreateMembershipChange(userID, current.ID, target.ID, models.MembershipDowngrade,
+		models.MembershipChangeScheduled, 0, &effectiveAt)
+	if err != nil {
+		log.Printf("Error scheduling membership downgrade for user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to change membership tier")
+		return
+	}
+	if !effectiveAt.After(now) {
+		if _, err := database.ApplyDueMembershipChanges(now); err != nil {
+			log.Printf("Error applying membership downgrade for user ID=%d: %v", userID, err)
+		}
+	}
+
+	log.Printf("User ID=%d scheduled a downgrade from %s to %s at %s (change ID=%d)", userID, current.Name, target.Name,
+		effectiveAt.Format(time.RFC3339), changeID)
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{
+		"message":      "Your membership will change at the end of the current billing period.",
+		"change_id":    changeID,
+		"change_type":  models.MembershipDowngrade,
+		"to_tier":      target.Name,
+		"status":       models.MembershipChangeScheduled,
+		"effective_at": effectiveAt,
+	})
+}
+
+// GetUserMembership returns the caller's tier, current billing period, how long it is paid
+// for and any change still waiting for payment or for the period to end
+func GetUserMembership(w http.ResponseWriter, r *http.Request) {
+	userID, ok := authorizeAccount(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	tier, anchor, paidUntil, err := database.FetchUserMembership(userID)
+	if err != nil {
+		log.Printf("Error fetching membership of user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to fetch membership")
+		return
+	}
+
+	changes, err := database.FetchMembershipChanges(userID)
+	if err != nil {
+		log.Printf("Error fetching membership changes of user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to fetch membership")
+		return
+	}
+
+	response := map[string]interface{}{"tier": tier}
+	if anchor != nil {
+		_, periodEnd := utils.MembershipPeriod(*anchor, time.Now())
+		response["current_period_end"] = periodEnd
+		response["paid_until"] = paidUntil
+	}
+	for _, change := range changes {
+		if change.Status == models.MembershipChangePendingPayment || change.Status == models.MembershipChangeScheduled {
+			response["pending_change"] = change
+			break
+		}
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// CancelMembershipChange withdraws the caller's unpaid upgrade or scheduled downgrade
+func CancelMembershipChange(w http.ResponseWriter, r *http.Request) {
+	userID, ok := authorizeAccount(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	err := database.CancelMembershipChange(userID)
+	if err == database.ErrMembershipChangeNotFound {
+		writeError(w, http.StatusNotFound, "No pending membership change")
+		return
+	}
+	if err != nil {
+		log.Printf("Error canceling membership change of user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to cancel membership change")
+		return
+	}
+
+	log.Printf("User ID=%d canceled their pending membership change", userID)
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Membership change canceled"})
+}
+
+// GetMembershipHistory returns every tier change the caller has requested
+func GetMembershipHistory(w http.ResponseWriter, r *http.Request) {
+	userID, ok := authorizeAccount(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	changes, err := database.FetchMembershipChanges(userID)
+	if err != nil {
+		log.Printf("Error fetching membership changes of user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to fetch membership history")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, changes)
+}
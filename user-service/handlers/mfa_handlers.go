@@ -0,0 +1,415 @@
+package handlers
+
+import (
+	"cnad_assignment/shared/auth"
+	"cnad_assignment/user-service/database"
+	"cnad_assignment/user-service/utils"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// authenticateMFAEnrolment accepts either a normal access token or an MFA setup token,
+// so users who are forced into MFA can enrol before they have a session.
+// The returned flag is true when the caller used a setup token.
+func authenticateMFAEnrolment(r *http.Request) (int, bool, error) {
+	if userID, err := utils.ValidateJWT(r); err == nil {
+		return userID, false, nil
+	}
+
+	tokenString, err := auth.BearerToken(r)
+	if err != nil {
+		return 0, false, err
+	}
+
+	userID, _, err := utils.ParseMFAToken(tokenString, utils.MFAPurposeSetup)
+	if err != nil {
+		return 0, false, err
+	}
+	return userID, true, nil
+}
+
+// verifySecondFactor checks a TOTP code, or a recovery code when no TOTP code is given
+func verifySecondFactor(userID int, secret, code, recoveryCode string) (bool, error) {
+	if code != "" {
+		step, ok := utils.ValidateTOTP(secret, code, time.Now())
+		if !ok {
+			return false, nil
+		}
+		return database.ConsumeTOTPStep(userID, step)
+	}
+
+	if recoveryCode != "" {
+		hash := utils.HashToken(utils.NormalizeRecoveryCode(recoveryCode))
+		return database.ConsumeRecoveryCode(userID, hash)
+	}
+
+	return false, nil
+}
+
+// newRecoveryCodes generates recovery codes and their digests for storage
+func newRecoveryCodes() ([]string, []string, error) {
+	codes, err := utils.GenerateRecoveryCodes(utils.RecoveryCodeCount)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = utils.HashToken(code)
+	}
+	return codes, hashes, nil
+}
+
+// SetupMFA generates a new TOTP secret for the user and returns its provisioning URI.
+// MFA stays disabled until the user confirms a code from their authenticator app.
+func SetupMFA(w http.ResponseWriter, r *http.Request) {
+	userID, _, err := authenticateMFAEnrolment(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	state, err := database.GetMFAState(userID)
+	if err != nil {
+		log.Printf("Error fetching MFA state for user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to set up MFA")
+		return
+	}
+	if state.Enabled {
+		writeError(w, http.StatusConflict, "MFA is already enabled")
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		log.Printf("Error generating TOTP secret: %v", err)
+		writeError(w, http.StatusInternalServerError, "Failed to set up MFA")
+		return
+	}
+
+	if err := database.SetPendingMFASecret(userID, secret); err != nil {
+		log.Printf("Error storing TOTP secret for user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to set up MFA")
+		return
+	}
+
+	log.Printf("MFA enrolment started for user ID=%d", userID)
+	writeJSON(w, http.StatusOK, map[string]string{
+		"secret":           secret,
+		"provisioning_uri": utils.TOTPProvisioningURI(secret, state.Email),
+	})
+}
+
+// ConfirmMFA enables MFA once the user proves their authenticator produces valid codes,
+// and returns the one-time recovery codes. Users enrolling with a setup token are
+// logged in as part of the response.
+func ConfirmMFA(w http.ResponseWriter, r *http.Request) {
+	userID, pendingSetup, err := authenticateMFAEnrolment(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var request struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Code == "" {
+		writeError(w, http.StatusBadRequest, "Code is required")
+		return
+	}
+
+	state, err := database.GetMFAState(userID)
+	if err != nil {
+		log.Printf("Error fetching MFA state for user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to confirm MFA")
+		return
+	}
+	if state.Enabled {
+		writeError(w, http.StatusConflict, "MFA is already enabled")
+		return
+	}
+	if state.Secret == "" {
+		writeError(w, http.StatusBadRequest, "MFA setup has not been started")
+		return
+	}
+	if pendingSetup && state.Suspended {
+		writeAccountSuspended(w, userID)
+		return
+	}
+
+	step, ok := utils.ValidateTOTP(state.Secret, request.Code, time.Now())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Invalid code")
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		log.Printf("Error generating recovery codes: %v", err)
+		writeError(w, http.StatusInternalServerError, "Failed to confirm MFA")
+		return
+	}
+
+	if err := database.EnableMFA(userID, step, hashes); err != nil {
+		log.Printf("Error enabling MFA for user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to confirm MFA")
+		return
+	}
+	log.Printf("MFA enabled for user ID=%d", userID)
+
+	response := map[string]interface{}{
+		"message":        "MFA enabled. Store your recovery codes somewhere safe; each can be used once.",
+		"recovery_codes": codes,
+	}
+
+	if pendingSetup {
+		tokens, err := startSession(r, userID)
+		if err != nil {
+			log.Printf("Error starting session: %v", err)
+			writeError(w, http.StatusInternalServerError, "Failed to generate token")
+			return
+		}
+		response["token"] = tokens.AccessToken
+		response["refresh_token"] = tokens.RefreshToken
+		response["expires_in"] = int(utils.AccessTokenTTL.Seconds())
+		response["userID"] = userID
+		response["name"] = state.Name
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// VerifyMFALogin completes a login with the MFA pending token and a TOTP or recovery code
+func VerifyMFALogin(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		MFAToken     string `json:"mfa_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.MFAToken == "" {
+		writeError(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+
+	userID, issuedAt, err := utils.ParseMFAToken(request.MFAToken, utils.MFAPurposeLogin)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "Invalid or expired MFA token")
+		return
+	}
+
+	// Codes are throttled like passwords, and each pending token allows only a few guesses
+	identifier := utils.MFAAttemptIdentifier(userID)
+	if !checkLoginThrottle(w, identifier, clientIP(r)) {
+		return
+	}
+	failures, err := database.CountLoginFailures(identifier, issuedAt)
+	if err != nil {
+		log.Printf("Error counting failed MFA attempts for user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to verify code")
+		return
+	}
+	if failures >= utils.MFAMaxAttemptsPerToken {
+		writeError(w, http.StatusUnauthorized, "Too many invalid codes. Please log in again.")
+		return
+	}
+
+	state, err := database.GetMFAState(userID)
+	if err != nil {
+		log.Printf("Error fetching MFA state for user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to verify code")
+		return
+	}
+	if !state.Enabled {
+		writeError(w, http.StatusBadRequest, "MFA is not enabled for this account")
+		return
+	}
+	// The account may have been suspended after the password step
+	if state.Suspended {
+		writeAccountSuspended(w, userID)
+		return
+	}
+	if state.LockedUntil != nil {
+		log.Printf("MFA login refused for locked account of user ID=%d", userID)
+		writeAccountLocked(w, *state.LockedUntil)
+		return
+	}
+
+	ok, err := verifySecondFactor(userID, state.Secret, request.Code, request.RecoveryCode)
+	if err != nil {
+		log.Printf("Error verifying second factor for user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to verify code")
+		return
+	}
+	if !ok {
+		log.Printf("Invalid MFA code for user ID=%d", userID)
+		if recordFailedLogin(r, identifier, userID, state.UnlockEmail) {
+			writeAccountLocked(w, time.Now().Add(utils.LoginLockoutDuration))
+			return
+		}
+		if failures+1 >= utils.MFAMaxAttemptsPerToken {
+			writeError(w, http.StatusUnauthorized, "Too many invalid codes. Please log in again.")
+			return
+		}
+		writeError(w, http.StatusUnauthorized, "Invalid code")
+		return
+	}
+
+	if err := database.RecordLoginSuccess(identifier, clientIP(r), userID); err != nil {
+		log.Printf("Error recording successful MFA login: %v", err)
+	}
+	respondWithSession(w, r, userID, state.Name)
+}
+
+// DisableMFA turns MFA off after re-checking the password and a current code.
+// Accounts that are required to use MFA cannot disable it.
+func DisableMFA(w http.ResponseWriter, r *http.Request) {
+	userID, err := utils.ValidateJWT(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var request struct {
+		Password     string `json:"password"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+
+	state, err := database.GetMFAState(userID)
+	if err != nil {
+		log.Printf("Error fetching MFA state for user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to disable MFA")
+		return
+	}
+	if !state.Enabled {
+		writeError(w, http.StatusBadRequest, "MFA is not enabled for this account")
+		return
+	}
+	if state.Required {
+		writeError(w, http.StatusForbidden, "MFA is required for this account")
+		return
+	}
+
+	var passwordHash string
+	if err := database.DB.QueryRow("SELECT password FROM users WHERE id = ?", userID).Scan(&passwordHash); err != nil {
+		log.Printf("Error fetching password for user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to disable MFA")
+		return
+	}
+	if !utils.CheckPasswordHash(request.Password, passwordHash) {
+		writeError(w, http.StatusUnauthorized, "Invalid password")
+		return
+	}
+
+	ok, err := verifySecondFactor(userID, state.Secret, request.Code, request.RecoveryCode)
+	if err != nil {
+		log.Printf("Error verifying second factor for user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to disable MFA")
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Invalid code")
+		return
+	}
+
+	if err := database.DisableMFA(userID); err != nil {
+		log.Printf("Error disabling MFA for user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to disable MFA")
+		return
+	}
+
+	log.Printf("MFA disabled for user ID=%d", userID)
+	writeJSON(w, http.StatusOK, map[string]string{"message": "MFA disabled"})
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after checking a current TOTP code
+func RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	userID, err := utils.ValidateJWT(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var request struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Code == "" {
+		writeError(w, http.StatusBadRequest, "Code is required")
+		return
+	}
+
+	state, err := database.GetMFAState(userID)
+	if err != nil {
+		log.Printf("Error fetching MFA state for user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to regenerate recovery codes")
+		return
+	}
+	if !state.Enabled {
+		writeError(w, http.StatusBadRequest, "MFA is not enabled for this account")
+		return
+	}
+
+	ok, err := verifySecondFactor(userID, state.Secret, request.Code, "")
+	if err != nil {
+		log.Printf("Error verifying TOTP code for user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to regenerate recovery codes")
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Invalid code")
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		log.Printf("Error generating recovery codes: %v", err)
+		writeError(w, http.StatusInternalServerError, "Failed to regenerate recovery codes")
+		return
+	}
+
+	if err := database.ReplaceRecoveryCodes(userID, hashes); err != nil {
+		log.Printf("Error storing recovery codes for user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to regenerate recovery codes")
+		return
+	}
+
+	log.Printf("Recovery codes regenerated for user ID=%d", userID)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"recovery_codes": codes})
+}
+
+// GetMFAStatus reports whether MFA is enabled or required and how many recovery codes remain
+func GetMFAStatus(w http.ResponseWriter, r *http.Request) {
+	userID, err := utils.ValidateJWT(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	state, err := database.GetMFAState(userID)
+	if err != nil {
+		log.Printf("Error fetching MFA state for user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to fetch MFA status")
+		return
+	}
+
+	remaining := 0
+	if state.Enabled {
+		if remaining, err = database.CountUnusedRecoveryCodes(userID); err != nil {
+			log.Printf("Error counting recovery codes for user ID=%d: %v", userID, err)
+			writeError(w, http.StatusInternalServerError, "Failed to fetch MFA status")
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"mfa_enabled":              state.Enabled,
+		"mfa_required":             state.Required,
+		"recovery_codes_remaining": remaining,
+	})
+}
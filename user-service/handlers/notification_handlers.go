@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"cnad_assignment/user-service/database"
+	"cnad_assignment/user-service/models"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// maxWebhookURLLength matches the push_webhook_url column
+const maxWebhookURLLength = 500
+
+// GetNotificationPreferences returns the channels the caller is notified on
+func GetNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	userID, ok := authorizeAccount(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	preferences, err := database.FetchNotificationPreferences(userID)
+	if err != nil {
+		log.Printf("Error fetching notification preferences of user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to fetch notification preferences")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, preferences)
+}
+
+// UpdateNotificationPreferences replaces the channels the caller is notified on. A channel
+// can only be enabled when the account has somewhere to send it: an email address, a
+// phone number or, for push, a webhook URL.
+func UpdateNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	userID, ok := authorizeAccount(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	var preferences models.NotificationPreferences
+	if err := json.NewDecoder(r.Body).Decode(&preferences); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+	preferences.UpdatedAt = nil
+	preferences.PushWebhookURL = strings.TrimSpace(preferences.PushWebhookURL)
+
+	if preferences.PushWebhookURL != "" && !validWebhookURL(preferences.PushWebhookURL) {
+		writeError(w, http.StatusBadRequest, "push_webhook_url must be an https URL")
+		return
+	}
+	if preferences.Push && preferences.PushWebhookURL == "" {
+		writeError(w, http.StatusBadRequest, "push_webhook_url is required to enable push notifications")
+		return
+	}
+
+	account, err := database.FetchAccount(userID)
+	if err != nil {
+		log.Printf("Error fetching account of user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to update notification preferences")
+		return
+	}
+	if preferences.Email && account.Email == "" {
+		writeError(w, http.StatusBadRequest, "Add an email address to your account to enable email notifications")
+		return
+	}
+	if preferences.SMS && account.Phone == "" {
+		writeError(w, http.StatusBadRequest, "Add a phone number to your account to enable SMS notifications")
+		return
+	}
+
+	if err := database.SaveNotificationPreferences(userID, preferences); err != nil {
+		log.Printf("Error saving notification preferences of user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to update notification preferences")
+		return
+	}
+
+	log.Printf("User ID=%d updated notification preferences", userID)
+	writeJSON(w, http.StatusOK, preferences)
+}
+
+// validWebhookURL accepts https URLs, and plain http on localhost for development
+func validWebhookURL(raw string) bool {
+	if len(raw) > maxWebhookURLLength {
+		return false
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Host == "" || parsed.User != nil {
+		return false
+	}
+	switch parsed.Scheme {
+	case "https":
+		return true
+	case "http":
+		host := parsed.Hostname()
+		return host == "localhost" || host == "127.0.0.1"
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"cnad_assignment/user-service/database"
+	"cnad_assignment/user-service/utils"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ForgotPassword emails a single-use password reset link to the account owner.
+// The response is the same whether or not the email is registered, so the endpoint
+// cannot be used to discover accounts.
+func ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || strings.TrimSpace(request.Email) == "" {
+		writeError(w, http.StatusBadRequest, "Email is required")
+		return
+	}
+
+	genericResponse := map[string]string{"message": "If the email is registered, a password reset link has been sent."}
+
+	var userID int
+	err := database.DB.QueryRow("SELECT id FROM users WHERE email = ?", request.Email).Scan(&userID)
+	if err == sql.ErrNoRows {
+		log.Printf("Password reset requested for unknown email: %s", request.Email)
+		writeJSON(w, http.StatusOK, genericResponse)
+		return
+	}
+	if err != nil {
+		log.Printf("Error looking up user for password reset: %v", err)
+		writeError(w, http.StatusInternalServerError, "Failed to process password reset")
+		return
+	}
+
+	// Failures past this point are only logged: an error for a registered email would
+	// reveal that it has an account
+	token, err := utils.GenerateVerificationToken()
+	if err != nil {
+		log.Printf("Error generating reset token: %v", err)
+		writeJSON(w, http.StatusOK, genericResponse)
+		return
+	}
+
+	expiresAt := time.Now().Add(utils.PasswordResetTokenTTL)
+	if err := database.CreatePasswordResetToken(userID, utils.HashToken(token), expiresAt); err != nil {
+		log.Printf("Error storing reset token for user ID=%d: %v", userID, err)
+		writeJSON(w, http.StatusOK, genericResponse)
+		return
+	}
+
+	resetLink := fmt.Sprintf("http://localhost:8081/reset-password.html?token=%s", token)
+	if err := utils.SendPasswordResetEmail(request.Email, resetLink); err != nil {
+		log.Printf("Error sending password reset email to user ID=%d: %v", userID, err)
+		writeJSON(w, http.StatusOK, genericResponse)
+		return
+	}
+
+	log.Printf("Password reset email sent to user ID=%d", userID)
+	writeJSON(w, http.StatusOK, genericResponse)
+}
+
+// ResetPassword sets a new password using a reset token and logs the user out everywhere
+func ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Token       string `json:"token"`
+		NewPassword string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+	if request.Token == "" {
+		writeError(w, http.StatusBadRequest, "Missing token")
+		return
+	}
+	if strings.TrimSpace(request.NewPassword) == "" {
+		writeError(w, http.StatusBadRequest, "Password is required")
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(request.NewPassword)
+	if err != nil {
+		log.Printf("Error hashing password: %v", err)
+		writeError(w, http.StatusInternalServerError, "Error hashing password")
+		return
+	}
+
+	userID, err := database.ResetPassword(utils.HashToken(request.Token), hashedPassword)
+	if err == database.ErrResetTokenInvalid {
+		writeError(w, http.StatusBadRequest, "Invalid or expired reset token")
+		return
+	}
+	if err != nil {
+		log.Printf("Error resetting password: %v", err)
+		writeError(w, http.StatusInternalServerError, "Failed to reset password")
+		return
+	}
+
+	log.Printf("Password reset for user ID=%d, all sessions revoked", userID)
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Password has been reset. Please log in with your new password."})
+}
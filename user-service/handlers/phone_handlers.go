@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"cnad_assignment/user-service/database"
+	"cnad_assignment/user-service/models"
+	"cnad_assignment/user-service/utils"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// errOTPRateLimited is returned by sendOTP when the phone has asked for too many codes
+var errOTPRateLimited = errors.New("too many codes requested")
+
+// sendOTP issues a new one-time code to the phone by SMS. When the phone is rate limited
+// it returns errOTPRateLimited and how long the caller should wait.
+func sendOTP(phone, purpose string) (time.Duration, error) {
+	stats, err := database.GetOTPSendStats(phone, purpose)
+	if err != nil {
+		return 0, err
+	}
+	if stats.LastSentAt != nil {
+		if wait := utils.OTPResendAfter - time.Since(*stats.LastSentAt); wait > 0 {
+			return wait, errOTPRateLimited
+		}
+	}
+	if stats.SentLastHour >= utils.OTPMaxPerHour {
+		return time.Hour, errOTPRateLimited
+	}
+
+	code, err := utils.GenerateOTP()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := database.CreateOTP(phone, purpose, utils.HashToken(code), time.Now().Add(utils.OTPTTL)); err != nil {
+		return 0, err
+	}
+
+	return 0, utils.SendOTP(phone, code)
+}
+
+// writeOTPRateLimited tells the client how long to wait before requesting another code
+func writeOTPRateLimited(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", fmt.Sprint(int(wait.Seconds())+1))
+	writeError(w, http.StatusTooManyRequests, "Too many codes requested. Please try again later.")
+}
+
+// registerWithPhone registers a user who signed up with a phone number instead of an email.
+// The account is verified once the user confirms the code sent to the phone.
+func registerWithPhone(w http.ResponseWriter, user models.User, referralCode string) {
+	user.Phone = utils.NormalizePhone(user.Phone)
+	if !utils.ValidatePhone(user.Phone) {
+		writeError(w, http.StatusBadRequest, "Invalid phone number. Use international format, e.g. +6591234567")
+		return
+	}
+	if strings.TrimSpace(user.Password) == "" {
+		writeError(w, http.StatusBadRequest, "Password is required")
+		return
+	}
+	if strings.TrimSpace(user.Name) == "" {
+		writeError(w, http.StatusBadRequest, "Name is required")
+		return
+	}
+
+	referrer, ok := lookupReferrer(w, referralCode)
+	if !ok {
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(user.Password)
+	if err != nil {
+		log.Printf("Error hashing password: %v", err)
+		writeError(w, http.StatusInternalServerError, "Error hashing password")
+		return
+	}
+
+	query := "INSERT INTO users (phone, password, name) VALUES (?, ?, ?)"
+	result, err := database.DB.Exec(query, user.Phone, hashedPassword, user.Name)
+	if err != nil {
+		log.Printf("Error inserting user into database: %v", err)
+		if database.IsDuplicateEntry(err) {
+			writeError(w, http.StatusConflict, "Phone number already registered")
+		} else {
+			writeError(w, http.StatusInternalServerError, "Failed to register user")
+		}
+		return
+	}
+	userID, _ := result.LastInsertId()
+	setUpReferrals(int(userID), "", user.Phone, referrer)
+
+	if _, err := sendOTP(user.Phone, utils.OTPPurposeVerify); err != nil {
+		log.Printf("Error sending verification code to %s: %v", user.Phone, err)
+		writeError(w, http.StatusInternalServerError, "Failed to send verification code")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]string{
+		"message": "User registered successfully. Please verify your phone with the code we sent.",
+		"phone":   user.Phone,
+	})
+}
+
+// VerifyPhone confirms a phone number with the code sent at registration
+func VerifyPhone(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Phone string `json:"phone"`
+		Code  string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Phone == "" || request.Code == "" {
+		writeError(w, http.StatusBadRequest, "Phone and code are required")
+		return
+	}
+	phone := utils.NormalizePhone(request.Phone)
+
+	err := database.ConsumeOTP(phone, utils.OTPPurposeVerify, utils.HashToken(strings.TrimSpace(request.Code)), utils.OTPMaxAttempts)
+	if err == database.ErrOTPInvalid || err == database.ErrOTPAttemptsExceeded {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Error verifying phone code: %v", err)
+		writeError(w, http.StatusInternalServerError, "Failed to verify phone")
+		return
+	}
+
+	// A verified phone also verifies the account so phone-only users can log in
+	if _, err := database.DB.Exec("UPDATE users SET phone_verified = TRUE, is_verified = TRUE WHERE phone = ?", phone); err != nil {
+		log.Printf("Error updating phone verification status: %v", err)
+		writeError(w, http.StatusInternalServerError, "Failed to verify phone")
+		return
+	}
+
+	log.Printf("Phone %s verified", phone)
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Phone verified successfully"})
+}
+
+// ResendPhoneVerification sends a fresh verification code to an unverified phone
+func ResendPhoneVerification(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Phone string `json:"phone"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Phone == "" {
+		writeError(w, http.StatusBadRequest, "Phone is required")
+		return
+	}
+	phone := utils.NormalizePhone(request.Phone)
+
+	genericResponse := map[string]string{"message": "If the phone is registered and unverified, a new code has been sent."}
+
+	var verified bool
+	err := database.DB.QueryRow("SELECT phone_verified FROM users WHERE phone = ?", phone).Scan(&verified)
+	if err == sql.ErrNoRows || (err == nil && verified) {
+		writeJSON(w, http.StatusOK, genericResponse)
+		return
+	}
+	if err != nil {
+		log.Printf("Error looking up phone: %v", err)
+		writeError(w, http.StatusInternalServerError, "Failed to send code")
+		return
+	}
+
+	wait, err := sendOTP(phone, utils.OTPPurposeVerify)
+	if err == errOTPRateLimited {
+		writeOTPRateLimited(w, wait)
+		return
+	}
+	if err != nil {
+		log.Printf("Error sending verification code to %s: %v", phone, err)
+		writeError(w, http.StatusInternalServerError, "Failed to send code")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, genericResponse)
+}
+
+// RequestLoginOTP sends a one-time login code to a verified phone number
+func RequestLoginOTP(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Phone string `json:"phone"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Phone == "" {
+		writeError(w, http.StatusBadRequest, "Phone is required")
+		return
+	}
+	phone := utils.NormalizePhone(request.Phone)
+
+	genericResponse := map[string]string{"message": "If the phone is registered, a login code has been sent."}
+
+	var userID int
+	err := database.DB.QueryRow("SELECT id FROM users WHERE phone = ? AND phone_verified = TRUE", phone).Scan(&userID)
+	if err == sql.ErrNoRows {
+		writeJSON(w, http.StatusOK, genericResponse)
+		return
+	}
+	if err != nil {
+		log.Printf("Error looking up phone: %v", err)
+		writeError(w, http.StatusInternalServerError, "Failed to send code")
+		return
+	}
+
+	wait, err := sendOTP(phone, utils.OTPPurposeLogin)
+	if err == errOTPRateLimited {
+		writeOTPRateLimited(w, wait)
+		return
+	}
+	if err != nil {
+		log.Printf("Error sending login code to user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to send code")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, genericResponse)
+}
+
+// VerifyLoginOTP logs a user in with the code sent to their phone
+func VerifyLoginOTP(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Phone string `json:"phone"`
+		Code  string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Phone == "" || request.Code == "" {
+		writeError(w, http.StatusBadRequest, "Phone and code are required")
+		return
+	}
+	phone := utils.NormalizePhone(request.Phone)
+
+	err := database.ConsumeOTP(phone, utils.OTPPurposeLogin, utils.HashToken(strings.TrimSpace(request.Code)), utils.OTPMaxAttempts)
+	if err == database.ErrOTPInvalid || err == database.ErrOTPAttemptsExceeded {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Error verifying login code: %v", err)
+		writeError(w, http.StatusInternalServerError, "Failed to verify code")
+		return
+	}
+
+	var user models.User
+	var suspendedAt sql.NullTime
+	query := "SELECT id, name, mfa_enabled, mfa_required, suspended_at FROM users WHERE phone = ? AND phone_verified = TRUE"
+	if err := database.DB.QueryRow(query, phone).Scan(&user.ID, &user.Name, &user.MFAEnabled, &user.MFARequired, &suspendedAt); err != nil {
+		log.Printf("Error fetching user for phone login: %v", err)
+		writeError(w, http.StatusUnauthorized, "Invalid or expired code")
+		return
+	}
+	if suspendedAt.Valid {
+		user.SuspendedAt = &suspendedAt.Time
+	}
+
+	completeLogin(w, r, user)
+}
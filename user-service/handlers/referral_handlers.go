@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"cnad_assignment/user-service/database"
+	"cnad_assignment/user-service/models"
+	"cnad_assignment/user-service/utils"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// referralCodeAttempts bounds retries when a generated referral code is already taken
+const referralCodeAttempts = 5
+
+// referralCode returns the user's referral code, assigning one on first use
+func referralCode(userID int) (string, error) {
+	code, err := database.FetchReferralCode(userID)
+	if err != nil || code != "" {
+		return code, err
+	}
+
+	for attempt := 0; attempt < referralCodeAttempts; attempt++ {
+		candidate, err := utils.GenerateReferralCode()
+		if err != nil {
+			return "", err
+		}
+		err = database.SetReferralCode(userID, candidate)
+		if database.IsDuplicateEntry(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		break
+	}
+
+	// Re-read in case a concurrent request assigned a different code first
+	return database.FetchReferralCode(userID)
+}
+
+// lookupReferrer resolves the referral code given at registration. An empty code means the
+// user was not referred; an unknown one has already been answered with an error.
+func lookupReferrer(w http.ResponseWriter, code string) (*models.Referrer, bool) {
+	code = utils.NormalizeReferralCode(code)
+	if code == "" {
+		return nil, true
+	}
+
+	referrer, err := database.FetchReferrerByCode(code)
+	if err == database.ErrReferralCodeNotFound {
+		writeError(w, http.StatusBadRequest, "Invalid referral code")
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("Error looking up referral code %q: %v", code, err)
+		writeError(w, http.StatusInternalServerError, "Failed to register user")
+		return nil, false
+	}
+	return &referrer, true
+}
+
+// setUpReferrals gives a newly registered user their own referral code and records the
+// referral they signed up with, if any. Failures are logged rather than failing the
+// registration that already succeeded.
+func setUpReferrals(userID int, email, phone string, referrer *models.Referrer) {
+	if _, err := referralCode(userID); err != nil {
+		log.Printf("Error assigning referral code to user ID=%d: %v", userID, err)
+	}
+	if referrer == nil {
+		return
+	}
+
+	status, reason := models.ReferralPending, ""
+	sameEmail := email != "" && referrer.Email != "" && utils.CanonicalMailbox(email) == utils.CanonicalMailbox(referrer.Email)
+	samePhone := phone != "" && referrer.Phone != "" && phone == referrer.Phone
+	if sameEmail || samePhone {
+		status, reason = models.ReferralRejected, database.ReferralRejectedSelf
+	}
+
+	if err := database.CreateReferral(referrer.ID, userID, status, reason); err != nil {
+		log.Printf("Error recording referral of user ID=%d by user ID=%d: %v", userID, referrer.ID, err)
+		return
+	}
+	log.Printf("User ID=%d signed up with the referral code of user ID=%d (%s)", userID, referrer.ID, status)
+}
+
+// GetReferrals returns the caller's referral code and how the referrals made with it went
+func GetReferrals(w http.ResponseWriter, r *http.Request) {
+	userID, ok := authorizeAccount(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	code, err := referralCode(userID)
+	if err != nil {
+		log.Printf("Error fetching referral code of user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to fetch referrals")
+		return
+	}
+
+	referrals, err := database.FetchReferralsByReferrer(userID)
+	if err != nil {
+		log.Printf("Error fetching referrals of user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to fetch referrals")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"referral_code":   code,
+		"referrer_credit": utils.ReferrerCreditPoints,
+		"referred_credit": utils.ReferredCreditPoints,
+		"referrals":       referrals,
+	})
+}
+
+// AdminReferralReport summarises referral conversions per referrer. The optional from and
+// to query parameters (YYYY-MM-DD, both inclusive) limit it to referrals created in that range.
+func AdminReferralReport(w http.ResponseWriter, r *http.Request) {
+	from := time.Time{}
+	to := time.Now().AddDate(0, 0, 1)
+	if value := r.URL.Query().Get("from"); value != "" {
+		parsed, err := time.Parse(dateLayout, value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "from must be a date in YYYY-MM-DD format")
+			return
+		}
+		from = parsed
+	}
+	if value := r.URL.Query().Get("to"); value != "" {
+		parsed, err := time.Parse(dateLayout, value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "to must be a date in YYYY-MM-DD format")
+			return
+		}
+		to = parsed.AddDate(0, 0, 1)
+	}
+	if !to.After(from) {
+		writeError(w, http.StatusBadRequest, "from must not be after to")
+		return
+	}
+
+	conversions, err := database.FetchReferralConversions(from, to)
+	if err != nil {
+		log.Printf("Error fetching referral conversions: %v", err)
+		writeError(w, http.StatusInternalServerError, "Failed to fetch referral report")
+		return
+	}
+
+	var referrals, rewarded int
+	for _, c := range conversions {
+		referrals += c.Referrals
+		rewarded += c.Rewarded
+	}
+	conversionRate := 0.0
+	if referrals > 0 {
+		conversionRate = float64(rewarded) / float64(referrals)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"referrals":       referrals,
+		"rewarded":        rewarded,
+		"conversion_rate": conversionRate,
+		"referrers":       conversions,
+	})
+}
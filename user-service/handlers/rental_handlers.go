@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"cnad_assignment/shared/auth"
+	"cnad_assignment/user-service/models"
+	"cnad_assignment/user-service/utils"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// paymentUnpaid is the payment status of rentals nothing has been paid for yet
+const paymentUnpaid = "unpaid"
+
+// GetRentalHistory returns the caller's rentals, newest first, each with its cost, invoice
+// and payment status. Bookings come from vehicle-service and billing from billing-service.
+// from and to (YYYY-MM-DD, inclusive) filter on the rental start date and status on the
+// booking status; page and page_size select the page.
+func GetRentalHistory(w http.ResponseWriter, r *http.Request) {
+	userID, ok := authorizeAccount(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	params := r.URL.Query()
+	var from, to time.Time
+	if value := params.Get("from"); value != "" {
+		parsed, err := time.ParseInLocation(dateLayout, value, time.Local)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "from must be a date in YYYY-MM-DD format")
+			return
+		}
+		from = parsed
+	}
+	if value := params.Get("to"); value != "" {
+		parsed, err := time.ParseInLocation(dateLayout, value, time.Local)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "to must be a date in YYYY-MM-DD format")
+			return
+		}
+		to = parsed.AddDate(0, 0, 1)
+	}
+	if !from.IsZero() && !to.IsZero() && !to.After(from) {
+		writeError(w, http.StatusBadRequest, "from must not be after to")
+		return
+	}
+	status := params.Get("status")
+
+	page, pageSize, ok := parsePagination(w, r)
+	if !ok {
+		return
+	}
+
+	// Other services are asked on the caller's behalf so they apply their own access checks
+	accessToken, _ := auth.BearerToken(r)
+
+	var bookings []struct {
+		BookingID          int       `json:"booking_id"`
+		StartTime          time.Time `json:"start_time"`
+		EndTime            time.Time `json:"end_time"`
+		Status             string    `json:"status"`
+		Make               string    `json:"make"`
+		Model              string    `json:"model"`
+		RegistrationNumber string    `json:"registration_number"`
+	}
+	bookingsURL := fmt.Sprintf("%s/api/v1/users/%d/rental-history", utils.VehicleServiceURL, userID)
+	if err := utils.FetchFromService(bookingsURL, accessToken, &bookings); err != nil {
+		log.Printf("Error fetching bookings of user ID=%d: %v", userID, err)
+		writeError(w, http.StatusBadGateway, "Failed to fetch rental history")
+		return
+	}
+
+	var billing struct {
+		Payments []struct {
+			ID             int     `json:"id"`
+			BookingID      int     `json:"booking_id"`
+			PaymentMethod  string  `json:"payment_method"`
+			PaymentStatus  string  `json:"payment_status"`
+			PointsDiscount float64 `json:"points_discount"`
+		} `json:"payments"`
+		Invoices []struct {
+			ID             int     `json:"id"`
+			BookingID      int     `json:"booking_id"`
+			Amount         float64 `json:"amount"`
+			PaymentStatus  string  `json:"payment_status"`
+			PointsDiscount float64 `json:"points_discount"`
+		} `json:"invoices"`
+	}
+	if err := utils.FetchFromService(utils.BillingServiceURL+"/api/v1/billing/history", accessToken, &billing); err != nil {
+		log.Printf("Error fetching billing history of user ID=%d: %v", userID, err)
+		writeError(w, http.StatusBadGateway, "Failed to fetch rental history")
+		return
+	}
+
+	rentals := []models.Rental{}
+	byBooking := map[int]*models.Rental{}
+	for _, booking := range bookings {
+		if (!from.IsZero() && booking.StartTime.Before(from)) || (!to.IsZero() && !booking.StartTime.Before(to)) {
+			continue
+		}
+		if status != "" && booking.Status != status {
+			continue
+		}
+		rentals = append(rentals, models.Rental{
+			BookingID:          booking.BookingID,
+			Make:               booking.Make,
+			Model:              booking.Model,
+			RegistrationNumber: booking.RegistrationNumber,
+			StartTime:          booking.StartTime,
+			EndTime:            booking.EndTime,
+			Status:             booking.Status,
+			PaymentStatus:      paymentUnpaid,
+		})
+	}
+	for i := range rentals {
+		byBooking[rentals[i].BookingID] = &rentals[i]
+	}
+
+	// Billing-service lists newest first, so the first payment and invoice seen for a booking are the latest
+	for _, payment := range billing.Payments {
+		rental, ok := byBooking[payment.BookingID]
+		if !ok || rental.PaymentID != 0 {
+			continue
+		}
+		rental.PaymentID = payment.ID
+		rental.PaymentMethod = payment.PaymentMethod
+		rental.PaymentStatus = payment.PaymentStatus
+		rental.PointsDiscount = payment.PointsDiscount
+	}
+	for _, invoice := range billing.Invoices {
+		rental, ok := byBooking[invoice.BookingID]
+		if !ok || rental.InvoiceID != 0 {
+			continue
+		}
+		cost := invoice.Amount
+		rental.Cost = &cost
+		rental.InvoiceID = invoice.ID
+		rental.InvoiceStatus = invoice.PaymentStatus
+		rental.PointsDiscount = invoice.PointsDiscount
+	}
+
+	sort.SliceStable(rentals, func(i, j int) bool {
+		if rentals[i].StartTime.Equal(rentals[j].StartTime) {
+			return rentals[i].BookingID > rentals[j].BookingID
+		}
+		return rentals[i].StartTime.After(rentals[j].StartTime)
+	})
+
+	total := len(rentals)
+	start := (page - 1) * pageSize
+	if start > total {
+		start = total
+	}
+	end := start + pageSize
+	if end > total {
+		end = total
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"rentals":   rentals[start:end],
+		"page":      page,
+		"page_size": pageSize,
+		"total":     total,
+	})
+}
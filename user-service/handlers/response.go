@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"cnad_assignment/shared/auth"
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// Page sizes of paginated listings
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// writeJSON writes payload as a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, payload interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(payload)
+}
+
+// writeError writes a JSON error response in the {"error": "..."} shape used across the API
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// authorizeAccount parses the account ID from the URL and checks that it belongs to the
+// authenticated caller. On failure it writes the error response and returns false.
+func authorizeAccount(w http.ResponseWriter, r *http.Request, id string) (int, bool) {
+	userID, err := strconv.Atoi(id)
+	if err != nil || userID <= 0 {
+		writeError(w, http.StatusBadRequest, "Invalid user ID")
+		return 0, false
+	}
+
+	if auth.UserID(r) != userID {
+		writeError(w, http.StatusForbidden, "You can only access your own account")
+		return 0, false
+	}
+	return userID, true
+}
+
+// parsePagination reads the page and page_size query parameters, defaulting to the first
+// page of defaultPageSize items. On invalid values it writes the error response and returns false.
+func parsePagination(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	page, pageSize := 1, defaultPageSize
+	if value := r.URL.Query().Get("page"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			writeError(w, http.StatusBadRequest, "page must be a positive number")
+			return 0, 0, false
+		}
+		page = parsed
+	}
+	if value := r.URL.Query().Get("page_size"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxPageSize {
+			writeError(w, http.StatusBadRequest, "page_size must be between 1 and "+strconv.Itoa(maxPageSize))
+			return 0, 0, false
+		}
+		pageSize = parsed
+	}
+	return page, pageSize, true
+}
@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"cnad_assignment/user-service/database"
+	"cnad_assignment/user-service/models"
+	"cnad_assignment/user-service/utils"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+// sessionTokens is the token pair returned to a client after login or refresh
+type sessionTokens struct {
+	AccessToken  string
+	RefreshToken string
+}
+
+// startSession creates a server-side session for the user and issues its token pair
+func startSession(r *http.Request, userID int) (sessionTokens, error) {
+	var tokens sessionTokens
+
+	refreshToken, err := utils.GenerateRefreshToken()
+	if err != nil {
+		return tokens, err
+	}
+
+	expiresAt := time.Now().Add(utils.RefreshTokenTTL)
+	sessionID, err := database.CreateSession(userID, utils.HashToken(refreshToken), r.UserAgent(), clientIP(r), expiresAt)
+	if err != nil {
+		return tokens, err
+	}
+
+	accessToken, err := issueAccessToken(userID, sessionID)
+	if err != nil {
+		return tokens, err
+	}
+
+	tokens.AccessToken = accessToken
+	tokens.RefreshToken = refreshToken
+	return tokens, nil
+}
+
+// issueAccessToken signs an access token for the session carrying the user's current membership tier
+func issueAccessToken(userID, sessionID int) (string, error) {
+	membershipTier, err := database.FetchMembershipTier(userID)
+	if err != nil {
+		return "", err
+	}
+	return utils.GenerateJWT(userID, sessionID, membershipTier)
+}
+
+// completeLogin finishes a login whose first factor has been verified. Users with MFA
+// enabled receive an MFA pending token instead of a session, and users who are required
+// to use MFA but have not enrolled receive a token that only allows enrolment. Suspended
+// accounts are refused.
+func completeLogin(w http.ResponseWriter, r *http.Request, user models.User) {
+	if user.SuspendedAt != nil {
+		writeAccountSuspended(w, user.ID)
+		return
+	}
+
+	if user.MFAEnabled || user.MFARequired {
+		purpose := utils.MFAPurposeLogin
+		if !user.MFAEnabled {
+			purpose = utils.MFAPurposeSetup
+		}
+
+		mfaToken, err := utils.GenerateMFAToken(user.ID, purpose)
+		if err != nil {
+			log.Printf("Error generating MFA token: %v", err)
+			writeError(w, http.StatusInternalServerError, "Failed to generate token")
+			return
+		}
+
+		log.Printf("Password accepted for user ID=%d, second step pending (%s)", user.ID, purpose)
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"mfa_required":       user.MFAEnabled,
+			"mfa_setup_required": !user.MFAEnabled,
+			"mfa_token":          mfaToken,
+			"expires_in":         int(utils.MFATokenTTL.Seconds()),
+		})
+		return
+	}
+
+	respondWithSession(w, r, user.ID, user.Name)
+}
+
+// writeAccountSuspended refuses a login to an account suspended by support staff
+func writeAccountSuspended(w http.ResponseWriter, userID int) {
+	log.Printf("Login refused for suspended user ID=%d", userID)
+	writeError(w, http.StatusForbidden, "Your account is suspended. Please contact support.")
+}
+
+// respondWithSession starts a session and writes the token pair along with userID and name
+func respondWithSession(w http.ResponseWriter, r *http.Request, userID int, name string) {
+	tokens, err := startSession(r, userID)
+	if err != nil {
+		log.Printf("Error starting session: %v", err)
+		writeError(w, http.StatusInternalServerError, "Failed to generate token")
+		return
+	}
+
+	log.Printf("Login successful: UserID=%d, Name=%s", userID, name)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    int(utils.AccessTokenTTL.Seconds()),
+		"userID":        userID,
+		"name":          name,
+	})
+}
+
+// clientIP returns the remote address of the request without its port
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// RefreshToken exchanges a refresh token for a new access token and a rotated refresh token
+func RefreshToken(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.RefreshToken == "" {
+		writeError(w, http.StatusBadRequest, "Refresh token is required")
+		return
+	}
+
+	newRefreshToken, err := utils.GenerateRefreshToken()
+	if err != nil {
+		log.Printf("Error generating refresh token: %v", err)
+		writeError(w, http.StatusInternalServerError, "Failed to refresh token")
+		return
+	}
+
+	expiresAt := time.Now().Add(utils.RefreshTokenTTL)
+	session, err := database.RotateSession(utils.HashToken(request.RefreshToken), utils.HashToken(newRefreshToken), expiresAt)
+	if err == database.ErrRefreshTokenReused {
+		log.Println("Refresh token reuse detected, session revoked")
+		writeError(w, http.StatusUnauthorized, "Session has been revoked")
+		return
+	}
+	if err == database.ErrSessionNotFound {
+		writeError(w, http.StatusUnauthorized, "Invalid or expired refresh token")
+		return
+	}
+	if err != nil {
+		log.Printf("Error rotating session: %v", err)
+		writeError(w, http.StatusInternalServerError, "Failed to refresh token")
+		return
+	}
+
+	accessToken, err := issueAccessToken(session.UserID, session.ID)
+	if err != nil {
+		log.Printf("Error generating JWT: %v", err)
+		writeError(w, http.StatusInternalServerError, "Failed to generate token")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"token":         accessToken,
+		"refresh_token": newRefreshToken,
+		"expires_in":    int(utils.AccessTokenTTL.Seconds()),
+	})
+}
+
+// LogoutUser revokes the session of the presented access token, or of the refresh token
+// in the body when the access token has already expired
+func LogoutUser(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	json.NewDecoder(r.Body).Decode(&request) // Body is optional
+
+	claims, err := utils.ValidateAccessToken(r)
+	if err == nil {
+		if err := database.RevokeSession(claims.UserID, claims.SessionID); err != nil {
+			log.Printf("Error revoking session %d: %v", claims.SessionID, err)
+			writeError(w, http.StatusInternalServerError, "Failed to log out")
+			return
+		}
+		log.Printf("Session %d revoked for user ID=%d", claims.SessionID, claims.UserID)
+		writeJSON(w, http.StatusOK, map[string]string{"message": "Logged out successfully"})
+		return
+	}
+
+	if request.RefreshToken == "" {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	if err := database.RevokeSessionByRefreshHash(utils.HashToken(request.RefreshToken)); err != nil {
+		log.Printf("Error revoking session by refresh token: %v", err)
+		writeError(w, http.StatusInternalServerError, "Failed to log out")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Logged out successfully"})
+}
+
+// LogoutAllDevices revokes every session of the authenticated user
+func LogoutAllDevices(w http.ResponseWriter, r *http.Request) {
+	userID, err := utils.ValidateJWT(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	revoked, err := database.RevokeAllSessions(userID)
+	if err != nil {
+		log.Printf("Error revoking sessions for user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to log out of all devices")
+		return
+	}
+
+	log.Printf("Revoked %d sessions for user ID=%d", revoked, userID)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"message":          "Logged out of all devices",
+		"revoked_sessions": revoked,
+	})
+}
+
+// GetJWKS publishes the public keys that verify tokens issued by this service
+func GetJWKS(w http.ResponseWriter, r *http.Request) {
+	// Short cache so verifiers notice rotated keys quickly
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	writeJSON(w, http.StatusOK, utils.SigningKeys.JWKS())
+}
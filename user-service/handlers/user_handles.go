@@ -4,13 +4,13 @@ import (
 	"cnad_assignment/user-service/database"
 	"cnad_assignment/user-service/models"
 	"cnad_assignment/user-service/utils"
+	"database/sql"
 	"encoding/json"
-	"fmt"
 	"log"
 	"net/http"
 	"regexp"
-	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 )
@@ -23,19 +23,26 @@ func ValidateEmail(email string) bool {
 func RegisterUser(w http.ResponseWriter, r *http.Request) {
 	log.Println("RegisterUser handler called")
 
-	var user models.User
+	var registration struct {
+		models.User
+		ReferralCode string `json:"referral_code"`
+	}
 
 	// Decode JSON input
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+	if err := json.NewDecoder(r.Body).Decode(&registration); err != nil {
 		log.Printf("Error decoding input: %v", err)
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid input"})
 		return
 	}
+	user := registration.User
 
-	// Debugging received data
-	log.Printf("Received user data: Email=%s, Name=%s, Password=%s", user.Email, user.Name, user.Password)
+	// Users may register with a phone number instead of an email
+	if user.Email == "" && user.Phone != "" {
+		registerWithPhone(w, user, registration.ReferralCode)
+		return
+	}
 
 	// Validate email
 	if !utils.ValidateEmail(user.Email) {
@@ -64,6 +71,11 @@ func RegisterUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	referrer, ok := lookupReferrer(w, registration.ReferralCode)
+	if !ok {
+		return
+	}
+
 	// Hash the password
 	log.Println("Hashing the password")
 	hashedPassword, err := utils.HashPassword(user.Password)
@@ -74,29 +86,17 @@ func RegisterUser(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(map[string]string{"error": "Error hashing password"})
 		return
 	}
-	log.Printf("Hashed password: %s", hashedPassword)
 
 	// Assign hashed password to the user
 	user.Password = hashedPassword
 
-	// Generate a verification token
-	log.Println("Generating verification token")
-	token, err := utils.GenerateVerificationToken()
-	if err != nil {
-		log.Printf("Error generating verification token: %v", err)
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Error generating verification token"})
-		return
-	}
-
 	// Insert the user into the database
-	query := "INSERT INTO users (email, password, name, role, verification_token) VALUES (?, ?, ?, ?, ?)"
-	_, err = database.DB.Exec(query, user.Email, user.Password, user.Name, user.Role, token)
+	query := "INSERT INTO users (email, password, name) VALUES (?, ?, ?)"
+	result, err := database.DB.Exec(query, user.Email, user.Password, user.Name)
 	if err != nil {
 		log.Printf("Error inserting user into database: %v", err)
 		w.Header().Set("Content-Type", "application/json")
-		if strings.Contains(err.Error(), "Duplicate entry") {
+		if database.IsDuplicateEntry(err) {
 			w.WriteHeader(http.StatusConflict)
 			json.NewEncoder(w).Encode(map[string]string{"error": "Email already registered"})
 		} else {
@@ -105,13 +105,11 @@ func RegisterUser(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	userID, _ := result.LastInsertId()
+	setUpReferrals(int(userID), user.Email, "", referrer)
 
-	// Simulate sending the email
-	verificationLink := fmt.Sprintf("http://localhost:8081/api/v1/users/verify?token=%s", token)
-	log.Printf("Send email to %s with verification link: %s", user.Email, verificationLink)
-
-	// Send the actual verification email
-	if err := utils.SendVerificationEmail(user.Email, verificationLink); err != nil {
+	// Send the verification email
+	if _, err := sendVerificationEmail(int(userID), user.Email); err != nil {
 		log.Printf("Error sending verification email: %v", err)
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusInternalServerError)
@@ -125,13 +123,13 @@ func RegisterUser(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{
 		"message": "User registered successfully. Please verify your email.",
 		"email":   user.Email,
-		"token":   token, // Optional: Include token for testing purposes
 	})
 }
 
 func LoginUser(w http.ResponseWriter, r *http.Request) {
 	var credentials struct {
 		Email    string `json:"email"`
+		Phone    string `json:"phone"`
 		Password string `json:"password"`
 	}
 
@@ -143,54 +141,67 @@ func LoginUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Fetch user from the database
+	// Fetch user from the database, by phone number for users who registered with one
 	var user models.User
-	query := "SELECT id, name, password, is_verified FROM users WHERE email = ?"
-	err := database.DB.QueryRow(query, credentials.Email).Scan(&user.ID, &user.Name, &user.Password, &user.IsVerified)
+	var lockedUntil, suspendedAt sql.NullTime
+	query := "SELECT id, COALESCE(email, ''), name, password, is_verified, mfa_enabled, mfa_required, locked_until, suspended_at FROM users WHERE email = ?"
+	identifier := credentials.Email
+	if credentials.Email == "" && credentials.Phone != "" {
+		query = "SELECT id, COALESCE(email, ''), name, password, is_verified, mfa_enabled, mfa_required, locked_until, suspended_at FROM users WHERE phone = ?"
+		identifier = utils.NormalizePhone(credentials.Phone)
+	}
+
+	// Slow down repeated guesses before touching the password
+	if !checkLoginThrottle(w, identifier, clientIP(r)) {
+		return
+	}
+
+	err := database.DB.QueryRow(query, identifier).Scan(&user.ID, &user.Email, &user.Name, &user.Password, &user.IsVerified, &user.MFAEnabled, &user.MFARequired, &lockedUntil, &suspendedAt)
 	if err != nil {
 		log.Printf("Error fetching user: %v", err)
+		recordFailedLogin(r, identifier, 0, "")
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusUnauthorized)
 		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid email or password"})
 		return
 	}
-	log.Printf("Fetched user: ID=%d, Name=%s, Password=%s, IsVerified=%t", user.ID, user.Name, user.Password, user.IsVerified)
+	log.Printf("Fetched user: ID=%d, Name=%s, IsVerified=%t", user.ID, user.Name, user.IsVerified)
+	// Refuse locked accounts even when the password is right
+	if lockedUntil.Valid && time.Now().Before(lockedUntil.Time) {
+		log.Printf("Login refused for locked account: %s", identifier)
+		writeAccountLocked(w, lockedUntil.Time)
+		return
+	}
 	// Check if user is verified
 	if !user.IsVerified {
-		log.Printf("Email not verified for user: %s", credentials.Email)
+		log.Printf("Account not verified for user: %s", identifier)
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusForbidden)
 		json.NewEncoder(w).Encode(map[string]string{"error": "Email not verified"})
 		return
 	}
-	log.Printf("Login successful: UserID=%d, Name=%s", user.ID, user.Name)
 	// Validate the password
 	if !utils.CheckPasswordHash(credentials.Password, user.Password) {
-		log.Printf("Invalid password for user: %s", credentials.Email)
+		log.Printf("Invalid password for user: %s", identifier)
+		if recordFailedLogin(r, identifier, user.ID, user.Email) {
+			writeAccountLocked(w, time.Now().Add(utils.LoginLockoutDuration))
+			return
+		}
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusUnauthorized)
 		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid email or password"})
 		return
 	}
 
-	// Generate JWT token
-	token, err := utils.GenerateJWT(user.ID)
-	if err != nil {
-		log.Printf("Error generating JWT: %v", err)
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to generate token"})
-		return
+	if err := database.RecordLoginSuccess(identifier, clientIP(r), user.ID); err != nil {
+		log.Printf("Error recording successful login: %v", err)
+	}
+	if suspendedAt.Valid {
+		user.SuspendedAt = &suspendedAt.Time
 	}
 
-	// Respond with token, userID, and name
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"token":  token,
-		"userID": user.ID,
-		"name":   user.Name,
-	})
+	// Issue a session, or hand over to the MFA step when the account uses it
+	completeLogin(w, r, user)
 }
 
 func VerifyUser(w http.ResponseWriter, r *http.Request) {
@@ -204,25 +215,14 @@ func VerifyUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Debug: Log the received token
-	log.Printf("Verification token received: %s", token)
-
-	// Check if the token exists in the database
-	var userID int
-	err := database.DB.QueryRow("SELECT id FROM users WHERE verification_token = ?", token).Scan(&userID)
-	if err != nil {
-		log.Printf("Error finding user with token: %v", err)
+	userID, err := database.ConsumeVerificationToken(utils.HashToken(token))
+	if err == database.ErrVerificationTokenInvalid || err == database.ErrVerificationTokenExpired {
+		log.Printf("Rejected verification token: %v", err)
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid token or user not found"})
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
 		return
 	}
-
-	// Debug: Log the user ID associated with the token
-	log.Printf("User ID associated with token: %d", userID)
-
-	// Update the user's verification status
-	result, err := database.DB.Exec("UPDATE users SET is_verified = TRUE, verification_token = NULL WHERE id = ?", userID)
 	if err != nil {
 		log.Printf("Error updating user verification status: %v", err)
 		w.Header().Set("Content-Type", "application/json")
@@ -231,103 +231,31 @@ func VerifyUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if any row was affected
-	rowsAffected, _ := result.RowsAffected()
-	log.Printf("Rows affected: %d", rowsAffected)
-	if rowsAffected == 0 {
-		log.Println("Invalid token or user not found in database")
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid token or user not found"})
-		return
-	}
-
-	log.Println("User email verified successfully")
+	log.Printf("User email verified successfully: ID=%d", userID)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"message": "Email verified successfully"})
 }
 
-func UpdateUserMembership(w http.ResponseWriter, r *http.Request) {
-	id := mux.Vars(r)["id"] // Get the user ID from the URL
-	if id == "" {
-		log.Println("Error: Missing or invalid user ID")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid user ID"})
-		return
-	}
-
-	var request struct {
-		Role string `json:"role"` // The new membership tier
-	}
-
-	log.Printf("Received membership update request: ID=%s", id) // Debug: Log ID
-
-	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		log.Printf("Error decoding request body: %v", err) // Debug: Log error
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid input"})
-		return
-	}
-
-	// Validate membership role
-	validRoles := map[string]bool{"Basic": true, "Premium": true, "VIP": true}
-	if !validRoles[request.Role] {
-		log.Printf("Invalid membership role: %s", request.Role)
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid membership tier"})
-		return
-	}
-
-	// Convert ID to integer
-	userID, err := strconv.Atoi(id)
-	if err != nil {
-		log.Printf("Error converting user ID to integer: %v", err)
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid user ID"})
-		return
-	}
-
-	log.Printf("Updating membership for user ID=%d to Role=%s", userID, request.Role) // Debug: Log role
-
-	// Update the membership tier in the database
-	result, err := database.DB.Exec("UPDATE users SET role = ? WHERE id = ?", request.Role, userID)
-	if err != nil {
-		log.Printf("Database error during update: %v", err) // Debug: Log error
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to update membership tier"})
-		return
-	}
-
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		log.Printf("No rows updated for user ID: %d", userID)
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(map[string]string{"error": "User not found or no change in role"})
-		return
-	}
-
-	log.Printf("Membership tier updated successfully for user ID=%d", userID) // Debug: Confirm success
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Membership tier updated successfully", "updatedRole": request.Role})
-}
-
 func GetUserProfile(w http.ResponseWriter, r *http.Request) {
 	id := mux.Vars(r)["id"] // Extract user ID from the URL
 
-	// Validate if ID is numeric
-	userID, err := strconv.Atoi(id)
-	if err != nil {
-		log.Printf("Invalid user ID: %s", id)
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid user ID"})
+	// Validate the ID and make sure the caller owns the profile
+	userID, ok := authorizeAccount(w, r, id)
+	if !ok {
+		log.Printf("Rejected profile request for user ID: %s", id)
 		return
 	}
 
 	var user models.User
 
 	// Fetch user data from the database
-	query := "SELECT id, email, name, role FROM users WHERE id = ?"
-	err = database.DB.QueryRow(query, userID).Scan(&user.ID, &user.Email, &user.Name, &user.Role)
+	query := `
+        SELECT u.id, COALESCE(u.email, ''), COALESCE(u.phone, ''), u.name, mt.name
+        FROM users u
+        JOIN membership_tiers mt ON mt.id = u.membership_tier_id
+        WHERE u.id = ?
+    `
+	err := database.DB.QueryRow(query, userID).Scan(&user.ID, &user.Email, &user.Phone, &user.Name, &user.MembershipTier)
 	if err != nil {
 		log.Printf("Error fetching user profile for ID=%d: %v", userID, err)
 		w.WriteHeader(http.StatusNotFound)
@@ -335,17 +263,30 @@ func GetUserProfile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Include staff roles so the frontend can show admin tools
+	if user.Roles, err = database.FetchUserRoles(userID); err != nil {
+		log.Printf("Error fetching roles for user ID=%d: %v", userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch user profile"})
+		return
+	}
+
 	log.Printf("Fetched user profile for ID=%d", userID)
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(user)
 }
 
-// UpdateUserProfile allows users to update their details and membership
+// UpdateUserProfile allows users to update their details. Membership tier changes go
+// through UpdateUserMembership so upgrades are paid for.
 func UpdateUserProfile(w http.ResponseWriter, r *http.Request) {
 	id := mux.Vars(r)["id"] // Extract user ID from URL
+	userID, ok := authorizeAccount(w, r, id)
+	if !ok {
+		return
+	}
+
 	var updates struct {
 		Name string `json:"name"`
-		Role string `json:"role"`
 	}
 
 	// Decode the request body
@@ -354,32 +295,27 @@ func UpdateUserProfile(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid input", http.StatusBadRequest)
 		return
 	}
-
-	// Map role to membership_tier_id
-	var membershipTierID int
-	err := database.DB.QueryRow("SELECT id FROM membership_tiers WHERE name = ?", updates.Role).Scan(&membershipTierID)
-	if err != nil {
-		log.Printf("Error finding membership tier ID for role %s: %v", updates.Role, err)
-		http.Error(w, "Invalid membership role", http.StatusBadRequest)
+	updates.Name = strings.TrimSpace(updates.Name)
+	if updates.Name == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
 		return
 	}
 
 	// Update user details in the database
-	query := "UPDATE users SET name = ?, role = ?, membership_tier_id = ? WHERE id = ?"
-	_, err = database.DB.Exec(query, updates.Name, updates.Role, membershipTierID, id)
+	_, err := database.DB.Exec("UPDATE users SET name = ? WHERE id = ?", updates.Name, userID)
 	if err != nil {
 		log.Printf("Error updating user profile: %v", err)
 		http.Error(w, "Failed to update user profile", http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("Updated user ID=%s: Name=%s, Role=%s, MembershipTierID=%d", id, updates.Name, updates.Role, membershipTierID)
+	log.Printf("Updated user ID=%d: Name=%s", userID, updates.Name)
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"message": "Profile updated successfully"})
 }
 
 func GetMembershipTiers(w http.ResponseWriter, r *http.Request) {
-	rows, err := database.DB.Query("SELECT id, name, hourly_rate_discount, priority_access, booking_limit FROM membership_tiers")
+	rows, err := database.DB.Query("SELECT id, name, monthly_fee, hourly_rate_discount, priority_access, booking_limit FROM membership_tiers ORDER BY tier_rank")
 	if err != nil {
 		log.Printf("Error fetching membership tiers: %v", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -392,10 +328,10 @@ func GetMembershipTiers(w http.ResponseWriter, r *http.Request) {
 	for rows.Next() {
 		var id int
 		var name string
-		var discount float64
+		var monthlyFee, discount float64
 		var priorityAccess bool
 		var bookingLimit int
-		if err := rows.Scan(&id, &name, &discount, &priorityAccess, &bookingLimit); err != nil {
+		if err := rows.Scan(&id, &name, &monthlyFee, &discount, &priorityAccess, &bookingLimit); err != nil {
 			log.Printf("Error scanning membership tier row: %v", err)
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(map[string]string{"error": "Failed to process membership tiers"})
@@ -404,6 +340,7 @@ func GetMembershipTiers(w http.ResponseWriter, r *http.Request) {
 		tiers = append(tiers, map[string]interface{}{
 			"id":                 id,
 			"name":               name,
+			"monthlyFee":         monthlyFee,
 			"hourlyRateDiscount": discount,
 			"priorityAccess":     priorityAccess,
 			"bookingLimit":       bookingLimit,
@@ -422,9 +359,8 @@ func GetMembershipTiers(w http.ResponseWriter, r *http.Request) {
 
 func GetUserMembershipBenefits(w http.ResponseWriter, r *http.Request) {
 	id := mux.Vars(r)["id"] // Extract user ID from URL
-	if id == "" {
-		log.Println("Error: User ID is missing or invalid")
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+	if _, ok := authorizeAccount(w, r, id); !ok {
+		log.Printf("Rejected membership benefits request for user ID: %s", id)
 		return
 	}
 
@@ -458,39 +394,6 @@ func GetUserMembershipBenefits(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func GetUserRentalHistory(w http.ResponseWriter, r *http.Request) {
-	id := mux.Vars(r)["id"]
-	rows, err := database.DB.Query("SELECT date, vehicle, duration FROM rentals WHERE user_id = ?", id)
-	if err != nil {
-		log.Printf("Error fetching rental history for user ID=%s: %v", id, err)
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch rental history"})
-		return
-	}
-	defer rows.Close()
-
-	var rentals []map[string]interface{}
-	for rows.Next() {
-		var date string
-		var vehicle string
-		var duration int
-		if err := rows.Scan(&date, &vehicle, &duration); err != nil {
-			log.Printf("Error scanning rental history row: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(map[string]string{"error": "Failed to process rental history"})
-			return
-		}
-		rentals = append(rentals, map[string]interface{}{
-			"date":     date,
-			"vehicle":  vehicle,
-			"duration": duration,
-		})
-	}
-
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(rentals)
-}
-
 func FetchVehiclesFromVehicleService() {
 	resp, err := http.Get("http://localhost:8082/api/v1/vehicles")
 	if err != nil {
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"cnad_assignment/user-service/database"
+	"cnad_assignment/user-service/utils"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// errVerificationRateLimited is returned by sendVerificationEmail when the user has asked for too many emails
+var errVerificationRateLimited = errors.New("too many verification emails requested")
+
+// sendVerificationEmail issues a new verification link to the user's email. When the user
+// is rate limited it returns errVerificationRateLimited and how long the caller should wait.
+func sendVerificationEmail(userID int, email string) (time.Duration, error) {
+	stats, err := database.GetVerificationSendStats(userID)
+	if err != nil {
+		return 0, err
+	}
+	if stats.LastSentAt != nil {
+		if wait := utils.VerificationResendAfter - time.Since(*stats.LastSentAt); wait > 0 {
+			return wait, errVerificationRateLimited
+		}
+	}
+	if stats.SentLastHour >= utils.VerificationMaxPerHour {
+		return time.Hour, errVerificationRateLimited
+	}
+
+	token, err := utils.GenerateVerificationToken()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := database.CreateVerificationToken(userID, utils.HashToken(token), time.Now().Add(utils.EmailVerificationTTL)); err != nil {
+		return 0, err
+	}
+
+	verificationLink := fmt.Sprintf("http://localhost:8081/api/v1/users/verify?token=%s", token)
+	return 0, utils.SendVerificationEmail(email, verificationLink)
+}
+
+// ResendVerificationEmail sends a fresh verification link to an unverified email address.
+// The response is the same whether or not the email is registered.
+func ResendVerificationEmail(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || strings.TrimSpace(request.Email) == "" {
+		writeError(w, http.StatusBadRequest, "Email is required")
+		return
+	}
+
+	genericResponse := map[string]string{"message": "If the email is registered and unverified, a new verification link has been sent."}
+
+	var userID int
+	var verified bool
+	err := database.DB.QueryRow("SELECT id, is_verified FROM users WHERE email = ?", request.Email).Scan(&userID, &verified)
+	if err == sql.ErrNoRows || (err == nil && verified) {
+		writeJSON(w, http.StatusOK, genericResponse)
+		return
+	}
+	if err != nil {
+		log.Printf("Error looking up user for verification resend: %v", err)
+		writeError(w, http.StatusInternalServerError, "Failed to send verification email")
+		return
+	}
+
+	wait, err := sendVerificationEmail(userID, request.Email)
+	if err == errVerificationRateLimited {
+		w.Header().Set("Retry-After", fmt.Sprint(int(wait.Seconds())+1))
+		writeError(w, http.StatusTooManyRequests, "Too many verification emails requested. Please try again later.")
+		return
+	}
+	if err != nil {
+		log.Printf("Error resending verification email to user ID=%d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to send verification email")
+		return
+	}
+
+	log.Printf("Verification email re-sent to user ID=%d", userID)
+	writeJSON(w, http.StatusOK, genericResponse)
+}
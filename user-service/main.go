@@ -1,11 +1,14 @@
 package main
 
 import (
+	"cnad_assignment/shared/notify"
 	"cnad_assignment/user-service/database"
 	"cnad_assignment/user-service/routes"
+	"cnad_assignment/user-service/utils"
 	"fmt"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/mux"
 )
@@ -14,6 +17,25 @@ func main() {
 	// Initialize the database
 	database.InitDB()
 
+	// Load the token signing keys and rotate them in the background
+	if err := utils.LoadSigningKeys(); err != nil {
+		log.Fatalf("Error loading token signing keys: %v", err)
+	}
+	go startSigningKeyRotation()
+
+	// Apply membership downgrades when the billing period they wait for ends and bill renewals
+	go startMembershipScheduler()
+
+	// Credit loyalty points once rentals are completed and paid
+	go startLoyaltyPointsAwarder()
+
+	// Deliver notifications queued by every service
+	senders, err := notify.SendersFromEnv()
+	if err != nil {
+		log.Fatalf("Error configuring notification delivery: %v", err)
+	}
+	go startNotificationDispatcher(senders)
+
 	// Create a new router
 	r := mux.NewRouter()
 
@@ -28,3 +50,106 @@ func main() {
 	fmt.Println("Server is running on http://localhost:8081")
 	log.Fatal(http.ListenAndServe(":8081", r))
 }
+
+// startSigningKeyRotation periodically reloads the shared token signing keys, publishes a
+// replacement when the signing key is due and drops retired keys
+func startSigningKeyRotation() {
+	ticker := time.NewTicker(utils.SigningKeyReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := utils.RotateSigningKeys(); err != nil {
+				log.Printf("Error rotating token signing keys: %v", err)
+			}
+		}
+	}
+}
+
+// startMembershipScheduler periodically applies scheduled membership tier changes that are due,
+// bills paid memberships for their next month and drops members who did not pay in time to
+// the free tier
+func startMembershipScheduler() {
+	ticker := time.NewTicker(utils.MembershipSchedulerInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			now := time.Now()
+			applied, err := database.ApplyDueMembershipChanges(now)
+			if err != nil {
+				log.Printf("Error applying scheduled membership changes: %v", err)
+			} else if applied > 0 {
+				log.Printf("Applied %d scheduled membership changes", applied)
+			}
+
+			renewed, err := utils.RenewDueMemberships(now)
+			if err != nil {
+				log.Printf("Error creating membership renewals: %v", err)
+			} else if renewed > 0 {
+				log.Printf("Created %d membership renewals", renewed)
+			}
+
+			lapsed, err := database.LapseUnpaidMemberships(now.Add(-utils.MembershipRenewalGracePeriod), now)
+			if err != nil {
+				log.Printf("Error lapsing unpaid memberships: %v", err)
+			} else if lapsed > 0 {
+				log.Printf("Moved %d members with unpaid renewals to the free tier", lapsed)
+			}
+		}
+	}
+}
+
+// startLoyaltyPointsAwarder periodically awards loyalty points for completed, paid rentals,
+// takes them back once the payment is refunded and awards referral credit for referred
+// users' first paid rental
+func startLoyaltyPointsAwarder() {
+	ticker := time.NewTicker(utils.LoyaltyAwardInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			awarded, err := database.AwardPointsForCompletedRentals(utils.PointsPerDollar)
+			if err != nil {
+				log.Printf("Error awarding loyalty points: %v", err)
+			} else if awarded > 0 {
+				log.Printf("Awarded loyalty points for %d payments", awarded)
+			}
+
+			reversed, err := database.ReversePointsForRefundedPayments()
+			if err != nil {
+				log.Printf("Error reversing loyalty points of refunded payments: %v", err)
+			} else if reversed > 0 {
+				log.Printf("Reversed loyalty points for %d refunded payments", reversed)
+			}
+
+			rewarded, rejected, err := database.ProcessReferralRewards(utils.ReferrerCreditPoints, utils.ReferredCreditPoints, utils.ReferralMaxRewards)
+			if err != nil {
+				log.Printf("Error processing referral rewards: %v", err)
+			} else if rewarded+rejected > 0 {
+				log.Printf("Resolved referrals: %d rewarded, %d rejected", rewarded, rejected)
+			}
+		}
+	}
+}
+
+// startNotificationDispatcher periodically delivers due notifications from the outbox
+func startNotificationDispatcher(senders map[string]notify.Sender) {
+	ticker := time.NewTicker(utils.NotificationDispatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			sent, failed, err := notify.Dispatch(database.DB, senders, utils.NotificationBatchSize)
+			if err != nil {
+				log.Printf("Error dispatching notifications: %v", err)
+			} else if sent+failed > 0 {
+				log.Printf("Dispatched notifications: %d sent, %d failed", sent, failed)
+			}
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// SecurityEvent is an entry in a user's security audit trail
+type SecurityEvent struct {
+	EventType string    `json:"event_type"`
+	IPAddress string    `json:"ip_address"`
+	Details   string    `json:"details"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AccountExport is the archive of personal data a user can download about themselves
+type AccountExport struct {
+	ExportedAt              time.Time               `json:"exported_at"`
+	Profile                 User                    `json:"profile"`
+	Licence                 *DriverLicence          `json:"licence,omitempty"`
+	MembershipChanges       []MembershipChange      `json:"membership_changes"`
+	LoyaltyPoints           []PointsEntry           `json:"loyalty_points"`
+	Referrals               []Referral              `json:"referrals"` // Made with the user's own referral code
+	Sessions                []Session               `json:"sessions"`
+	APIKeys                 []APIKey                `json:"api_keys"`
+	NotificationPreferences NotificationPreferences `json:"notification_preferences"`
+	SecurityEvents          []SecurityEvent         `json:"security_events"`
+	Bookings                interface{}             `json:"bookings"` // As returned by vehicle-service
+	Payments                interface{}             `json:"payments"` // As returned by billing-service
+	Invoices                interface{}             `json:"invoices"` // As returned by billing-service
+}
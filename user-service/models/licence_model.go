@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Driver licence review states
+const (
+	LicenceStatusPending  = "pending"
+	LicenceStatusApproved = "approved"
+	LicenceStatusRejected = "rejected"
+)
+
+// DriverLicence is the licence a user submitted for review before they can book
+type DriverLicence struct {
+	UserID          int        `json:"user_id"`
+	LicenceNumber   string     `json:"licence_number"`
+	IssuingCountry  string     `json:"issuing_country"`
+	ExpiryDate      time.Time  `json:"expiry_date"`
+	DateOfBirth     time.Time  `json:"date_of_birth"`
+	DocumentRef     string     `json:"-"` // Stored file name, served to reviewers only
+	Status          string     `json:"status"`
+	RejectionReason string     `json:"rejection_reason,omitempty"`
+	SubmittedAt     time.Time  `json:"submitted_at"`
+	ReviewedAt      *time.Time `json:"reviewed_at,omitempty"`
+}
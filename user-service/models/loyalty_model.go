@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// Loyalty points entry types
+const (
+	PointsEarned   = "earn"
+	PointsRedeemed = "redeem"
+	PointsReferral = "referral"
+	PointsReversed = "reversal" // Takes back the points earned by a payment that was refunded
+	PointsRefunded = "refund"   // Gives back points redeemed on a payment that was refunded
+)
+
+// PointsEntry is one line of a user's loyalty points ledger
+type PointsEntry struct {
+	ID          int       `json:"id"`
+	Points      int       `json:"points"` // Negative for redemptions and reversals
+	EntryType   string    `json:"entry_type"`
+	BookingID   int       `json:"booking_id,omitempty"`
+	PaymentID   int       `json:"payment_id,omitempty"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+}
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// MembershipTier is a membership level and the benefits it grants
+type MembershipTier struct {
+	ID                 int     `json:"id"`
+	Name               string  `json:"name"`
+	Rank               int     `json:"rank"` // Higher ranks are better tiers
+	MonthlyFee         float64 `json:"monthly_fee"`
+	HourlyRateDiscount float64 `json:"hourly_rate_discount"`
+	PriorityAccess     bool    `json:"priority_access"`
+	BookingLimit       int     `json:"booking_limit"`
+}
+
+// Membership change types
+const (
+	MembershipUpgrade   = "upgrade"
+	MembershipDowngrade = "downgrade"
+	MembershipRenewal   = "renewal"
+)
+
+// Membership change states
+const (
+	MembershipChangePendingPayment = "pending_payment"
+	MembershipChangeScheduled      = "scheduled"
+	MembershipChangeApplied        = "applied"
+	MembershipChangeCanceled       = "canceled"
+)
+
+// MembershipChange is a requested move between tiers and what became of it
+type MembershipChange struct {
+	ID          int        `json:"id"`
+	FromTier    string     `json:"from_tier"`
+	ToTier      string     `json:"to_tier"`
+	ChangeType  string     `json:"change_type"`
+	Status      string     `json:"status"`
+	Amount      float64    `json:"amount"`
+	EffectiveAt *time.Time `json:"effective_at,omitempty"`
+	PeriodEnd   *time.Time `json:"period_end,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	AppliedAt   *time.Time `json:"applied_at,omitempty"`
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// NotificationPreferences are the channels a user wants to be notified on
+type NotificationPreferences struct {
+	Email          bool       `json:"email"`
+	SMS            bool       `json:"sms"`
+	Push           bool       `json:"push"`
+	PushWebhookURL string     `json:"push_webhook_url"` // Push notifications are posted here as JSON
+	UpdatedAt      *time.Time `json:"updated_at,omitempty"`
+}
@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// Referral states
+const (
+	ReferralPending  = "pending"
+	ReferralRewarded = "rewarded"
+	ReferralRejected = "rejected"
+)
+
+// Referrer is the account behind a referral code, with the details used for anti-abuse checks
+type Referrer struct {
+	ID    int
+	Email string
+	Phone string
+}
+
+// Referral is a user who signed up with someone else's referral code
+type Referral struct {
+	ID              int        `json:"id"`
+	ReferrerID      int        `json:"-"`
+	ReferredID      int        `json:"-"` // Not shown to the referrer, who only sees how their referrals went
+	Status          string     `json:"status"`
+	RejectionReason string     `json:"rejection_reason,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	ResolvedAt      *time.Time `json:"resolved_at,omitempty"`
+}
+
+// ReferralConversion summarises how a referrer's referrals turned out, for the admin report
+type ReferralConversion struct {
+	ReferrerID     int     `json:"referrer_id"`
+	ReferrerName   string  `json:"referrer_name"`
+	ReferrerEmail  string  `json:"referrer_email"`
+	Referrals      int     `json:"referrals"`
+	Pending        int     `json:"pending"`
+	Rewarded       int     `json:"rewarded"`
+	Rejected       int     `json:"rejected"`
+	ConversionRate float64 `json:"conversion_rate"` // Rewarded out of all referrals
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// Rental is a booking from vehicle-service merged with what billing-service invoiced and
+// collected for it
+type Rental struct {
+	BookingID          int       `json:"booking_id"`
+	Make               string    `json:"make"`
+	Model              string    `json:"model"`
+	RegistrationNumber string    `json:"registration_number"`
+	StartTime          time.Time `json:"start_time"`
+	EndTime            time.Time `json:"end_time"`
+	Status             string    `json:"status"`
+
+	Cost           *float64 `json:"cost"` // Invoiced amount, nil until the rental is invoiced
+	PointsDiscount float64  `json:"points_discount"`
+	InvoiceID      int      `json:"invoice_id,omitempty"`
+	InvoiceStatus  string   `json:"invoice_status,omitempty"`
+	PaymentID      int      `json:"payment_id,omitempty"`
+	PaymentMethod  string   `json:"payment_method,omitempty"`
+	PaymentStatus  string   `json:"payment_status"` // "unpaid" when no payment was made
+}
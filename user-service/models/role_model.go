@@ -0,0 +1,9 @@
+package models
+
+// Role is a staff authorization role and the permissions it grants
+type Role struct {
+	ID          int      `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
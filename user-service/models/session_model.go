@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// Session represents a login session backed by a rotating refresh token
+type Session struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id"`
+	UserAgent  string     `json:"user_agent"`
+	IPAddress  string     `json:"ip_address"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
@@ -4,12 +4,18 @@ import "time"
 
 // User represents a user in the system
 type User struct {
-	ID                int       `json:"id"`
-	Email             string    `json:"email"`
-	Password          string    `json:"password"`
-	Name              string    `json:"name"`
-	Role              string    `json:"role"`
-	CreatedAt         time.Time `json:"created_at"`
-	IsVerified        bool      `json:"is_verified"`        // Add this field
-	VerificationToken string    `json:"verification_token"` // Add this field if needed for verification handling
+	ID             int       `json:"id"`
+	Email          string    `json:"email"`
+	Phone          string    `json:"phone,omitempty"`
+	Password       string    `json:"password,omitempty"`
+	Name           string    `json:"name"`
+	MembershipTier string    `json:"membership_tier"` // Basic, Premium or VIP
+	Roles          []string  `json:"roles,omitempty"` // Staff authorization roles, empty for customers
+	CreatedAt      time.Time `json:"created_at"`
+	IsVerified     bool      `json:"is_verified"` // Add this field
+	MFAEnabled     bool      `json:"mfa_enabled"`
+	MFARequired    bool      `json:"mfa_required"`
+
+	SuspendedAt      *time.Time `json:"suspended_at,omitempty"` // Set while support has suspended the account
+	SuspensionReason string     `json:"suspension_reason,omitempty"`
 }
@@ -1,20 +1,88 @@
 package routes
 
 import (
+	"cnad_assignment/shared/auth"
+	"cnad_assignment/user-service/database"
 	"cnad_assignment/user-service/handlers"
+	"net/http"
 
 	"github.com/gorilla/mux"
 )
 
 // RegisterUserRoutes sets up the API routes for User Management
 func RegisterUserRoutes(router *mux.Router) {
+	// Public keys for verifying tokens, fetched by the other services
+	router.HandleFunc("/.well-known/jwks.json", handlers.GetJWKS).Methods("GET")
+
 	userRouter := router.PathPrefix("/api/v1/users").Subrouter()
 	userRouter.HandleFunc("/register", handlers.RegisterUser).Methods("POST")
 	userRouter.HandleFunc("/login", handlers.LoginUser).Methods("POST")
+	userRouter.HandleFunc("/login/mfa", handlers.VerifyMFALogin).Methods("POST")
+	userRouter.HandleFunc("/login/otp/request", handlers.RequestLoginOTP).Methods("POST")
+	userRouter.HandleFunc("/login/otp/verify", handlers.VerifyLoginOTP).Methods("POST")
 	userRouter.HandleFunc("/verify", handlers.VerifyUser).Methods("GET") // Add this route for verification
+	userRouter.HandleFunc("/verify/resend", handlers.ResendVerificationEmail).Methods("POST")
+	userRouter.HandleFunc("/unlock", handlers.UnlockAccount).Methods("POST")
+	userRouter.HandleFunc("/email/confirm", handlers.ConfirmEmailChange).Methods("GET")
+	userRouter.HandleFunc("/phone/verify", handlers.VerifyPhone).Methods("POST")
+	userRouter.HandleFunc("/phone/verify/resend", handlers.ResendPhoneVerification).Methods("POST")
+	userRouter.HandleFunc("/token/refresh", handlers.RefreshToken).Methods("POST")
+	userRouter.HandleFunc("/logout", handlers.LogoutUser).Methods("POST")
+	userRouter.HandleFunc("/logout-all", handlers.LogoutAllDevices).Methods("POST")
+	userRouter.HandleFunc("/password/forgot", handlers.ForgotPassword).Methods("POST")
+	userRouter.HandleFunc("/password/reset", handlers.ResetPassword).Methods("POST")
+	userRouter.HandleFunc("/mfa", handlers.GetMFAStatus).Methods("GET")
+	userRouter.HandleFunc("/mfa/setup", handlers.SetupMFA).Methods("POST")
+	userRouter.HandleFunc("/mfa/confirm", handlers.ConfirmMFA).Methods("POST")
+	userRouter.HandleFunc("/mfa/disable", handlers.DisableMFA).Methods("POST")
+	userRouter.HandleFunc("/mfa/recovery-codes", handlers.RegenerateRecoveryCodes).Methods("POST")
 	userRouter.HandleFunc("/membership-tiers", handlers.GetMembershipTiers).Methods("GET")
 
-	userRouter.HandleFunc("/{id}", handlers.GetUserProfile).Methods("GET")
-	userRouter.HandleFunc("/{id}", handlers.UpdateUserProfile).Methods("PUT")
-	userRouter.HandleFunc("/{id}/membership-benefits", handlers.GetUserMembershipBenefits).Methods("GET")
+	// Routes below require a valid access token and only serve the caller's own account
+	accountRouter := router.PathPrefix("/api/v1/users").Subrouter()
+	accountRouter.Use(auth.Middleware(database.DB))
+	accountRouter.HandleFunc("/{id}", handlers.GetUserProfile).Methods("GET")
+	accountRouter.HandleFunc("/{id}", handlers.UpdateUserProfile).Methods("PUT")
+	accountRouter.HandleFunc("/{id}/membership-benefits", handlers.GetUserMembershipBenefits).Methods("GET")
+	accountRouter.HandleFunc("/{id}/membership", handlers.GetUserMembership).Methods("GET")
+	accountRouter.HandleFunc("/{id}/membership", handlers.UpdateUserMembership).Methods("POST")
+	accountRouter.HandleFunc("/{id}/membership/pending", handlers.CancelMembershipChange).Methods("DELETE")
+	accountRouter.HandleFunc("/{id}/membership/history", handlers.GetMembershipHistory).Methods("GET")
+	accountRouter.HandleFunc("/{id}/rentals", handlers.GetRentalHistory).Methods("GET")
+	accountRouter.HandleFunc("/{id}/points", handlers.GetPointsBalance).Methods("GET")
+	accountRouter.HandleFunc("/{id}/points/history", handlers.GetPointsHistory).Methods("GET")
+	accountRouter.HandleFunc("/{id}/referrals", handlers.GetReferrals).Methods("GET")
+	accountRouter.HandleFunc("/{id}", handlers.DeleteAccount).Methods("DELETE")
+	accountRouter.HandleFunc("/{id}/email", handlers.RequestEmailChange).Methods("POST")
+	accountRouter.HandleFunc("/{id}/export", handlers.ExportAccountData).Methods("GET")
+	accountRouter.HandleFunc("/{id}/api-keys", handlers.ListAPIKeys).Methods("GET")
+	accountRouter.HandleFunc("/{id}/api-keys", handlers.CreateAPIKey).Methods("POST")
+	accountRouter.HandleFunc("/{id}/api-keys/{keyId:[0-9]+}", handlers.RevokeAPIKey).Methods("DELETE")
+	accountRouter.HandleFunc("/{id}/notification-preferences", handlers.GetNotificationPreferences).Methods("GET")
+	accountRouter.HandleFunc("/{id}/notification-preferences", handlers.UpdateNotificationPreferences).Methods("PUT")
+	accountRouter.HandleFunc("/{id}/licence", handlers.GetLicence).Methods("GET")
+	accountRouter.HandleFunc("/{id}/licence", handlers.SubmitLicence).Methods("POST")
+
+	// Admin routes are guarded by staff permissions rather than account ownership
+	adminRouter := router.PathPrefix("/api/v1/admin").Subrouter()
+	adminRouter.Use(auth.Middleware(database.DB))
+	adminRouter.Handle("/roles", requirePermission(auth.PermRolesManage, handlers.ListRoles)).Methods("GET")
+	adminRouter.Handle("/users", requirePermission(auth.PermUsersRead, handlers.AdminSearchUsers)).Methods("GET")
+	adminRouter.Handle("/users/{id:[0-9]+}", requirePermission(auth.PermUsersRead, handlers.AdminGetUser)).Methods("GET")
+	adminRouter.Handle("/users/{id:[0-9]+}/suspend", requirePermission(auth.PermUsersManage, handlers.AdminSuspendUser)).Methods("POST")
+	adminRouter.Handle("/users/{id:[0-9]+}/reactivate", requirePermission(auth.PermUsersManage, handlers.AdminReactivateUser)).Methods("POST")
+	adminRouter.Handle("/users/{id:[0-9]+}/verify", requirePermission(auth.PermUsersManage, handlers.AdminVerifyUser)).Methods("POST")
+	adminRouter.Handle("/users/{id:[0-9]+}/mfa/reset", requirePermission(auth.PermUsersManage, handlers.AdminResetUserMFA)).Methods("POST")
+	adminRouter.Handle("/users/{id:[0-9]+}/roles", requirePermission(auth.PermRolesManage, handlers.GrantUserRole)).Methods("POST")
+	adminRouter.Handle("/users/{id:[0-9]+}/roles/{role}", requirePermission(auth.PermRolesManage, handlers.RevokeUserRole)).Methods("DELETE")
+	adminRouter.Handle("/users/{id:[0-9]+}/mfa-required", requirePermission(auth.PermUsersManage, handlers.SetUserMFARequirement)).Methods("PUT")
+	adminRouter.Handle("/referrals", requirePermission(auth.PermUsersRead, handlers.AdminReferralReport)).Methods("GET")
+	adminRouter.Handle("/licences", requirePermission(auth.PermLicenceReview, handlers.AdminListLicences)).Methods("GET")
+	adminRouter.Handle("/licences/{id:[0-9]+}/document", requirePermission(auth.PermLicenceReview, handlers.AdminGetLicenceDocument)).Methods("GET")
+	adminRouter.Handle("/licences/{id:[0-9]+}", requirePermission(auth.PermLicenceReview, handlers.AdminReviewLicence)).Methods("PUT")
+}
+
+// requirePermission wraps an admin handler so only callers holding the permission reach it
+func requirePermission(permission string, handler http.HandlerFunc) http.Handler {
+	return auth.RequirePermission(database.DB, permission)(handler)
 }
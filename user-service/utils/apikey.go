@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"cnad_assignment/shared/auth"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// API key lifetimes. Every key expires so forgotten keys stop working on their own.
+const (
+	APIKeyDefaultTTL = 90 * 24 * time.Hour
+	APIKeyMaxTTL     = 365 * 24 * time.Hour
+)
+
+// MaxAPIKeysPerUser limits how many unrevoked API keys a user can hold
+const MaxAPIKeysPerUser = 10
+
+// APIKeyDisplayLength is how many leading characters of a key are kept to identify it in listings
+const APIKeyDisplayLength = len(auth.APIKeyPrefix) + 6
+
+// GenerateAPIKey creates a random personal API key
+func GenerateAPIKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return auth.APIKeyPrefix + hex.EncodeToString(key), nil
+}
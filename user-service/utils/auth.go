@@ -1,31 +1,115 @@
 package utils
 
 import (
+	"cnad_assignment/shared/auth"
+	"cnad_assignment/shared/notify"
+	"cnad_assignment/user-service/database"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
-	"fmt"
 	"net/http"
 	"regexp"
-	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
 	"golang.org/x/crypto/bcrypt"
-	"gopkg.in/gomail.v2"
 )
 
-var jwtSecret = []byte("your_jwt_secret_key") // Ensure this line has no issues.
+// AccessTokenTTL is how long an access token is accepted before the client must refresh it
+const AccessTokenTTL = 15 * time.Minute
 
-// GenerateJWT generates a JWT token for authenticated users
-func GenerateJWT(userID int) (string, error) {
+// PasswordResetTokenTTL is how long a password reset link stays valid
+const PasswordResetTokenTTL = 30 * time.Minute
+
+// EmailVerificationTTL is how long an email verification link stays valid
+const EmailVerificationTTL = 24 * time.Hour
+
+// Verification emails may be re-sent once a minute and at most VerificationMaxPerHour times an hour
+const (
+	VerificationResendAfter = time.Minute
+	VerificationMaxPerHour  = 5
+)
+
+// EmailChangeTokenTTL is how long the confirmation link for a new email address stays valid
+const EmailChangeTokenTTL = 24 * time.Hour
+
+// RefreshTokenTTL is how long a session can stay idle before its refresh token expires
+const RefreshTokenTTL = 30 * 24 * time.Hour
+
+// GenerateJWT generates a short-lived access token bound to a login session
+func GenerateJWT(userID, sessionID int, membershipTier string) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"sub":  userID,                         // Subject (user ID)
+		"sid":  sessionID,                      // Session the token belongs to
+		"tier": membershipTier,                 // Membership tier, so services can apply benefits without a lookup
+		"aud":  auth.AudienceAPI,               // Accepted by every service
+		"iat":  now.Unix(),                     // Issued at
+		"exp":  now.Add(AccessTokenTTL).Unix(), // Expiry time
+	}
+
+	return SigningKeys.Sign(claims)
+}
+
+// MFA pending token purposes
+const (
+	MFAPurposeLogin = "mfa_login" // Password accepted, waiting for a TOTP or recovery code
+	MFAPurposeSetup = "mfa_setup" // Password accepted, account must enrol in MFA before a session is issued
+)
+
+// MFATokenTTL is how long a user has to complete the second login step
+const MFATokenTTL = 5 * time.Minute
+
+// GenerateMFAToken issues a short-lived token proving the password step succeeded.
+// It carries no session and is rejected by ValidateJWT.
+func GenerateMFAToken(userID int, purpose string) (string, error) {
 	claims := jwt.MapClaims{
-		"sub": userID,                                // Subject (user ID)
-		"exp": time.Now().Add(24 * time.Hour).Unix(), // Expiry time (24 hours)
+		"sub": userID,
+		"typ": purpose,
+		"aud": auth.AudienceUserService, // Only user-service may accept it
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(MFATokenTTL).Unix(),
+	}
+
+	return SigningKeys.Sign(claims)
+}
+
+// ParseMFAToken validates an MFA pending token issued for purpose and returns the user ID
+// and when the token was issued
+func ParseMFAToken(tokenString, purpose string) (int, time.Time, error) {
+	claims, err := auth.ParseToken(tokenString, auth.AudienceUserService)
+	if err != nil {
+		return 0, time.Time{}, err
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	if claims["typ"] != purpose {
+		return 0, time.Time{}, errors.New("invalid MFA token")
+	}
+	userID, ok := claims["sub"].(float64)
+	if !ok {
+		return 0, time.Time{}, errors.New("invalid MFA token")
+	}
+	issuedAt, ok := claims["iat"].(float64)
+	if !ok {
+		return 0, time.Time{}, errors.New("invalid MFA token")
+	}
+	return int(userID), time.Unix(int64(issuedAt), 0), nil
+}
+
+// GenerateRefreshToken creates a random opaque refresh token
+func GenerateRefreshToken() (string, error) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(token), nil
+}
+
+// HashToken returns the SHA-256 hex digest of a token so only the digest is stored
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
 
 // HashPassword encrypts a plain password
@@ -52,71 +136,55 @@ func GenerateVerificationToken() (string, error) {
 
 // ValidateEmail checks if the email address is valid
 func ValidateEmail(email string) bool {
-	re := regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.(com|org|net|edu)$`)
+	re := regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
 	return re.MatchString(email)
 }
 
-// SMTPConfig holds SMTP server configuration
-type SMTPConfig struct {
-	Host     string
-	Port     int
-	Username string
-	Password string
+// SendVerificationEmail queues an email with the verification link
+func SendVerificationEmail(to, verificationLink string) error {
+	return notify.SendTo(database.DB, notify.ChannelEmail, to, notify.TemplateEmailVerification, notify.Data{
+		"Link":         verificationLink,
+		"ExpiresHours": int(EmailVerificationTTL.Hours()),
+	})
 }
 
-// DefaultSMTPConfig for your email server
-var DefaultSMTPConfig = SMTPConfig{
-	Host:     "smtp.gmail.com", // Change this based on your SMTP provider
-	Port:     587,
-	Username: "checkme123ymail.com@gmail.com", // Your email address
-	Password: "kket mgmy ymea ywuz",           // Your email password or app password
+// SendPasswordResetEmail queues an email with a link to choose a new password
+func SendPasswordResetEmail(to, resetLink string) error {
+	return notify.SendTo(database.DB, notify.ChannelEmail, to, notify.TemplatePasswordReset, notify.Data{
+		"Link":           resetLink,
+		"ExpiresMinutes": int(PasswordResetTokenTTL.Minutes()),
+	})
 }
 
-// SendVerificationEmail sends an email with the verification link
-func SendVerificationEmail(to, verificationLink string) error {
-	m := gomail.NewMessage()
-	m.SetHeader("From", DefaultSMTPConfig.Username)
-	m.SetHeader("To", to)
-	m.SetHeader("Subject", "Email Verification")
-	m.SetBody("text/plain", fmt.Sprintf("Please verify your email by clicking the link: %s", verificationLink))
-
-	dialer := gomail.NewDialer(DefaultSMTPConfig.Host, DefaultSMTPConfig.Port, DefaultSMTPConfig.Username, DefaultSMTPConfig.Password)
-	return dialer.DialAndSend(m)
+// SendEmailChangeConfirmation asks the owner of the new address to confirm the change
+func SendEmailChangeConfirmation(to, confirmLink string) error {
+	return notify.SendTo(database.DB, notify.ChannelEmail, to, notify.TemplateEmailChangeConfirm, notify.Data{
+		"Link":         confirmLink,
+		"ExpiresHours": int(EmailChangeTokenTTL.Hours()),
+	})
 }
 
-// ValidateJWT validates the JWT token from the Authorization header and returns the user ID.
-func ValidateJWT(r *http.Request) (int, error) {
-	// Get the Authorization header
-	authHeader := r.Header.Get("Authorization")
-	if authHeader == "" {
-		return 0, errors.New("missing authorization header")
-	}
-
-	// Check if the header starts with "Bearer "
-	parts := strings.Split(authHeader, " ")
-	if len(parts) != 2 || parts[0] != "Bearer" {
-		return 0, errors.New("invalid authorization header format")
-	}
-
-	// Parse the token
-	tokenString := parts[1]
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("unexpected signing method")
-		}
-		return jwtSecret, nil
+// SendEmailChangeNotice warns the current address that a change to newEmail was requested
+func SendEmailChangeNotice(to, newEmail string) error {
+	return notify.SendTo(database.DB, notify.ChannelEmail, to, notify.TemplateEmailChangeNotice, notify.Data{
+		"NewEmail": newEmail,
 	})
+}
+
+// AccessClaims holds the identity carried by a validated access token
+type AccessClaims = auth.Identity
 
+// ValidateJWT validates the JWT token from the Authorization header and returns the user ID.
+func ValidateJWT(r *http.Request) (int, error) {
+	claims, err := ValidateAccessToken(r)
 	if err != nil {
 		return 0, err
 	}
+	return claims.UserID, nil
+}
 
-	// Extract claims and validate
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		if userID, ok := claims["sub"].(float64); ok {
-			return int(userID), nil
-		}
-	}
-
-	return 0, errors.New("invalid token")
+// ValidateAccessToken validates the bearer token from the Authorization header and
+// rejects tokens whose session has been revoked or has expired.
+func ValidateAccessToken(r *http.Request) (AccessClaims, error) {
+	return auth.Authenticate(database.DB, r)
 }
@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// LicenceDocumentDir is where uploaded licence scans are stored
+var LicenceDocumentDir = filepath.Join("uploads", "licences")
+
+// MaxLicenceDocumentSize is the largest licence scan accepted
+const MaxLicenceDocumentSize = 5 << 20
+
+// MinDriverAge is the minimum age for a licence to be accepted
+const MinDriverAge = 18
+
+// ErrUnsupportedDocument is returned when an uploaded scan is not a JPEG, PNG or PDF
+var ErrUnsupportedDocument = errors.New("licence document must be a JPEG, PNG or PDF")
+
+// licenceDocumentTypes maps accepted content types to the extension files are stored with
+var licenceDocumentTypes = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"application/pdf": ".pdf",
+}
+
+// documentRefPattern matches the file names SaveLicenceDocument generates
+var documentRefPattern = regexp.MustCompile(`^[0-9a-f]{32}\.(jpg|png|pdf)$`)
+
+// ValidateCountryCode checks for an ISO 3166-1 alpha-2 code such as "SG"
+func ValidateCountryCode(code string) bool {
+	return regexp.MustCompile(`^[A-Z]{2}$`).MatchString(code)
+}
+
+// AgeOn returns how many full years old someone born on dateOfBirth is at the given time
+func AgeOn(dateOfBirth, at time.Time) int {
+	age := at.Year() - dateOfBirth.Year()
+	if at.Month() < dateOfBirth.Month() || (at.Month() == dateOfBirth.Month() && at.Day() < dateOfBirth.Day()) {
+		age--
+	}
+	return age
+}
+
+// SaveLicenceDocument stores an uploaded scan under a random name and returns that name.
+// The file type is taken from the content, not from the client's file name.
+func SaveLicenceDocument(file io.Reader) (string, error) {
+	data, err := io.ReadAll(io.LimitReader(file, MaxLicenceDocumentSize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(data) > MaxLicenceDocumentSize {
+		return "", errors.New("licence document is too large")
+	}
+
+	extension, ok := licenceDocumentTypes[http.DetectContentType(data)]
+	if !ok {
+		return "", ErrUnsupportedDocument
+	}
+
+	name, err := GenerateVerificationToken()
+	if err != nil {
+		return "", err
+	}
+	ref := name + extension
+
+	if err := os.MkdirAll(LicenceDocumentDir, 0700); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(LicenceDocumentDir, ref), data, 0600); err != nil {
+		return "", err
+	}
+	return ref, nil
+}
+
+// LicenceDocumentPath returns the path of a stored scan, refusing references that could escape the directory
+func LicenceDocumentPath(ref string) (string, error) {
+	if !documentRefPattern.MatchString(ref) {
+		return "", errors.New("invalid document reference")
+	}
+	return filepath.Join(LicenceDocumentDir, ref), nil
+}
+
+// RemoveLicenceDocument deletes a stored scan; a missing file is not an error
+func RemoveLicenceDocument(ref string) error {
+	path, err := LicenceDocumentPath(ref)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
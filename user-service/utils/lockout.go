@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"cnad_assignment/shared/notify"
+	"cnad_assignment/user-service/database"
+	"fmt"
+	"time"
+)
+
+// LoginFailureWindow is how far back failed logins are counted
+const LoginFailureWindow = 15 * time.Minute
+
+// LoginDelayAfter is how many failures for one email or phone are allowed before each
+// further attempt must wait; the wait doubles with every failure up to LoginMaxDelay
+const LoginDelayAfter = 3
+
+// LoginMaxDelay caps the wait between attempts
+const LoginMaxDelay = 30 * time.Second
+
+// LoginLockoutThreshold is how many failures lock the account
+const LoginLockoutThreshold = 10
+
+// LoginLockoutDuration is how long a locked account refuses logins unless unlocked by email
+const LoginLockoutDuration = 30 * time.Minute
+
+// LoginMaxFailuresPerIP is how many failures one IP address may make across all accounts
+const LoginMaxFailuresPerIP = 50
+
+// MFAMaxAttemptsPerToken is how many wrong codes an MFA pending token allows before the
+// user has to enter their password again
+const MFAMaxAttemptsPerToken = 5
+
+// UnlockTokenTTL is how long the emailed unlock link stays valid
+const UnlockTokenTTL = LoginLockoutDuration
+
+// LoginDelay returns how long a client must wait after its last failure before trying again
+func LoginDelay(failures int) time.Duration {
+	if failures < LoginDelayAfter {
+		return 0
+	}
+	delay := time.Second << uint(failures-LoginDelayAfter)
+	if delay > LoginMaxDelay || delay <= 0 {
+		return LoginMaxDelay
+	}
+	return delay
+}
+
+// MFAAttemptIdentifier is the login_attempts identifier for second-factor attempts, kept
+// apart from the email or phone so a correct password does not reset the count
+func MFAAttemptIdentifier(userID int) string {
+	return fmt.Sprintf("mfa:%d", userID)
+}
+
+// SendAccountLockedEmail tells the user their account was locked and how to unlock it
+func SendAccountLockedEmail(to, unlockLink string) error {
+	return notify.SendTo(database.DB, notify.ChannelEmail, to, notify.TemplateAccountLocked, notify.Data{
+		"Link":          unlockLink,
+		"LockedMinutes": int(LoginLockoutDuration.Minutes()),
+	})
+}
@@ -0,0 +1,9 @@
+package utils
+
+import "time"
+
+// PointsPerDollar is how many loyalty points a dollar paid earns before the tier multiplier
+const PointsPerDollar = 1
+
+// LoyaltyAwardInterval is how often completed, paid rentals are checked for points to award
+const LoyaltyAwardInterval = 5 * time.Minute
@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"cnad_assignment/user-service/database"
+	"cnad_assignment/user-service/models"
+	"math"
+	"time"
+)
+
+// MembershipSchedulerInterval is how often scheduled downgrades and due renewals are checked for
+const MembershipSchedulerInterval = 5 * time.Minute
+
+// MembershipRenewalGracePeriod is how long a member has to pay a monthly renewal before
+// they drop to the free tier
+const MembershipRenewalGracePeriod = 3 * 24 * time.Hour
+
+// MembershipPeriod returns the monthly billing period containing now for a membership
+// first paid at anchor. Periods are counted from the anchor so they do not drift.
+func MembershipPeriod(anchor, now time.Time) (time.Time, time.Time) {
+	months := (now.Year()-anchor.Year())*12 + int(now.Month()-anchor.Month())
+	if months < 0 {
+		months = 0
+	}
+	// Month lengths differ, so step back until the period really starts before now
+	start := anchor.AddDate(0, months, 0)
+	for start.After(now) && months > 0 {
+		months--
+		start = anchor.AddDate(0, months, 0)
+	}
+	return start, anchor.AddDate(0, months+1, 0)
+}
+
+// UpgradeCharge returns what moving from one tier to a better one costs. Moving up from a
+// free tier costs a full month and starts a new billing period; moving between paid tiers
+// costs the fee difference for the rest of the current period.
+func UpgradeCharge(from, to models.MembershipTier, anchor *time.Time, now time.Time) float64 {
+	if anchor == nil || from.MonthlyFee == 0 {
+		return to.MonthlyFee
+	}
+
+	start, end := MembershipPeriod(*anchor, now)
+	remaining := end.Sub(now).Seconds() / end.Sub(start).Seconds()
+	charge := (to.MonthlyFee - from.MonthlyFee) * remaining
+	if charge < 0 {
+		return 0
+	}
+	return math.Round(charge*100) / 100
+}
+
+// RenewDueMemberships asks every member whose paid period has ended to pay for the next one.
+// Each renewal covers the billing period that starts where the paid one ended, so a late
+// payment does not move the billing day. It returns how many renewals were created.
+func RenewDueMemberships(now time.Time) (int, error) {
+	due, err := database.FetchDueRenewals(now)
+	if err != nil {
+		return 0, err
+	}
+
+	created := 0
+	for _, renewal := range due {
+		_, periodEnd := MembershipPeriod(renewal.Anchor, renewal.PaidUntil)
+		ok, err := database.CreateMembershipRenewal(renewal, periodEnd)
+		if err != nil {
+			return created, err
+		}
+		if ok {
+			created++
+		}
+	}
+	return created, nil
+}
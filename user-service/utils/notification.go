@@ -0,0 +1,9 @@
+package utils
+
+import "time"
+
+// NotificationDispatchInterval is how often queued notifications are delivered
+const NotificationDispatchInterval = 15 * time.Second
+
+// NotificationBatchSize limits how many notifications one dispatch run sends
+const NotificationBatchSize = 100
@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"cnad_assignment/shared/notify"
+	"cnad_assignment/user-service/database"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// One-time code limits
+const (
+	OTPLength        = 6
+	OTPTTL           = 5 * time.Minute
+	OTPMaxAttempts   = 5                // Failed guesses allowed against a single code
+	OTPResendAfter   = 60 * time.Second // Minimum gap between two codes to the same phone
+	OTPMaxPerHour    = 5                // Codes sent to the same phone per rolling hour
+	OTPPurposeVerify = "verify_phone"
+	OTPPurposeLogin  = "login"
+)
+
+var e164Pattern = regexp.MustCompile(`^\+[1-9][0-9]{7,14}$`)
+
+// NormalizePhone strips the spaces, dashes, dots and brackets people type into phone numbers
+func NormalizePhone(phone string) string {
+	return strings.NewReplacer(" ", "", "-", "", ".", "", "(", "", ")", "").Replace(strings.TrimSpace(phone))
+}
+
+// ValidatePhone checks that the phone number is in E.164 format (+ country code, up to 15 digits)
+func ValidatePhone(phone string) bool {
+	return e164Pattern.MatchString(phone)
+}
+
+// GenerateOTP creates a random numeric one-time code
+func GenerateOTP() (string, error) {
+	max := big.NewInt(1)
+	for i := 0; i < OTPLength; i++ {
+		max.Mul(max, big.NewInt(10))
+	}
+
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", OTPLength, n.Int64()), nil
+}
+
+// SendOTP queues an SMS with the one-time code to the phone
+func SendOTP(phone, code string) error {
+	return notify.SendTo(database.DB, notify.ChannelSMS, phone, notify.TemplateOneTimeCode, notify.Data{
+		"Code":           code,
+		"ExpiresMinutes": int(OTPTTL.Minutes()),
+	})
+}
@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"crypto/rand"
+	"strings"
+)
+
+// Referral credit, in loyalty points, granted once a referred user completes their first paid rental
+const (
+	ReferrerCreditPoints = 500
+	ReferredCreditPoints = 500
+)
+
+// ReferralMaxRewards is how many referrals can earn credit for a single referrer
+const ReferralMaxRewards = 20
+
+// referralAlphabet leaves out characters that are easily confused, such as 0/O and 1/I
+const referralAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// GenerateReferralCode creates a random 8-character referral code
+func GenerateReferralCode() (string, error) {
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+
+	code := make([]byte, len(random))
+	for i, b := range random {
+		code[i] = referralAlphabet[int(b)%len(referralAlphabet)]
+	}
+	return string(code), nil
+}
+
+// NormalizeReferralCode makes codes typed by users comparable with stored ones
+func NormalizeReferralCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// CanonicalMailbox reduces an email address to the mailbox that actually receives it, so
+// aliases such as "jane+2@example.com" or "j.a.n.e@gmail.com" compare equal to the original
+func CanonicalMailbox(email string) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return email
+	}
+	local, domain := email[:at], email[at+1:]
+
+	if plus := strings.Index(local, "+"); plus >= 0 {
+		local = local[:plus]
+	}
+	if domain == "googlemail.com" {
+		domain = "gmail.com"
+	}
+	if domain == "gmail.com" {
+		local = strings.ReplaceAll(local, ".", "")
+	}
+	return local + "@" + domain
+}
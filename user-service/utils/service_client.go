@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Base URLs of the other services
+const (
+	VehicleServiceURL = "http://localhost:8082"
+	BillingServiceURL = "http://localhost:8083"
+)
+
+var serviceClient = &http.Client{Timeout: 10 * time.Second}
+
+// FetchFromService GETs url on behalf of the caller, forwarding their access token,
+// and decodes the JSON response into out
+func FetchFromService(url, accessToken string, out interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := serviceClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
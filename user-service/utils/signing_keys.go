@@ -0,0 +1,146 @@
+package utils
+
+import (
+	"cnad_assignment/shared/auth"
+	"cnad_assignment/user-service/database"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// SigningKeyRotation is how long a key signs new tokens before a fresh one replaces it
+const SigningKeyRotation = 30 * 24 * time.Hour
+
+// SigningKeyRetention is how long a replaced key stays published so tokens it signed
+// can still be verified. It must exceed the lifetime of every token type.
+const SigningKeyRetention = 24 * time.Hour
+
+// SigningKeyReloadInterval is how often each replica reloads the shared keys from the database
+const SigningKeyReloadInterval = time.Minute
+
+// SigningKeyPublishLead is how long a new key is published before it signs tokens. Every
+// replica has loaded it within SigningKeyReloadInterval, and every JWKS cache refetches
+// within auth.JWKSCacheTTL, so no service sees a token signed with a key it cannot know.
+const SigningKeyPublishLead = SigningKeyReloadInterval + auth.JWKSCacheTTL
+
+// SigningKeys signs every token issued by user-service
+var SigningKeys = auth.NewKeySet(nil)
+
+// LoadSigningKeys loads the keys shared by all replicas from the database, creating the
+// first key if there is none, and makes them the key source for verifying tokens
+func LoadSigningKeys() error {
+	auth.SetKeySource(SigningKeys)
+	return RotateSigningKeys()
+}
+
+// RotateSigningKeys reloads the keys from the database, publishes a new key once the
+// newest one is older than SigningKeyRotation and deletes replaced keys once
+// SigningKeyRetention has passed
+func RotateSigningKeys() error {
+	keys, err := readSigningKeys()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if len(keys) == 0 || now.Sub(keys[len(keys)-1].CreatedAt) > SigningKeyRotation {
+		// The very first key signs straight away; nothing can have been issued before it
+		activeFrom := now.Add(SigningKeyPublishLead)
+		if len(keys) == 0 {
+			activeFrom = now
+		}
+		created, err := createSigningKey(now, activeFrom)
+		if err != nil {
+			return err
+		}
+		if created {
+			log.Printf("Published token signing key, active from %s", activeFrom.Format(time.RFC3339))
+		}
+		// Pick up the key whichever replica stored it
+		if keys, err = readSigningKeys(); err != nil {
+			return err
+		}
+	}
+
+	// A key is retired once the key after it becomes active; keep it until the retention has passed
+	var kept []auth.SigningKey
+	for i, key := range keys {
+		if i < len(keys)-1 && now.Sub(keys[i+1].ActiveFrom) > SigningKeyRetention {
+			if err := database.DeleteSigningKey(key.ID); err != nil {
+				return err
+			}
+			log.Printf("Removed retired token signing key %s", key.ID)
+			continue
+		}
+		kept = append(kept, key)
+	}
+
+	SigningKeys.Replace(kept)
+	return nil
+}
+
+// readSigningKeys reads every stored key, ordered by when it starts signing
+func readSigningKeys() ([]auth.SigningKey, error) {
+	stored, err := database.FetchSigningKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]auth.SigningKey, 0, len(stored))
+	for _, row := range stored {
+		privateKey, err := parseSigningKey(row.PrivateKeyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read signing key %s: %v", row.ID, err)
+		}
+		keys = append(keys, auth.SigningKey{
+			ID:         row.ID,
+			PrivateKey: privateKey,
+			CreatedAt:  row.CreatedAt,
+			ActiveFrom: row.ActiveFrom,
+		})
+	}
+	return keys, nil
+}
+
+// parseSigningKey decodes one PKCS #8 PEM key
+func parseSigningKey(data string) (ed25519.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, errors.New("not a PEM private key")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("not an Ed25519 key")
+	}
+	return privateKey, nil
+}
+
+// createSigningKey generates a new key that signs from activeFrom and stores it, unless
+// another replica stored a new key first. It returns whether this key was stored.
+func createSigningKey(now, activeFrom time.Time) (bool, error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return false, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return false, err
+	}
+
+	key := database.StoredSigningKey{
+		ID:            auth.KeyThumbprint(publicKey),
+		PrivateKeyPEM: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		CreatedAt:     now,
+		ActiveFrom:    activeFrom,
+	}
+	return database.CreateSigningKey(key, now.Add(-SigningKeyRotation))
+}
@@ -0,0 +1,177 @@
+// Command telemetry-simulator replays sample vehicle telemetry against a running
+// vehicle-service, as the devices in the vehicles would report it.
+//
+// The readings come from a CSV file with the columns vehicle_id, offset_seconds, latitude,
+// longitude, charge_level, odometer_km and cleanliness (which may be empty). Each reading
+// is sent offset_seconds after the replay starts, divided by -speed, and stamped with the
+// time it is sent. Reporting telemetry needs an API key with the telemetry:write scope
+// belonging to an account with the fleet:manage permission:
+//
+//	TELEMETRY_API_KEY=cs_... go run ./vehicle-service/cmd/telemetry-simulator -speed 60
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sampleTelemetry is replayed when no -file is given: three vehicles driving across
+// Singapore for ten minutes
+//
+//go:embed sample_telemetry.csv
+var sampleTelemetry string
+
+// reading is one row of the telemetry file
+type reading struct {
+	VehicleID   int
+	Offset      time.Duration
+	Latitude    float64
+	Longitude   float64
+	ChargeLevel int
+	OdometerKm  float64
+	Cleanliness string
+}
+
+func main() {
+	baseURL := flag.String("url", "http://localhost:8082", "base URL of the vehicle-service")
+	file := flag.String("file", "", "CSV file of readings to replay instead of the bundled sample")
+	speed := flag.Float64("speed", 1, "how many times faster than recorded to replay the readings")
+	apiKey := flag.String("key", os.Getenv("TELEMETRY_API_KEY"), "API key with the telemetry:write scope (default $TELEMETRY_API_KEY)")
+	flag.Parse()
+
+	if *apiKey == "" {
+		log.Fatal("An API key is required; pass -key or set TELEMETRY_API_KEY")
+	}
+	if *speed <= 0 {
+		log.Fatal("-speed must be greater than 0")
+	}
+
+	var source io.Reader = strings.NewReader(sampleTelemetry)
+	if *file != "" {
+		f, err := os.Open(*file)
+		if err != nil {
+			log.Fatalf("Failed to open %s: %v", *file, err)
+		}
+		defer f.Close()
+		source = f
+	}
+	readings, err := parseReadings(source)
+	if err != nil {
+		log.Fatalf("Failed to read telemetry: %v", err)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	start := time.Now()
+	sent, failed := 0, 0
+	for _, reading := range readings {
+		// Wait until the reading is due at the replay speed
+		due := start.Add(time.Duration(float64(reading.Offset) / *speed))
+		time.Sleep(time.Until(due))
+
+		if err := send(client, *baseURL, *apiKey, reading, due); err != nil {
+			log.Printf("Vehicle %d at +%s: %v", reading.VehicleID, reading.Offset, err)
+			failed++
+			continue
+		}
+		log.Printf("Vehicle %d at +%s: %.6f,%.6f charge %d%% odometer %.1f km", reading.VehicleID, reading.Offset,
+			reading.Latitude, reading.Longitude, reading.ChargeLevel, reading.OdometerKm)
+		sent++
+	}
+
+	fmt.Printf("Replayed %d readings, %d failed\n", sent, failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// parseReadings reads a telemetry CSV file with a header row, sorted by offset
+func parseReadings(source io.Reader) ([]reading, error) {
+	records, err := csv.NewReader(source).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) < 2 {
+		return nil, errors.New("no readings")
+	}
+
+	var readings []reading
+	for i, record := range records[1:] {
+		line := i + 2
+		if len(record) != 7 {
+			return nil, fmt.Errorf("line %d: expected 7 columns, got %d", line, len(record))
+		}
+		var r reading
+		var offset int
+		var errs []error
+		var err error
+		r.VehicleID, err = strconv.Atoi(record[0])
+		errs = append(errs, err)
+		offset, err = strconv.Atoi(record[1])
+		errs = append(errs, err)
+		r.Latitude, err = strconv.ParseFloat(record[2], 64)
+		errs = append(errs, err)
+		r.Longitude, err = strconv.ParseFloat(record[3], 64)
+		errs = append(errs, err)
+		r.ChargeLevel, err = strconv.Atoi(record[4])
+		errs = append(errs, err)
+		r.OdometerKm, err = strconv.ParseFloat(record[5], 64)
+		errs = append(errs, err)
+		if err := errors.Join(errs...); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		if len(readings) > 0 && time.Duration(offset)*time.Second < readings[len(readings)-1].Offset {
+			return nil, fmt.Errorf("line %d: readings must be sorted by offset_seconds", line)
+		}
+		r.Offset = time.Duration(offset) * time.Second
+		r.Cleanliness = record[6]
+		readings = append(readings, r)
+	}
+	return readings, nil
+}
+
+// send reports a reading to the vehicle-service's telemetry endpoint
+func send(client *http.Client, baseURL, apiKey string, r reading, recordedAt time.Time) error {
+	payload, err := json.Marshal(map[string]interface{}{
+		"latitude":     r.Latitude,
+		"longitude":    r.Longitude,
+		"charge_level": r.ChargeLevel,
+		"odometer_km":  r.OdometerKm,
+		"cleanliness":  r.Cleanliness,
+		"recorded_at":  recordedAt.Format(time.RFC3339),
+	})
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%s/api/v1/vehicles/%d/telemetry", strings.TrimRight(baseURL, "/"), r.VehicleID)
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
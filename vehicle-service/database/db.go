@@ -2,9 +2,10 @@ package database
 
 import (
 	"database/sql"
+	"errors"
 	"log"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql" // MySQL driver, also used to inspect MySQL error codes
 )
 
 var DB *sql.DB
@@ -22,3 +23,12 @@ func InitDB() {
 
 	log.Println("Database connected successfully")
 }
+
+// mysqlDuplicateEntry is the MySQL error number for a unique key violation
+const mysqlDuplicateEntry = 1062
+
+// IsDuplicateEntry reports whether err is a unique key violation, e.g. a registration number already in the fleet
+func IsDuplicateEntry(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlDuplicateEntry
+}
@@ -0,0 +1,277 @@
+package database
+
+import (
+	"cnad_assignment/vehicle-service/models"
+	"database/sql"
+	"errors"
+)
+
+// ErrVehicleRetired is returned when booking, re-enabling or retiring a vehicle that has been retired
+var ErrVehicleRetired = errors.New("vehicle is retired")
+
+// ErrVehicleHasHistory is returned when deleting a vehicle that has rentals which started
+// or were canceled; it must be retired instead so the history is kept
+var ErrVehicleHasHistory = errors.New("vehicle has rental history")
+
+// ErrVehicleHasFutureBookings is returned when deleting a vehicle with upcoming bookings
+// without saying where they should go
+var ErrVehicleHasFutureBookings = errors.New("vehicle has future bookings")
+
+// ErrInvalidReassignment is returned when future bookings cannot be moved to the chosen
+// vehicle because it does not exist, is retired or is the vehicle being deleted
+var ErrInvalidReassignment = errors.New("invalid vehicle to reassign bookings to")
+
+// ErrReassignmentConflict is returned when the vehicle chosen for reassignment is already
+// booked at the time of one of the bookings to move
+var ErrReassignmentConflict = errors.New("reassignment target has overlapping bookings")
+
+// Fleet listing filters
+const (
+	FleetActive  = "active"
+	FleetRetired = "retired"
+	FleetAll     = "all"
+)
+
+// vehicleColumns are the columns scanVehicle reads, in order
+const vehicleColumns = `v.id, v.make, v.model, v.registration_number, v.is_available, v.high_demand, v.released_at,
+        v.created_at, v.home_station_id, v.retired_at, COALESCE(v.retirement_reason, '')`
+
+// scanVehicle reads a row selected with vehicleColumns
+func scanVehicle(row interface{ Scan(...interface{}) error }) (models.Vehicle, error) {
+	var v models.Vehicle
+	var releasedAt, retiredAt sql.NullTime
+	var homeStationID sql.NullInt64
+	err := row.Scan(&v.ID, &v.Make, &v.Model, &v.RegistrationNumber, &v.IsAvailable, &v.HighDemand, &releasedAt,
+		&v.CreatedAt, &homeStationID, &retiredAt, &v.RetirementReason)
+	if releasedAt.Valid {
+		v.ReleasedAt = &releasedAt.Time
+	}
+	if homeStationID.Valid {
+		id := int(homeStationID.Int64)
+		v.HomeStationID = &id
+	}
+	if retiredAt.Valid {
+		v.RetiredAt = &retiredAt.Time
+	}
+	return v, err
+}
+
+// FetchVehicle returns a vehicle of the fleet, including retired vehicles
+func FetchVehicle(vehicleID int) (models.Vehicle, error) {
+	vehicle, err := scanVehicle(DB.QueryRow("SELECT "+vehicleColumns+" FROM vehicles v WHERE v.id = ?", vehicleID))
+	if err == sql.ErrNoRows {
+		return vehicle, ErrVehicleNotFound
+	}
+	return vehicle, err
+}
+
+// FetchFleet returns the vehicles with the given status (FleetActive, FleetRetired or FleetAll), by ID
+func FetchFleet(status string) ([]models.Vehicle, error) {
+	query := "SELECT " + vehicleColumns + " FROM vehicles v"
+	switch status {
+	case FleetActive:
+		query += " WHERE v.retired_at IS NULL"
+	case FleetRetired:
+		query += " WHERE v.retired_at IS NOT NULL"
+	}
+	rows, err := DB.Query(query + " ORDER BY v.id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	vehicles := []models.Vehicle{}
+	for rows.Next() {
+		vehicle, err := scanVehicle(rows)
+		if err != nil {
+			return nil, err
+		}
+		vehicles = append(vehicles, vehicle)
+	}
+	return vehicles, rows.Err()
+}
+
+// CreateVehicle adds a vehicle to the fleet, released for booking straight away if it is
+// available, and returns its ID. A vehicle with a home station starts out parked there.
+func CreateVehicle(vehicle models.Vehicle) (int, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	query := `
+        INSERT INTO vehicles (make, model, registration_number, is_available, high_demand, released_at, home_station_id)
+        VALUES (?, ?, ?, ?, ?, IF(?, NOW(), NULL), ?)
+    `
+	result, err := tx.Exec(query, vehicle.Make, vehicle.Model, vehicle.RegistrationNumber, vehicle.IsAvailable,
+		vehicle.HighDemand, vehicle.IsAvailable, vehicle.HomeStationID)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	vehicleID, err := result.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if vehicle.HomeStationID != nil {
+		parkQuery := "INSERT INTO vehicle_status (vehicle_id, location, station_id) SELECT ?, name, id FROM stations WHERE id = ?"
+		if _, err := tx.Exec(parkQuery, vehicleID, *vehicle.HomeStationID); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+
+	return int(vehicleID), tx.Commit()
+}
+
+// UpdateVehicle changes the make, model, registration number and home station of a vehicle
+func UpdateVehicle(vehicleID int, make, model, registrationNumber string, homeStationID *int) error {
+	query := "UPDATE vehicles SET make = ?, model = ?, registration_number = ?, home_station_id = ? WHERE id = ?"
+	if _, err := DB.Exec(query, make, model, registrationNumber, homeStationID, vehicleID); err != nil {
+		return err
+	}
+
+	// MySQL reports no affected rows when nothing changed, so check the vehicle exists
+	_, err := FetchVehicle(vehicleID)
+	return err
+}
+
+// RetireVehicle takes a vehicle out of the fleet for good. It stops taking new bookings
+// while the bookings it already has go ahead. It returns how many of those are still to come.
+func RetireVehicle(vehicleID int, reason string) (int, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	// Lock the vehicle so a booking being made right now either finishes first or sees it retired
+	var retired bool
+	err = tx.QueryRow("SELECT retired_at IS NOT NULL FROM vehicles WHERE id = ? FOR UPDATE", vehicleID).Scan(&retired)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		return 0, ErrVehicleNotFound
+	}
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	if retired {
+		tx.Rollback()
+		return 0, ErrVehicleRetired
+	}
+
+	query := "UPDATE vehicles SET retired_at = NOW(), retirement_reason = NULLIF(?, ''), is_available = FALSE WHERE id = ?"
+	if _, err := tx.Exec(query, reason, vehicleID); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	var upcoming int
+	countQuery := "SELECT COUNT(*) FROM bookings WHERE vehicle_id = ? AND status IN ('confirmed', 'modified') AND end_time > NOW()"
+	if err := tx.QueryRow(countQuery, vehicleID).Scan(&upcoming); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	return upcoming, tx.Commit()
+}
+
+// DeleteVehicle removes a vehicle that has never been rented. Its future bookings are
+// moved to reassignTo, or the deletion fails with ErrVehicleHasFutureBookings when
+// reassignTo is 0. It returns how many bookings were moved.
+func DeleteVehicle(vehicleID, reassignTo int) (int, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	var exists bool
+	if err := tx.QueryRow("SELECT TRUE FROM vehicles WHERE id = ? FOR UPDATE", vehicleID).Scan(&exists); err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			return 0, ErrVehicleNotFound
+		}
+		return 0, err
+	}
+
+	// Bookings that have not started yet can move; anything else is history that invoices
+	// and payments may point at
+	var future, history int
+	countQuery := `
+        SELECT COALESCE(SUM(status IN ('confirmed', 'modified') AND start_time > NOW()), 0),
+               COALESCE(SUM(NOT (status IN ('confirmed', 'modified') AND start_time > NOW())), 0)
+        FROM bookings
+        WHERE vehicle_id = ?
+    `
+	if err := tx.QueryRow(countQuery, vehicleID).Scan(&future, &history); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	if history > 0 {
+		tx.Rollback()
+		return 0, ErrVehicleHasHistory
+	}
+	if future > 0 && reassignTo == 0 {
+		tx.Rollback()
+		return 0, ErrVehicleHasFutureBookings
+	}
+
+	if future > 0 {
+		if reassignTo == vehicleID {
+			tx.Rollback()
+			return 0, ErrInvalidReassignment
+		}
+		var targetRetired bool
+		err := tx.QueryRow("SELECT retired_at IS NOT NULL FROM vehicles WHERE id = ? FOR UPDATE", reassignTo).Scan(&targetRetired)
+		if err == sql.ErrNoRows || (err == nil && targetRetired) {
+			tx.Rollback()
+			return 0, ErrInvalidReassignment
+		}
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+
+		var conflicts int
+		conflictQuery := `
+            SELECT COUNT(*)
+            FROM bookings moving
+            JOIN bookings taken ON taken.vehicle_id = ? AND taken.status IN ('confirmed', 'modified')
+             AND taken.start_time < moving.end_time AND taken.end_time > moving.start_time
+            WHERE moving.vehicle_id = ?
+        `
+		if err := tx.QueryRow(conflictQuery, reassignTo, vehicleID).Scan(&conflicts); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		if conflicts > 0 {
+			tx.Rollback()
+			return 0, ErrReassignmentConflict
+		}
+	}
+
+	statements := []struct {
+		query string
+		args  []interface{}
+	}{
+		{"DELETE FROM vehicle_telemetry WHERE vehicle_id = ?", []interface{}{vehicleID}},
+		{"DELETE FROM vehicle_status WHERE vehicle_id = ?", []interface{}{vehicleID}},
+		{"DELETE FROM vehicles WHERE id = ?", []interface{}{vehicleID}},
+	}
+	if future > 0 {
+		statements = append([]struct {
+			query string
+			args  []interface{}
+		}{{"UPDATE bookings SET vehicle_id = ? WHERE vehicle_id = ?", []interface{}{reassignTo, vehicleID}}}, statements...)
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt.query, stmt.args...); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+
+	return future, tx.Commit()
+}
@@ -0,0 +1,95 @@
+package database
+
+import (
+	"cnad_assignment/vehicle-service/models"
+	"cnad_assignment/vehicle-service/utils"
+	"database/sql"
+	"math"
+	"strings"
+	"time"
+)
+
+// vehicleLatitude and vehicleLongitude place a vehicle at its latest reported position, or
+// else at the station it is parked at
+const (
+	vehicleLatitude  = "COALESCE(vs.latitude, s.latitude)"
+	vehicleLongitude = "COALESCE(vs.longitude, s.longitude)"
+)
+
+// NearbySearch finds available vehicles around a point. Zero values leave a filter unset.
+type NearbySearch struct {
+	Latitude  float64
+	Longitude float64
+	RadiusKm  float64
+	StartTime time.Time // With EndTime, only vehicles without an active booking overlapping the window
+	EndTime   time.Time
+	MinCharge int
+	Limit     int
+}
+
+// SearchNearbyVehicles returns up to search.Limit available vehicles within the radius,
+// nearest first
+func SearchNearbyVehicles(search NearbySearch) ([]models.NearbyVehicle, error) {
+	minLat, maxLat, minLng, maxLng := utils.BoundingBox(search.Latitude, search.Longitude, search.RadiusKm)
+	conditions := []string{
+		"v.is_available = TRUE",
+		vehicleLatitude + " BETWEEN ? AND ?",
+		vehicleLongitude + " BETWEEN ? AND ?",
+	}
+	args := []interface{}{minLat, maxLat, minLng, maxLng}
+	if !search.StartTime.IsZero() && !search.EndTime.IsZero() {
+		conditions = append(conditions, freeDuringCondition)
+		args = append(args, search.EndTime, search.StartTime)
+	}
+	if search.MinCharge > 0 {
+		conditions = append(conditions, "vs.charge_level >= ?")
+		args = append(args, search.MinCharge)
+	}
+
+	// ST_Distance_Sphere takes points as longitude, latitude and returns metres
+	distance := "ST_Distance_Sphere(POINT(" + vehicleLongitude + ", " + vehicleLatitude + "), POINT(?, ?)) / 1000"
+	query := `
+        SELECT v.id, v.make, v.model, v.registration_number, v.is_available, v.high_demand, v.released_at, v.created_at,
+               COALESCE(vs.location, s.name, ''), vs.charge_level, COALESCE(vs.cleanliness, ''), s.id, COALESCE(s.name, ''),
+               ` + vehicleLatitude + `, ` + vehicleLongitude + `, ` + distance + ` AS distance_km
+        FROM vehicles v
+        LEFT JOIN vehicle_status vs ON vs.vehicle_id = v.id
+        LEFT JOIN stations s ON s.id = vs.station_id
+        WHERE ` + strings.Join(conditions, " AND ") + `
+        HAVING distance_km <= ?
+        ORDER BY distance_km, v.id
+        LIMIT ?
+    `
+	args = append([]interface{}{search.Longitude, search.Latitude}, args...)
+	rows, err := DB.Query(query, append(args, search.RadiusKm, search.Limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	vehicles := []models.NearbyVehicle{}
+	for rows.Next() {
+		var v models.NearbyVehicle
+		var releasedAt sql.NullTime
+		var chargeLevel, stationID sql.NullInt64
+		err := rows.Scan(&v.ID, &v.Make, &v.Model, &v.RegistrationNumber, &v.IsAvailable, &v.HighDemand, &releasedAt, &v.CreatedAt,
+			&v.Location, &chargeLevel, &v.Cleanliness, &stationID, &v.StationName, &v.Latitude, &v.Longitude, &v.DistanceKm)
+		if err != nil {
+			return nil, err
+		}
+		if releasedAt.Valid {
+			v.ReleasedAt = &releasedAt.Time
+		}
+		if chargeLevel.Valid {
+			level := int(chargeLevel.Int64)
+			v.ChargeLevel = &level
+		}
+		if stationID.Valid {
+			id := int(stationID.Int64)
+			v.StationID = &id
+		}
+		v.DistanceKm = math.Round(v.DistanceKm*100) / 100
+		vehicles = append(vehicles, v)
+	}
+	return vehicles, rows.Err()
+}
@@ -0,0 +1,111 @@
+package database
+
+import (
+	"cnad_assignment/vehicle-service/models"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// OverdueReturnWindow is how long after a booking ends a vehicle that was never handed back
+// is still chased and listed with the user's current bookings
+const OverdueReturnWindow = 24 * time.Hour
+
+// ErrBookingNotReturnable is returned when returning a booking that has not started, was
+// canceled or was already returned
+var ErrBookingNotReturnable = errors.New("booking cannot be returned")
+
+// bookingNoticeQuery selects the booking details notifications mention
+const bookingNoticeQuery = `
+        SELECT b.id, b.user_id, CONCAT(v.make, ' ', v.model, ' (', v.registration_number, ')'), b.start_time, b.end_time
+        FROM bookings b
+        JOIN vehicles v ON v.id = b.vehicle_id
+    `
+
+// scanBookingNotices reads the rows of a bookingNoticeQuery
+func scanBookingNotices(rows *sql.Rows) ([]models.BookingNotice, error) {
+	defer rows.Close()
+
+	var notices []models.BookingNotice
+	for rows.Next() {
+		var notice models.BookingNotice
+		if err := rows.Scan(&notice.BookingID, &notice.UserID, &notice.Vehicle, &notice.StartTime, &notice.EndTime); err != nil {
+			return nil, err
+		}
+		notices = append(notices, notice)
+	}
+	return notices, rows.Err()
+}
+
+// FetchBookingNotice returns what notifications say about the booking
+func FetchBookingNotice(bookingID int) (models.BookingNotice, error) {
+	var notice models.BookingNotice
+	err := DB.QueryRow(bookingNoticeQuery+" WHERE b.id = ?", bookingID).
+		Scan(&notice.BookingID, &notice.UserID, &notice.Vehicle, &notice.StartTime, &notice.EndTime)
+	if err == sql.ErrNoRows {
+		return notice, ErrBookingNotFound
+	}
+	return notice, err
+}
+
+// FetchBookingsStartingBefore returns the active bookings that have not started yet but
+// will by until
+func FetchBookingsStartingBefore(now, until time.Time) ([]models.BookingNotice, error) {
+	rows, err := DB.Query(bookingNoticeQuery+" WHERE b.status IN ('confirmed', 'modified') AND b.start_time > ? AND b.start_time <= ?", now, until)
+	if err != nil {
+		return nil, err
+	}
+	return scanBookingNotices(rows)
+}
+
+// FetchOverdueReturns returns the bookings that ended before dueBefore, but no longer
+// than OverdueReturnWindow ago, whose vehicle has not been returned
+func FetchOverdueReturns(now, dueBefore time.Time) ([]models.BookingNotice, error) {
+	query := bookingNoticeQuery + `
+        WHERE b.status <> 'canceled' AND b.returned_at IS NULL
+          AND b.end_time <= ? AND b.end_time > ?
+    `
+	rows, err := DB.Query(query, dueBefore, now.Add(-OverdueReturnWindow))
+	if err != nil {
+		return nil, err
+	}
+	return scanBookingNotices(rows)
+}
+
+// MarkBookingReturned records that the renter handed the vehicle back. A vehicle booked
+// with stations is then parked at the drop-off station.
+func MarkBookingReturned(bookingID int) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	query := "UPDATE bookings SET returned_at = NOW() WHERE id = ? AND status <> 'canceled' AND returned_at IS NULL AND start_time <= NOW()"
+	result, err := tx.Exec(query, bookingID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err == nil && rowsAffected == 0 {
+		err = ErrBookingNotReturnable
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	parkQuery := `
+        INSERT INTO vehicle_status (vehicle_id, location, station_id)
+        SELECT b.vehicle_id, s.name, s.id
+        FROM bookings b
+        JOIN stations s ON s.id = COALESCE(b.dropoff_station_id, b.pickup_station_id)
+        WHERE b.id = ?
+        ON DUPLICATE KEY UPDATE location = VALUES(location), station_id = VALUES(station_id)
+    `
+	if _, err := tx.Exec(parkQuery, bookingID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,268 @@
+package database
+
+import (
+	"cnad_assignment/vehicle-service/models"
+	"cnad_assignment/vehicle-service/utils"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrStationNotFound is returned for stations that do not exist
+var ErrStationNotFound = errors.New("station not found")
+
+// ErrPickupStationMismatch is returned when a booking asks to pick the vehicle up at a
+// station other than the one it will be parked at when the booking starts
+var ErrPickupStationMismatch = errors.New("vehicle is not at the pick-up station")
+
+// ErrPickupStationClosed is returned when the pick-up station is closed when the booking starts
+var ErrPickupStationClosed = errors.New("pick-up station is closed at the start of the booking")
+
+// ErrDropoffStationClosed is returned when the drop-off station is closed when the booking ends
+var ErrDropoffStationClosed = errors.New("drop-off station is closed at the end of the booking")
+
+// ErrDropoffStationFull is returned when a one-way trip would bring a vehicle to a station
+// that has no room left for it
+var ErrDropoffStationFull = errors.New("drop-off station is full")
+
+// ErrDropoffStrandsBooking is returned when a one-way trip would leave the vehicle away from
+// the station its next booking picks it up at
+var ErrDropoffStrandsBooking = errors.New("vehicle's next booking picks it up at another station")
+
+// stationColumns are the columns scanStation reads, in order
+const stationColumns = `id, name, COALESCE(address, ''), latitude, longitude, capacity,
+        COALESCE(TIME_FORMAT(opens_at, '%H:%i'), ''), COALESCE(TIME_FORMAT(closes_at, '%H:%i'), ''), created_at`
+
+// scanStation reads a row selected with stationColumns
+func scanStation(row interface{ Scan(...interface{}) error }) (models.Station, error) {
+	var s models.Station
+	err := row.Scan(&s.ID, &s.Name, &s.Address, &s.Latitude, &s.Longitude, &s.Capacity, &s.OpensAt, &s.ClosesAt, &s.CreatedAt)
+	return s, err
+}
+
+// FetchStations returns every station by name
+func FetchStations() ([]models.Station, error) {
+	rows, err := DB.Query("SELECT " + stationColumns + " FROM stations ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stations := []models.Station{}
+	for rows.Next() {
+		station, err := scanStation(rows)
+		if err != nil {
+			return nil, err
+		}
+		stations = append(stations, station)
+	}
+	return stations, rows.Err()
+}
+
+// FetchStation returns a station
+func FetchStation(stationID int) (models.Station, error) {
+	station, err := scanStation(DB.QueryRow("SELECT "+stationColumns+" FROM stations WHERE id = ?", stationID))
+	if err == sql.ErrNoRows {
+		return station, ErrStationNotFound
+	}
+	return station, err
+}
+
+// CreateStation adds a station and returns its ID
+func CreateStation(station models.Station) (int, error) {
+	query := `
+        INSERT INTO stations (name, address, latitude, longitude, capacity, opens_at, closes_at)
+        VALUES (?, NULLIF(?, ''), ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''))
+    `
+	result, err := DB.Exec(query, station.Name, station.Address, station.Latitude, station.Longitude, station.Capacity,
+		station.OpensAt, station.ClosesAt)
+	if err != nil {
+		return 0, err
+	}
+
+	stationID, err := result.LastInsertId()
+	return int(stationID), err
+}
+
+// UpdateStation changes the name, address, position, capacity and opening hours of a station
+func UpdateStation(station models.Station) error {
+	query := `
+        UPDATE stations
+        SET name = ?, address = NULLIF(?, ''), latitude = ?, longitude = ?, capacity = ?,
+            opens_at = NULLIF(?, ''), closes_at = NULLIF(?, '')
+        WHERE id = ?
+    `
+	_, err := DB.Exec(query, station.Name, station.Address, station.Latitude, station.Longitude, station.Capacity,
+		station.OpensAt, station.ClosesAt, station.ID)
+	if err != nil {
+		return err
+	}
+
+	// MySQL reports no affected rows when nothing changed, so check the station exists
+	_, err = FetchStation(station.ID)
+	return err
+}
+
+// ParkVehicleAtStation records that a vehicle is parked at a station, which also becomes its
+// location. A stationID of 0 records that it is not at any station.
+func ParkVehicleAtStation(vehicleID, stationID int) error {
+	if _, err := FetchVehicle(vehicleID); err != nil {
+		return err
+	}
+	if stationID == 0 {
+		_, err := DB.Exec("UPDATE vehicle_status SET station_id = NULL WHERE vehicle_id = ?", vehicleID)
+		return err
+	}
+
+	query := `
+        INSERT INTO vehicle_status (vehicle_id, location, station_id)
+        SELECT ?, name, id FROM stations WHERE id = ?
+        ON DUPLICATE KEY UPDATE location = VALUES(location), station_id = VALUES(station_id)
+    `
+	result, err := DB.Exec(query, vehicleID, stationID)
+	if err != nil {
+		return err
+	}
+	// Nothing is inserted or updated when the station does not exist, and MySQL also reports
+	// no affected rows when the vehicle was already parked there
+	if affected, err := result.RowsAffected(); err != nil || affected > 0 {
+		return err
+	}
+	_, err = FetchStation(stationID)
+	return err
+}
+
+// pendingBookingCondition keeps bookings b whose vehicle has not been handed back yet. Its
+// argument is the end time before which bookings are no longer chased, as returned by
+// pendingSince; the limit applies whatever the status, so a booking that is never
+// completed or returned does not hold on to station capacity for good.
+const pendingBookingCondition = `b.returned_at IS NULL AND b.status IN ('confirmed', 'modified', 'completed') AND b.end_time > ?`
+
+// pendingSince is the argument of pendingBookingCondition
+func pendingSince() time.Time {
+	return time.Now().Add(-OverdueReturnWindow)
+}
+
+// vehicleStationAt returns the station a vehicle will be parked at, at the given time: where
+// its last booking ending before then hands it back, else where it is parked now, else its
+// home station. It returns nil for vehicles that are not kept at stations.
+func vehicleStationAt(tx *sql.Tx, vehicleID, excludeBookingID int, at time.Time) (*int, error) {
+	query := `
+        SELECT COALESCE(
+            (SELECT COALESCE(b.dropoff_station_id, b.pickup_station_id)
+             FROM bookings b
+             WHERE b.vehicle_id = v.id AND b.id <> ? AND b.end_time <= ? AND ` + pendingBookingCondition + `
+             ORDER BY b.end_time DESC
+             LIMIT 1),
+            vs.station_id, v.home_station_id)
+        FROM vehicles v
+        LEFT JOIN vehicle_status vs ON vs.vehicle_id = v.id
+        WHERE v.id = ?
+    `
+	var stationID sql.NullInt64
+	err := tx.QueryRow(query, excludeBookingID, at, pendingSince(), vehicleID).Scan(&stationID)
+	if err == sql.ErrNoRows {
+		return nil, ErrVehicleNotFound
+	}
+	if err != nil || !stationID.Valid {
+		return nil, err
+	}
+	id := int(stationID.Int64)
+	return &id, nil
+}
+
+// stationOccupancy returns the most vehicles a station may hold from the given time on:
+// those parked there, plus every one-way trip still to arrive, minus the one-way trips that
+// will have left by then. Later departures are left out, so it never counts too few.
+func stationOccupancy(tx *sql.Tx, stationID, excludeBookingID int, at time.Time) (int, error) {
+	query := `
+        SELECT
+            (SELECT COUNT(*) FROM vehicle_status WHERE station_id = ?)
+          + (SELECT COUNT(*) FROM bookings b
+             WHERE b.dropoff_station_id = ? AND NOT (b.pickup_station_id <=> b.dropoff_station_id)
+               AND b.id <> ? AND ` + pendingBookingCondition + `)
+          - (SELECT COUNT(*) FROM bookings b
+             WHERE b.pickup_station_id = ? AND b.dropoff_station_id <> b.pickup_station_id AND b.start_time <= ?
+               AND b.id <> ? AND ` + pendingBookingCondition + `)
+    `
+	since := pendingSince()
+	var occupancy int
+	err := tx.QueryRow(query, stationID, stationID, excludeBookingID, since, stationID, at, excludeBookingID, since).Scan(&occupancy)
+	return occupancy, err
+}
+
+// resolveBookingStations fills in and checks the pick-up and drop-off stations of a booking
+// of the vehicle, leaving out the booking with ID excludeBookingID when it is being changed.
+// The pick-up station defaults to where the vehicle will be parked and must match it; the
+// drop-off station defaults to the pick-up station. Both must be open at the time, and a
+// one-way trip needs room at the drop-off station and must not strand the vehicle's next
+// booking. It locks the drop-off station so one-way trips to it are checked one at a time.
+func resolveBookingStations(tx *sql.Tx, vehicleID, excludeBookingID int, booking *models.Booking) error {
+	expected, err := vehicleStationAt(tx, vehicleID, excludeBookingID, booking.StartTime)
+	if err != nil {
+		return err
+	}
+	if booking.PickupStationID == nil {
+		booking.PickupStationID = expected
+	} else if expected == nil || *expected != *booking.PickupStationID {
+		return ErrPickupStationMismatch
+	}
+	if booking.DropoffStationID == nil {
+		booking.DropoffStationID = booking.PickupStationID
+	}
+
+	if booking.PickupStationID != nil {
+		pickup, err := scanStation(tx.QueryRow("SELECT "+stationColumns+" FROM stations WHERE id = ?", *booking.PickupStationID))
+		if err == sql.ErrNoRows {
+			return ErrStationNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if !utils.StationOpenAt(pickup.OpensAt, pickup.ClosesAt, booking.StartTime) {
+			return ErrPickupStationClosed
+		}
+	}
+	if booking.DropoffStationID == nil {
+		return nil
+	}
+
+	dropoff, err := scanStation(tx.QueryRow("SELECT "+stationColumns+" FROM stations WHERE id = ? FOR UPDATE", *booking.DropoffStationID))
+	if err == sql.ErrNoRows {
+		return ErrStationNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if !utils.StationOpenAt(dropoff.OpensAt, dropoff.ClosesAt, booking.EndTime) {
+		return ErrDropoffStationClosed
+	}
+	if booking.PickupStationID != nil && *booking.PickupStationID == dropoff.ID {
+		return nil
+	}
+
+	occupancy, err := stationOccupancy(tx, dropoff.ID, excludeBookingID, booking.EndTime)
+	if err != nil {
+		return err
+	}
+	if occupancy >= dropoff.Capacity {
+		return ErrDropoffStationFull
+	}
+
+	var nextPickup sql.NullInt64
+	nextQuery := `
+        SELECT pickup_station_id
+        FROM bookings
+        WHERE vehicle_id = ? AND id <> ? AND status IN ('confirmed', 'modified') AND start_time >= ?
+        ORDER BY start_time
+        LIMIT 1
+    `
+	err = tx.QueryRow(nextQuery, vehicleID, excludeBookingID, booking.EndTime).Scan(&nextPickup)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if nextPickup.Valid && int(nextPickup.Int64) != dropoff.ID {
+		return ErrDropoffStrandsBooking
+	}
+	return nil
+}
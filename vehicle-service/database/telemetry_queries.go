@@ -0,0 +1,98 @@
+package database
+
+import (
+	"cnad_assignment/vehicle-service/models"
+	"database/sql"
+	"time"
+)
+
+// RecordTelemetry stores a reading in the vehicle's history. It also becomes the vehicle's
+// latest status unless a newer reading has already been recorded, which happens when a
+// device sends readings it buffered while offline. It reports whether the status changed.
+func RecordTelemetry(reading models.TelemetryReading) (bool, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return false, err
+	}
+
+	var exists bool
+	if err := tx.QueryRow("SELECT TRUE FROM vehicles WHERE id = ?", reading.VehicleID).Scan(&exists); err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			return false, ErrVehicleNotFound
+		}
+		return false, err
+	}
+
+	insertQuery := `
+        INSERT INTO vehicle_telemetry (vehicle_id, latitude, longitude, charge_level, odometer_km, cleanliness, recorded_at)
+        VALUES (?, ?, ?, ?, ?, NULLIF(?, ''), ?)
+    `
+	_, err = tx.Exec(insertQuery, reading.VehicleID, reading.Latitude, reading.Longitude, reading.ChargeLevel,
+		reading.OdometerKm, reading.Cleanliness, reading.RecordedAt)
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	// Lock the status so two readings arriving together cannot both think they are the newest
+	var reportedAt sql.NullTime
+	err = tx.QueryRow("SELECT reported_at FROM vehicle_status WHERE vehicle_id = ? FOR UPDATE", reading.VehicleID).Scan(&reportedAt)
+	if err != nil && err != sql.ErrNoRows {
+		tx.Rollback()
+		return false, err
+	}
+	if reportedAt.Valid && reading.RecordedAt.Before(reportedAt.Time) {
+		return false, tx.Commit()
+	}
+
+	// Cleanliness is kept when the device did not report it
+	statusQuery := `
+        INSERT INTO vehicle_status (vehicle_id, charge_level, cleanliness, latitude, longitude, odometer_km, reported_at)
+        VALUES (?, ?, COALESCE(NULLIF(?, ''), 'clean'), ?, ?, ?, ?)
+        ON DUPLICATE KEY UPDATE
+            charge_level = VALUES(charge_level),
+            cleanliness = COALESCE(NULLIF(?, ''), cleanliness),
+            latitude = VALUES(latitude),
+            longitude = VALUES(longitude),
+            odometer_km = VALUES(odometer_km),
+            reported_at = VALUES(reported_at)
+    `
+	_, err = tx.Exec(statusQuery, reading.VehicleID, reading.ChargeLevel, reading.Cleanliness, reading.Latitude,
+		reading.Longitude, reading.OdometerKm, reading.RecordedAt, reading.Cleanliness)
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// FetchTelemetry returns up to limit readings of a vehicle recorded from from (inclusive)
+// until to (exclusive), newest first
+func FetchTelemetry(vehicleID int, from, to time.Time, limit int) ([]models.TelemetryReading, error) {
+	query := `
+        SELECT vehicle_id, latitude, longitude, charge_level, odometer_km, COALESCE(cleanliness, ''), recorded_at
+        FROM vehicle_telemetry
+        WHERE vehicle_id = ? AND recorded_at >= ? AND recorded_at < ?
+        ORDER BY recorded_at DESC, id DESC
+        LIMIT ?
+    `
+	rows, err := DB.Query(query, vehicleID, from, to, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	readings := []models.TelemetryReading{}
+	for rows.Next() {
+		var reading models.TelemetryReading
+		err := rows.Scan(&reading.VehicleID, &reading.Latitude, &reading.Longitude, &reading.ChargeLevel,
+			&reading.OdometerKm, &reading.Cleanliness, &reading.RecordedAt)
+		if err != nil {
+			return nil, err
+		}
+		readings = append(readings, reading)
+	}
+	return readings, rows.Err()
+}
@@ -9,30 +9,62 @@ import (
 	"time"
 )
 
-func FetchAvailableVehicles() ([]models.Vehicle, error) {
-	query := "SELECT id, make, model, registration_number, is_available FROM vehicles WHERE is_available = TRUE"
-	rows, err := DB.Query(query)
+// ErrBookingLimitReached is returned when the user already has as many active bookings as their tier allows
+var ErrBookingLimitReached = errors.New("active booking limit reached")
+
+// ErrAccountSuspended is returned when a suspended user tries to book or change a booking
+var ErrAccountSuspended = errors.New("account suspended")
+
+// CreateBooking books the vehicle unless the user is suspended, the vehicle is retired, the
+// time overlaps another booking, the stations do not work out or the user already has
+// bookingLimit active bookings. A bookingLimit of 0 means no limit. The pick-up and drop-off
+// stations of the booking are filled in as resolveBookingStations settles them. It returns
+// the ID of the new booking.
+func CreateBooking(vehicleID int, booking *models.Booking, bookingLimit int) (int, error) {
+	tx, err := DB.Begin() // Begin a database transaction
 	if err != nil {
-		return nil, err
+		log.Printf("Error starting transaction: %v", err)
+		return 0, err
 	}
-	defer rows.Close()
 
-	var vehicles []models.Vehicle
-	for rows.Next() {
-		var v models.Vehicle
-		if err := rows.Scan(&v.ID, &v.Make, &v.Model, &v.RegistrationNumber, &v.IsAvailable); err != nil {
-			return nil, err
-		}
-		vehicles = append(vehicles, v)
+	// Lock the user so a concurrent suspension or booking cannot slip past the checks below
+	var suspended bool
+	if err := tx.QueryRow("SELECT suspended_at IS NOT NULL FROM users WHERE id = ? FOR UPDATE", booking.UserID).Scan(&suspended); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	if suspended {
+		tx.Rollback()
+		return 0, ErrAccountSuspended
 	}
-	return vehicles, nil
-}
 
-func CreateBooking(vehicleID int, booking models.Booking) error {
-	tx, err := DB.Begin() // Begin a database transaction
+	// Lock the vehicle too, so it cannot be retired while it is being booked
+	var retired bool
+	err = tx.QueryRow("SELECT retired_at IS NOT NULL FROM vehicles WHERE id = ? FOR UPDATE", vehicleID).Scan(&retired)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		return 0, ErrVehicleNotFound
+	}
 	if err != nil {
-		log.Printf("Error starting transaction: %v", err)
-		return err
+		tx.Rollback()
+		return 0, err
+	}
+	if retired {
+		tx.Rollback()
+		return 0, ErrVehicleRetired
+	}
+
+	if bookingLimit > 0 {
+		var active int
+		activeQuery := "SELECT COUNT(*) FROM bookings WHERE user_id = ? AND status IN ('confirmed', 'modified') AND end_time > ?"
+		if err := tx.QueryRow(activeQuery, booking.UserID, time.Now()).Scan(&active); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		if active >= bookingLimit {
+			tx.Rollback()
+			return 0, ErrBookingLimitReached
+		}
 	}
 
 	// Check for overlapping bookings
@@ -40,7 +72,7 @@ func CreateBooking(vehicleID int, booking models.Booking) error {
         SELECT id, start_time, end_time 
         FROM bookings 
         WHERE vehicle_id = ? 
-          AND status = 'confirmed' 
+          AND status IN ('confirmed', 'modified')
           AND (
             (start_time < ? AND end_time > ?) OR
             (start_time < ? AND end_time > ?) OR
@@ -55,40 +87,81 @@ func CreateBooking(vehicleID int, booking models.Booking) error {
 	if err != nil && err != sql.ErrNoRows {
 		tx.Rollback()
 		log.Printf("Error checking overlapping bookings: %v", err)
-		return fmt.Errorf("failed to check overlapping bookings: %v", err)
+		return 0, fmt.Errorf("failed to check overlapping bookings: %v", err)
 	}
 
 	if err == nil { // Conflict found
 		tx.Rollback()
 		log.Printf("Booking conflict: overlapping time range for vehicle ID=%d", vehicleID)
-		return fmt.Errorf("time range overlaps with an existing booking from %v to %v", conflictStartTime, conflictEndTime)
+		return 0, fmt.Errorf("time range overlaps with an existing booking from %v to %v", conflictStartTime, conflictEndTime)
+	}
+
+	if err := resolveBookingStations(tx, vehicleID, 0, booking); err != nil {
+		tx.Rollback()
+		return 0, err
 	}
 
 	// Insert the booking into the database
-	insertQuery := "INSERT INTO bookings (user_id, vehicle_id, start_time, end_time, status) VALUES (?, ?, ?, ?, ?)"
-	_, err = tx.Exec(insertQuery, booking.UserID, vehicleID, booking.StartTime, booking.EndTime, "confirmed")
+	insertQuery := `
+        INSERT INTO bookings (user_id, vehicle_id, start_time, end_time, status, pickup_station_id, dropoff_station_id)
+        VALUES (?, ?, ?, ?, ?, ?, ?)
+    `
+	result, err := tx.Exec(insertQuery, booking.UserID, vehicleID, booking.StartTime, booking.EndTime, "confirmed",
+		booking.PickupStationID, booking.DropoffStationID)
 	if err != nil {
 		tx.Rollback()
 		log.Printf("Error inserting booking: %v", err)
-		return fmt.Errorf("failed to insert booking: %v", err)
+		return 0, fmt.Errorf("failed to insert booking: %v", err)
+	}
+
+	bookingID, err := result.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return 0, err
 	}
 
 	// Commit the transaction
 	if err := tx.Commit(); err != nil {
 		log.Printf("Error committing transaction: %v", err)
-		return fmt.Errorf("failed to commit transaction: %v", err)
+		return 0, fmt.Errorf("failed to commit transaction: %v", err)
 	}
 
 	log.Printf("Booking created successfully for vehicle ID=%d and user ID=%d", vehicleID, booking.UserID)
-	return nil
+	return int(bookingID), nil
 }
 
+// ErrVehicleStatusNotFound is returned for vehicles that have no status yet
+var ErrVehicleStatusNotFound = errors.New("vehicle status not found")
+
+// FetchVehicleStatus returns the latest status of a vehicle, including its latest telemetry
 func FetchVehicleStatus(vehicleID int) (models.VehicleStatus, error) {
 	var status models.VehicleStatus
-	query := "SELECT vehicle_id, location, charge_level, cleanliness, updated_at FROM vehicle_status WHERE vehicle_id = ?"
-	err := DB.QueryRow(query, vehicleID).Scan(&status.VehicleID, &status.Location, &status.ChargeLevel, &status.Cleanliness, &status.UpdatedAt)
+	var latitude, longitude, odometerKm sql.NullFloat64
+	var reportedAt sql.NullTime
+	query := `
+        SELECT vehicle_id, COALESCE(location, ''), COALESCE(charge_level, 0), cleanliness, updated_at,
+               latitude, longitude, odometer_km, reported_at, station_id
+        FROM vehicle_status
+        WHERE vehicle_id = ?
+    `
+	var stationID sql.NullInt64
+	err := DB.QueryRow(query, vehicleID).Scan(&status.VehicleID, &status.Location, &status.ChargeLevel, &status.Cleanliness,
+		&status.UpdatedAt, &latitude, &longitude, &odometerKm, &reportedAt, &stationID)
 	if err == sql.ErrNoRows {
-		return status, errors.New("vehicle status not found")
+		return status, ErrVehicleStatusNotFound
+	}
+	if latitude.Valid && longitude.Valid {
+		status.Latitude, status.Longitude = &latitude.Float64, &longitude.Float64
+	}
+	if odometerKm.Valid {
+		status.OdometerKm = &odometerKm.Float64
+	}
+	if reportedAt.Valid {
+		status.ReportedAt = &reportedAt.Time
+	}
+	if stationID.Valid {
+		id := int(stationID.Int64)
+		status.StationID = &id
 	}
 	return status, err
 }
@@ -102,7 +175,7 @@ func CheckAndUpdateAvailability() error {
 	query := `
 		SELECT id, vehicle_id, end_time
 		FROM bookings
-		WHERE end_time < ? AND status = 'confirmed'
+		WHERE end_time < ? AND status IN ('confirmed', 'modified')
 	`
 	rows, err := DB.Query(query, now)
 	if err != nil {
@@ -159,8 +232,8 @@ func CheckAndUpdateAvailability() error {
 			return err
 		}
 
-		// Mark the vehicle as 'available'
-		updateVehicleQuery := "UPDATE vehicles SET is_available = TRUE WHERE id = ?"
+		// Mark the vehicle as 'available' unless it has been retired
+		updateVehicleQuery := "UPDATE vehicles SET is_available = TRUE WHERE id = ? AND retired_at IS NULL"
 		_, err = tx.Exec(updateVehicleQuery, update.VehicleID)
 		if err != nil {
 			log.Printf("Error updating vehicle availability for vehicle ID %d: %v", update.VehicleID, err)
@@ -180,7 +253,11 @@ func CheckAndUpdateAvailability() error {
 }
 
 func FetchBookingsForVehicle(vehicleID int) ([]models.Booking, error) {
-	query := "SELECT id, user_id, vehicle_id, start_time, end_time, status FROM bookings WHERE vehicle_id = ? AND status = 'confirmed'"
+	query := `
+        SELECT id, user_id, vehicle_id, start_time, end_time, status, pickup_station_id, dropoff_station_id
+        FROM bookings
+        WHERE vehicle_id = ? AND status = 'confirmed'
+    `
 	rows, err := DB.Query(query, vehicleID)
 	if err != nil {
 		return nil, err
@@ -190,10 +267,20 @@ func FetchBookingsForVehicle(vehicleID int) ([]models.Booking, error) {
 	var bookings []models.Booking
 	for rows.Next() {
 		var booking models.Booking
-		err := rows.Scan(&booking.ID, &booking.UserID, &booking.VehicleID, &booking.StartTime, &booking.EndTime, &booking.Status)
+		var pickup, dropoff sql.NullInt64
+		err := rows.Scan(&booking.ID, &booking.UserID, &booking.VehicleID, &booking.StartTime, &booking.EndTime, &booking.Status,
+			&pickup, &dropoff)
 		if err != nil {
 			return nil, err
 		}
+		if pickup.Valid {
+			id := int(pickup.Int64)
+			booking.PickupStationID = &id
+		}
+		if dropoff.Valid {
+			id := int(dropoff.Int64)
+			booking.DropoffStationID = &id
+		}
 		bookings = append(bookings, booking)
 	}
 	return bookings, nil
@@ -209,12 +296,20 @@ func FetchBookingsByUser(userID int) ([]map[string]interface{}, error) {
             b.status, 
             v.make, 
             v.model, 
-            v.registration_number 
+            v.registration_number,
+            b.returned_at,
+            COALESCE(ps.name, ''),
+            COALESCE(ds.name, '')
         FROM bookings b 
         JOIN vehicles v ON b.vehicle_id = v.id 
-        WHERE b.user_id = ? AND b.status IN ('confirmed', 'modified');
+        LEFT JOIN stations ps ON ps.id = b.pickup_station_id
+        LEFT JOIN stations ds ON ds.id = b.dropoff_station_id
+        WHERE b.user_id = ?
+          AND (b.status IN ('confirmed', 'modified') OR
+               (b.status = 'completed' AND b.returned_at IS NULL AND b.end_time > ?));
     `
-	rows, err := DB.Query(query, userID)
+	// Completed bookings stay listed while their vehicle is overdue so it can still be returned
+	rows, err := DB.Query(query, userID, time.Now().Add(-OverdueReturnWindow))
 	if err != nil {
 		log.Printf("Error executing query for user %d: %v", userID, err)
 		return nil, err
@@ -225,13 +320,21 @@ func FetchBookingsByUser(userID int) ([]map[string]interface{}, error) {
 	for rows.Next() {
 		var bookingID, userID int
 		var startTime, endTime, status, make, model, registrationNumber string
+		var returnedAt sql.NullTime
+		var pickupStation, dropoffStation string
 
-		err := rows.Scan(&bookingID, &userID, &startTime, &endTime, &status, &make, &model, &registrationNumber)
+		err := rows.Scan(&bookingID, &userID, &startTime, &endTime, &status, &make, &model, &registrationNumber, &returnedAt,
+			&pickupStation, &dropoffStation)
 		if err != nil {
 			log.Printf("Error scanning row: %v", err)
 			return nil, err
 		}
 
+		var returned interface{}
+		if returnedAt.Valid {
+			returned = returnedAt.Time
+		}
+
 		bookings = append(bookings, map[string]interface{}{
 			"booking_id":          bookingID,
 			"user_id":             userID,
@@ -241,6 +344,9 @@ func FetchBookingsByUser(userID int) ([]map[string]interface{}, error) {
 			"make":                make,
 			"model":               model,
 			"registration_number": registrationNumber,
+			"returned_at":         returned,
+			"pickup_station":      pickupStation,
+			"dropoff_station":     dropoffStation,
 		})
 	}
 
@@ -251,12 +357,53 @@ func FetchBookingsByUser(userID int) ([]map[string]interface{}, error) {
 	return bookings, nil
 }
 
+// ModifyBooking moves a booking to a new time unless its user is suspended. Its pick-up and
+// drop-off stations stay the same and are checked again for the new time; see
+// resolveBookingStations.
 func ModifyBooking(bookingID int, newStartTime, newEndTime time.Time) error {
 	tx, err := DB.Begin()
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %v", err)
 	}
 
+	// Lock the user as CreateBooking does, so a suspended user cannot move or extend bookings
+	var suspended bool
+	userQuery := "SELECT u.suspended_at IS NOT NULL FROM users u JOIN bookings b ON b.user_id = u.id WHERE b.id = ? FOR UPDATE"
+	err = tx.QueryRow(userQuery, bookingID).Scan(&suspended)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		return ErrBookingNotFound
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if suspended {
+		tx.Rollback()
+		return ErrAccountSuspended
+	}
+
+	booking := models.Booking{ID: bookingID, StartTime: newStartTime, EndTime: newEndTime}
+	var pickup, dropoff sql.NullInt64
+	lockQuery := "SELECT vehicle_id, pickup_station_id, dropoff_station_id FROM bookings WHERE id = ? FOR UPDATE"
+	err = tx.QueryRow(lockQuery, bookingID).Scan(&booking.VehicleID, &pickup, &dropoff)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		return ErrBookingNotFound
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if pickup.Valid {
+		id := int(pickup.Int64)
+		booking.PickupStationID = &id
+	}
+	if dropoff.Valid {
+		id := int(dropoff.Int64)
+		booking.DropoffStationID = &id
+	}
+
 	// Check for overlapping bookings
 	checkQuery := `
         SELECT COUNT(*) 
@@ -282,13 +429,18 @@ func ModifyBooking(bookingID int, newStartTime, newEndTime time.Time) error {
 		return fmt.Errorf("overlapping booking exists")
 	}
 
+	if err := resolveBookingStations(tx, booking.VehicleID, bookingID, &booking); err != nil {
+		tx.Rollback()
+		return err
+	}
+
 	// Update the booking
 	updateQuery := `
         UPDATE bookings
-        SET start_time = ?, end_time = ?, status = 'modified'
+        SET start_time = ?, end_time = ?, status = 'modified', pickup_station_id = ?, dropoff_station_id = ?
         WHERE id = ?
     `
-	_, err = tx.Exec(updateQuery, newStartTime, newEndTime, bookingID)
+	_, err = tx.Exec(updateQuery, newStartTime, newEndTime, booking.PickupStationID, booking.DropoffStationID, bookingID)
 	if err != nil {
 		tx.Rollback()
 		return fmt.Errorf("failed to update booking: %v", err)
@@ -301,6 +453,29 @@ func ModifyBooking(bookingID int, newStartTime, newEndTime time.Time) error {
 	return nil
 }
 
+// ErrBookingNotFound is returned when a booking ID does not exist
+var ErrBookingNotFound = errors.New("booking not found")
+
+// FetchBookingOwner returns the ID of the user who made the booking
+func FetchBookingOwner(bookingID int) (int, error) {
+	var userID int
+	err := DB.QueryRow("SELECT user_id FROM bookings WHERE id = ?", bookingID).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, ErrBookingNotFound
+	}
+	return userID, err
+}
+
+// FetchBookingVehicle returns the ID of the vehicle the booking is for
+func FetchBookingVehicle(bookingID int) (int, error) {
+	var vehicleID int
+	err := DB.QueryRow("SELECT vehicle_id FROM bookings WHERE id = ?", bookingID).Scan(&vehicleID)
+	if err == sql.ErrNoRows {
+		return 0, ErrBookingNotFound
+	}
+	return vehicleID, err
+}
+
 func CancelBooking(bookingID int) error {
 	tx, err := DB.Begin()
 	if err != nil {
@@ -378,3 +553,96 @@ func FetchRentalHistoryByUser(userID int) ([]map[string]interface{}, error) {
 
 	return bookings, nil
 }
+
+// ErrVehicleNotFound is returned when a vehicle ID does not exist
+var ErrVehicleNotFound = errors.New("vehicle not found")
+
+// SetVehicleAvailability marks a vehicle as available or unavailable for booking. Retired
+// vehicles cannot be made available again.
+func SetVehicleAvailability(vehicleID int, available bool) error {
+	var retired bool
+	err := DB.QueryRow("SELECT retired_at IS NOT NULL FROM vehicles WHERE id = ?", vehicleID).Scan(&retired)
+	if err == sql.ErrNoRows {
+		return ErrVehicleNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if retired && available {
+		return ErrVehicleRetired
+	}
+
+	// Putting a vehicle back into service releases it again; MySQL assigns left to right,
+	// so released_at is decided on the old is_available
+	query := "UPDATE vehicles SET released_at = IF(? AND NOT is_available, NOW(), released_at), is_available = ? WHERE id = ?"
+	_, err = DB.Exec(query, available, available, vehicleID)
+	return err
+}
+
+// SetVehicleHighDemand marks whether a vehicle is in high demand, which lets priority members book it further ahead
+func SetVehicleHighDemand(vehicleID int, highDemand bool) error {
+	result, err := DB.Exec("UPDATE vehicles SET high_demand = ? WHERE id = ?", highDemand, vehicleID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err == nil && rowsAffected == 0 {
+		var exists bool
+		if err := DB.QueryRow("SELECT EXISTS (SELECT 1 FROM vehicles WHERE id = ?)", vehicleID).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return ErrVehicleNotFound
+		}
+	}
+	return err
+}
+
+// FetchVehicleDemand returns when the vehicle was released and whether it is in high demand
+func FetchVehicleDemand(vehicleID int) (*time.Time, bool, error) {
+	var releasedAt sql.NullTime
+	var highDemand bool
+	err := DB.QueryRow("SELECT released_at, high_demand FROM vehicles WHERE id = ?", vehicleID).Scan(&releasedAt, &highDemand)
+	if err == sql.ErrNoRows {
+		return nil, false, ErrVehicleNotFound
+	}
+	if err != nil || !releasedAt.Valid {
+		return nil, highDemand, err
+	}
+	return &releasedAt.Time, highDemand, nil
+}
+
+// FetchMembershipBenefits returns the booking rules of the user's current membership tier
+func FetchMembershipBenefits(userID int) (models.MembershipBenefits, error) {
+	var benefits models.MembershipBenefits
+	query := `
+        SELECT mt.name, mt.booking_limit, mt.priority_access
+        FROM users u
+        JOIN membership_tiers mt ON mt.id = u.membership_tier_id
+        WHERE u.id = ?
+    `
+	err := DB.QueryRow(query, userID).Scan(&benefits.Tier, &benefits.BookingLimit, &benefits.PriorityAccess)
+	return benefits, err
+}
+
+// IsUserVerified reports whether the user has verified their email or phone
+func IsUserVerified(userID int) (bool, error) {
+	var verified bool
+	err := DB.QueryRow("SELECT is_verified FROM users WHERE id = ?", userID).Scan(&verified)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return verified, err
+}
+
+// HasApprovedLicence reports whether the user has an approved driver licence that is
+// still valid on the given date
+func HasApprovedLicence(userID int, until time.Time) (bool, error) {
+	var count int
+	err := DB.QueryRow(`
+		SELECT COUNT(*) FROM driver_licences
+		WHERE user_id = ? AND status = 'approved' AND expiry_date >= DATE(?)
+	`, userID, until).Scan(&count)
+	return count > 0, err
+}
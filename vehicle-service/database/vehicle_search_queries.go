@@ -0,0 +1,142 @@
+package database
+
+import (
+	"cnad_assignment/vehicle-service/models"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// VehicleSortColumns maps the sort keys accepted by the vehicle search to the expressions
+// they order by. NULLs are replaced so that cursors can compare values.
+var VehicleSortColumns = map[string]string{
+	"id":           "v.id",
+	"make":         "COALESCE(v.make, '')",
+	"model":        "COALESCE(v.model, '')",
+	"charge_level": "COALESCE(vs.charge_level, -1)",
+	"created_at":   "v.created_at",
+}
+
+// VehicleSearch filters and orders the vehicle search. Zero values leave a filter unset.
+type VehicleSearch struct {
+	StartTime   time.Time // With EndTime, only vehicles without an active booking overlapping the window
+	EndTime     time.Time
+	Make        string
+	Model       string
+	Location    string // Matched anywhere in the reported location
+	MinCharge   int
+	Cleanliness string
+	Sort        string // A key of VehicleSortColumns
+	Descending  bool
+	Limit       int
+
+	// AfterValue and AfterID continue the search after the last vehicle of the previous
+	// page: its sort value and ID. AfterID 0 starts at the beginning.
+	AfterValue interface{}
+	AfterID    int
+}
+
+// freeDuringCondition keeps vehicles v without an active booking overlapping a window. Its
+// arguments are the end and then the start of the window. Modified bookings are still
+// confirmed, just at a new time.
+const freeDuringCondition = `NOT EXISTS (
+            SELECT 1 FROM bookings b
+            WHERE b.vehicle_id = v.id AND b.status IN ('confirmed', 'modified')
+              AND b.start_time < ? AND b.end_time > ?)`
+
+// likePattern matches value anywhere in a column, treating LIKE wildcards in it literally
+func likePattern(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return "%" + replacer.Replace(value) + "%"
+}
+
+// SearchVehicles returns one page of the available vehicles matching the search, each
+// with the sort value to continue after it, along with the total number of matches
+func SearchVehicles(search VehicleSearch) ([]models.VehicleListing, []interface{}, int, error) {
+	conditions := []string{"v.is_available = TRUE"}
+	var args []interface{}
+	if !search.StartTime.IsZero() && !search.EndTime.IsZero() {
+		conditions = append(conditions, freeDuringCondition)
+		args = append(args, search.EndTime, search.StartTime)
+	}
+	if search.Make != "" {
+		conditions = append(conditions, "v.make = ?")
+		args = append(args, search.Make)
+	}
+	if search.Model != "" {
+		conditions = append(conditions, "v.model = ?")
+		args = append(args, search.Model)
+	}
+	if search.Location != "" {
+		conditions = append(conditions, "vs.location LIKE ?")
+		args = append(args, likePattern(search.Location))
+	}
+	if search.MinCharge > 0 {
+		conditions = append(conditions, "vs.charge_level >= ?")
+		args = append(args, search.MinCharge)
+	}
+	if search.Cleanliness != "" {
+		conditions = append(conditions, "vs.cleanliness = ?")
+		args = append(args, search.Cleanliness)
+	}
+	from := " FROM vehicles v LEFT JOIN vehicle_status vs ON vs.vehicle_id = v.id WHERE " + strings.Join(conditions, " AND ")
+
+	var total int
+	if err := DB.QueryRow("SELECT COUNT(*)"+from, args...).Scan(&total); err != nil {
+		return nil, nil, 0, err
+	}
+
+	column, ok := VehicleSortColumns[search.Sort]
+	if !ok {
+		column = VehicleSortColumns["id"]
+	}
+	direction, comparison := "ASC", ">"
+	if search.Descending {
+		direction, comparison = "DESC", "<"
+	}
+	// The ID breaks ties so that pages neither overlap nor skip vehicles
+	pageFrom := from
+	pageArgs := args
+	if search.AfterID > 0 {
+		pageFrom += " AND (" + column + " " + comparison + " ? OR (" + column + " = ? AND v.id " + comparison + " ?))"
+		pageArgs = append(append([]interface{}{}, args...), search.AfterValue, search.AfterValue, search.AfterID)
+	}
+
+	query := `
+        SELECT v.id, v.make, v.model, v.registration_number, v.is_available, v.high_demand, v.released_at, v.created_at,
+               COALESCE(vs.location, ''), vs.charge_level, COALESCE(vs.cleanliness, ''), ` + column +
+		pageFrom + " ORDER BY " + column + " " + direction + ", v.id " + direction + " LIMIT ?"
+	rows, err := DB.Query(query, append(pageArgs, search.Limit)...)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	defer rows.Close()
+
+	vehicles := []models.VehicleListing{}
+	var sortValues []interface{}
+	for rows.Next() {
+		var v models.VehicleListing
+		var releasedAt sql.NullTime
+		var chargeLevel sql.NullInt64
+		var sortValue interface{}
+		err := rows.Scan(&v.ID, &v.Make, &v.Model, &v.RegistrationNumber, &v.IsAvailable, &v.HighDemand, &releasedAt, &v.CreatedAt,
+			&v.Location, &chargeLevel, &v.Cleanliness, &sortValue)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		if releasedAt.Valid {
+			v.ReleasedAt = &releasedAt.Time
+		}
+		if chargeLevel.Valid {
+			level := int(chargeLevel.Int64)
+			v.ChargeLevel = &level
+		}
+		// The driver returns text as bytes, which would not survive the round trip through a cursor
+		if raw, ok := sortValue.([]byte); ok {
+			sortValue = string(raw)
+		}
+		vehicles = append(vehicles, v)
+		sortValues = append(sortValues, sortValue)
+	}
+	return vehicles, sortValues, total, rows.Err()
+}
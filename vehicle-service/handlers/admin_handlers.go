@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"cnad_assignment/shared/auth"
+	"cnad_assignment/vehicle-service/database"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// AdminSetVehicleAvailability takes a vehicle out of service or puts it back, e.g. for maintenance
+func AdminSetVehicleAvailability(w http.ResponseWriter, r *http.Request) {
+	vehicleID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || vehicleID <= 0 {
+		http.Error(w, "Invalid vehicle ID", http.StatusBadRequest)
+		return
+	}
+
+	var request struct {
+		IsAvailable *bool `json:"is_available"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.IsAvailable == nil {
+		http.Error(w, "is_available must be true or false", http.StatusBadRequest)
+		return
+	}
+
+	err = database.SetVehicleAvailability(vehicleID, *request.IsAvailable)
+	if err == database.ErrVehicleNotFound {
+		http.Error(w, "Vehicle not found", http.StatusNotFound)
+		return
+	}
+	if err == database.ErrVehicleRetired {
+		http.Error(w, "Retired vehicles cannot be made available again", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating availability of vehicle %d: %v", vehicleID, err)
+		http.Error(w, "Failed to update vehicle", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %d set is_available=%t for vehicle %d", auth.UserID(r), *request.IsAvailable, vehicleID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"id": vehicleID, "is_available": *request.IsAvailable})
+}
+
+// AdminSetVehicleHighDemand flags a vehicle as high demand so priority members can book it further ahead
+func AdminSetVehicleHighDemand(w http.ResponseWriter, r *http.Request) {
+	vehicleID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || vehicleID <= 0 {
+		http.Error(w, "Invalid vehicle ID", http.StatusBadRequest)
+		return
+	}
+
+	var request struct {
+		HighDemand *bool `json:"high_demand"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.HighDemand == nil {
+		http.Error(w, "high_demand must be true or false", http.StatusBadRequest)
+		return
+	}
+
+	err = database.SetVehicleHighDemand(vehicleID, *request.HighDemand)
+	if err == database.ErrVehicleNotFound {
+		http.Error(w, "Vehicle not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating demand of vehicle %d: %v", vehicleID, err)
+		http.Error(w, "Failed to update vehicle", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %d set high_demand=%t for vehicle %d", auth.UserID(r), *request.HighDemand, vehicleID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"id": vehicleID, "high_demand": *request.HighDemand})
+}
+
+// AdminCancelBooking cancels any user's booking on their behalf
+func AdminCancelBooking(w http.ResponseWriter, r *http.Request) {
+	bookingID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || bookingID <= 0 {
+		http.Error(w, "Invalid booking ID", http.StatusBadRequest)
+		return
+	}
+
+	ownerID, err := database.FetchBookingOwner(bookingID)
+	if err == database.ErrBookingNotFound {
+		http.Error(w, "Booking not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching owner of booking %d: %v", bookingID, err)
+		http.Error(w, "Failed to fetch booking", http.StatusInternalServerError)
+		return
+	}
+
+	if err := database.CancelBooking(bookingID); err != nil {
+		log.Printf("Error canceling booking: %v", err)
+		http.Error(w, "Failed to cancel booking", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %d canceled booking %d of user %d", auth.UserID(r), bookingID, ownerID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Booking canceled successfully"})
+}
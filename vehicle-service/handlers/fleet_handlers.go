@@ -0,0 +1,327 @@
+package handlers
+
+import (
+	"cnad_assignment/shared/auth"
+	"cnad_assignment/vehicle-service/database"
+	"cnad_assignment/vehicle-service/models"
+	"cnad_assignment/vehicle-service/utils"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// maxVehicleNameLength matches the make and model columns
+const maxVehicleNameLength = 50
+
+// vehicleDetails validates the make, model and registration number of a vehicle and
+// returns them cleaned up. On failure it writes a 400 response and returns false.
+func vehicleDetails(w http.ResponseWriter, make, model, registration string) (string, string, string, bool) {
+	make, model = strings.TrimSpace(make), strings.TrimSpace(model)
+	if make == "" || model == "" || len(make) > maxVehicleNameLength || len(model) > maxVehicleNameLength {
+		http.Error(w, fmt.Sprintf("make and model are required and must be at most %d characters", maxVehicleNameLength), http.StatusBadRequest)
+		return "", "", "", false
+	}
+	registration = utils.NormalizeRegistration(registration)
+	if err := utils.ValidateRegistration(registration); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return "", "", "", false
+	}
+	return make, model, registration, true
+}
+
+// homeStationExists checks that the home station chosen for a vehicle exists. On failure it
+// writes an error response and returns false.
+func homeStationExists(w http.ResponseWriter, stationID int) bool {
+	_, err := database.FetchStation(stationID)
+	if err == database.ErrStationNotFound {
+		http.Error(w, "Home station not found", http.StatusBadRequest)
+		return false
+	}
+	if err != nil {
+		log.Printf("Error fetching station %d: %v", stationID, err)
+		http.Error(w, "Failed to save vehicle", http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// writeVehicle responds with the vehicle as it is now stored
+func writeVehicle(w http.ResponseWriter, status, vehicleID int) {
+	vehicle, err := database.FetchVehicle(vehicleID)
+	if err != nil {
+		log.Printf("Error fetching vehicle %d: %v", vehicleID, err)
+		http.Error(w, "Failed to fetch vehicle", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(vehicle)
+}
+
+// AdminListFleet lists the fleet. status selects active (the default), retired or all vehicles.
+func AdminListFleet(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = database.FleetActive
+	}
+	if status != database.FleetActive && status != database.FleetRetired && status != database.FleetAll {
+		http.Error(w, "status must be active, retired or all", http.StatusBadRequest)
+		return
+	}
+
+	vehicles, err := database.FetchFleet(status)
+	if err != nil {
+		log.Printf("Error fetching %s vehicles: %v", status, err)
+		http.Error(w, "Failed to fetch vehicles", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(vehicles)
+}
+
+// AdminGetVehicle returns a vehicle of the fleet, including retired ones
+func AdminGetVehicle(w http.ResponseWriter, r *http.Request) {
+	vehicleID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || vehicleID <= 0 {
+		http.Error(w, "Invalid vehicle ID", http.StatusBadRequest)
+		return
+	}
+
+	vehicle, err := database.FetchVehicle(vehicleID)
+	if err == database.ErrVehicleNotFound {
+		http.Error(w, "Vehicle not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching vehicle %d: %v", vehicleID, err)
+		http.Error(w, "Failed to fetch vehicle", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(vehicle)
+}
+
+// AdminCreateVehicle adds a vehicle to the fleet. It is available for booking straight
+// away unless is_available is false, and starts out parked at its home_station_id if given.
+func AdminCreateVehicle(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Make               string `json:"make"`
+		Model              string `json:"model"`
+		RegistrationNumber string `json:"registration_number"`
+		IsAvailable        *bool  `json:"is_available"`
+		HighDemand         bool   `json:"high_demand"`
+		HomeStationID      *int   `json:"home_station_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	make, model, registration, ok := vehicleDetails(w, request.Make, request.Model, request.RegistrationNumber)
+	if !ok {
+		return
+	}
+	if request.HomeStationID != nil && !homeStationExists(w, *request.HomeStationID) {
+		return
+	}
+	vehicle := models.Vehicle{
+		Make:               make,
+		Model:              model,
+		RegistrationNumber: registration,
+		IsAvailable:        request.IsAvailable == nil || *request.IsAvailable,
+		HighDemand:         request.HighDemand,
+		HomeStationID:      request.HomeStationID,
+	}
+
+	vehicleID, err := database.CreateVehicle(vehicle)
+	if database.IsDuplicateEntry(err) {
+		http.Error(w, "A vehicle with this registration number already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error creating vehicle %s: %v", registration, err)
+		http.Error(w, "Failed to create vehicle", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %d added vehicle %d (%s)", auth.UserID(r), vehicleID, registration)
+	writeVehicle(w, http.StatusCreated, vehicleID)
+}
+
+// AdminUpdateVehicle changes the make, model, registration number or home station of a
+// vehicle. Fields left out keep their current value; a home_station_id of 0 removes the
+// home station. Where the vehicle is parked right now is changed with AdminParkVehicle.
+func AdminUpdateVehicle(w http.ResponseWriter, r *http.Request) {
+	vehicleID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || vehicleID <= 0 {
+		http.Error(w, "Invalid vehicle ID", http.StatusBadRequest)
+		return
+	}
+
+	var request struct {
+		Make               *string `json:"make"`
+		Model              *string `json:"model"`
+		RegistrationNumber *string `json:"registration_number"`
+		HomeStationID      *int    `json:"home_station_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	vehicle, err := database.FetchVehicle(vehicleID)
+	if err == database.ErrVehicleNotFound {
+		http.Error(w, "Vehicle not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching vehicle %d: %v", vehicleID, err)
+		http.Error(w, "Failed to update vehicle", http.StatusInternalServerError)
+		return
+	}
+	if request.Make != nil {
+		vehicle.Make = *request.Make
+	}
+	if request.Model != nil {
+		vehicle.Model = *request.Model
+	}
+	if request.RegistrationNumber != nil {
+		vehicle.RegistrationNumber = *request.RegistrationNumber
+	}
+	if request.HomeStationID != nil {
+		vehicle.HomeStationID = request.HomeStationID
+		if *request.HomeStationID == 0 {
+			vehicle.HomeStationID = nil
+		} else if !homeStationExists(w, *request.HomeStationID) {
+			return
+		}
+	}
+
+	make, model, registration, ok := vehicleDetails(w, vehicle.Make, vehicle.Model, vehicle.RegistrationNumber)
+	if !ok {
+		return
+	}
+
+	err = database.UpdateVehicle(vehicleID, make, model, registration, vehicle.HomeStationID)
+	if database.IsDuplicateEntry(err) {
+		http.Error(w, "A vehicle with this registration number already exists", http.StatusConflict)
+		return
+	}
+	if err == database.ErrVehicleNotFound {
+		http.Error(w, "Vehicle not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating vehicle %d: %v", vehicleID, err)
+		http.Error(w, "Failed to update vehicle", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %d updated vehicle %d", auth.UserID(r), vehicleID)
+	writeVehicle(w, http.StatusOK, vehicleID)
+}
+
+// AdminRetireVehicle takes a vehicle out of the fleet for good. It takes no new bookings,
+// while bookings it already has go ahead; the response says how many are still to come.
+func AdminRetireVehicle(w http.ResponseWriter, r *http.Request) {
+	vehicleID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || vehicleID <= 0 {
+		http.Error(w, "Invalid vehicle ID", http.StatusBadRequest)
+		return
+	}
+
+	var request struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	reason := strings.TrimSpace(request.Reason)
+	if reason == "" || len(reason) > 255 {
+		http.Error(w, "A reason of at most 255 characters is required", http.StatusBadRequest)
+		return
+	}
+
+	upcoming, err := database.RetireVehicle(vehicleID, reason)
+	if err == database.ErrVehicleNotFound {
+		http.Error(w, "Vehicle not found", http.StatusNotFound)
+		return
+	}
+	if err == database.ErrVehicleRetired {
+		http.Error(w, "Vehicle is already retired", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error retiring vehicle %d: %v", vehicleID, err)
+		http.Error(w, "Failed to retire vehicle", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %d retired vehicle %d with %d bookings still to come: %s", auth.UserID(r), vehicleID, upcoming, reason)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":           "Vehicle retired. It takes no new bookings; existing bookings go ahead.",
+		"id":                vehicleID,
+		"upcoming_bookings": upcoming,
+	})
+}
+
+// AdminDeleteVehicle removes a vehicle that has never been rented. Vehicles with rental
+// history must be retired instead. Future bookings are moved to the vehicle given by the
+// reassign_to query parameter; without it the deletion fails while any are left.
+func AdminDeleteVehicle(w http.ResponseWriter, r *http.Request) {
+	vehicleID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || vehicleID <= 0 {
+		http.Error(w, "Invalid vehicle ID", http.StatusBadRequest)
+		return
+	}
+	reassignTo := 0
+	if value := r.URL.Query().Get("reassign_to"); value != "" {
+		reassignTo, err = strconv.Atoi(value)
+		if err != nil || reassignTo <= 0 {
+			http.Error(w, "Invalid reassign_to vehicle ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	moved, err := database.DeleteVehicle(vehicleID, reassignTo)
+	switch err {
+	case nil:
+	case database.ErrVehicleNotFound:
+		http.Error(w, "Vehicle not found", http.StatusNotFound)
+		return
+	case database.ErrVehicleHasHistory:
+		http.Error(w, "Vehicle has rental history; retire it instead", http.StatusConflict)
+		return
+	case database.ErrVehicleHasFutureBookings:
+		http.Error(w, "Vehicle has future bookings; pass reassign_to with a vehicle to move them to", http.StatusConflict)
+		return
+	case database.ErrInvalidReassignment:
+		http.Error(w, "reassign_to must be another vehicle that is not retired", http.StatusBadRequest)
+		return
+	case database.ErrReassignmentConflict:
+		http.Error(w, "The vehicle to reassign to is already booked during some of the bookings to move", http.StatusConflict)
+		return
+	default:
+		log.Printf("Error deleting vehicle %d: %v", vehicleID, err)
+		http.Error(w, "Failed to delete vehicle", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %d deleted vehicle %d, moving %d bookings to vehicle %d", auth.UserID(r), vehicleID, moved, reassignTo)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":             "Vehicle deleted",
+		"id":                  vehicleID,
+		"reassigned_bookings": moved,
+	})
+}
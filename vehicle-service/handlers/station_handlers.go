@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"cnad_assignment/shared/auth"
+	"cnad_assignment/vehicle-service/database"
+	"cnad_assignment/vehicle-service/models"
+	"cnad_assignment/vehicle-service/utils"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Lengths of the stations columns
+const (
+	maxStationNameLength    = 100
+	maxStationAddressLength = 255
+)
+
+// defaultStationCapacity matches the default of the capacity column
+const defaultStationCapacity = 10
+
+// stationDetails validates a station and cleans up its name, address and opening hours. On
+// failure it writes a 400 response and returns false.
+func stationDetails(w http.ResponseWriter, station *models.Station) bool {
+	station.Name, station.Address = strings.TrimSpace(station.Name), strings.TrimSpace(station.Address)
+	if station.Name == "" || len(station.Name) > maxStationNameLength {
+		http.Error(w, fmt.Sprintf("name is required and must be at most %d characters", maxStationNameLength), http.StatusBadRequest)
+		return false
+	}
+	if len(station.Address) > maxStationAddressLength {
+		http.Error(w, fmt.Sprintf("address must be at most %d characters", maxStationAddressLength), http.StatusBadRequest)
+		return false
+	}
+	if err := utils.ValidateCoordinates(station.Latitude, station.Longitude); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	if err := utils.ValidateStationCapacity(station.Capacity); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	station.OpensAt, station.ClosesAt = strings.TrimSpace(station.OpensAt), strings.TrimSpace(station.ClosesAt)
+	if err := utils.ValidateStationHours(station.OpensAt, station.ClosesAt); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// writeStation responds with the station as it is now stored
+func writeStation(w http.ResponseWriter, status, stationID int) {
+	station, err := database.FetchStation(stationID)
+	if err != nil {
+		log.Printf("Error fetching station %d: %v", stationID, err)
+		http.Error(w, "Failed to fetch station", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(station)
+}
+
+// GetStations lists the stations vehicles are parked at
+func GetStations(w http.ResponseWriter, r *http.Request) {
+	stations, err := database.FetchStations()
+	if err != nil {
+		log.Printf("Error fetching stations: %v", err)
+		http.Error(w, "Failed to fetch stations", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stations)
+}
+
+// AdminCreateStation adds a station. capacity defaults to 10 vehicles, and a station
+// without opens_at and closes_at (HH:MM, local time) never closes.
+func AdminCreateStation(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Name      string   `json:"name"`
+		Address   string   `json:"address"`
+		Latitude  *float64 `json:"latitude"`
+		Longitude *float64 `json:"longitude"`
+		Capacity  *int     `json:"capacity"`
+		OpensAt   string   `json:"opens_at"`
+		ClosesAt  string   `json:"closes_at"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	if request.Latitude == nil || request.Longitude == nil {
+		http.Error(w, "latitude and longitude are required", http.StatusBadRequest)
+		return
+	}
+
+	station := models.Station{
+		Name:      request.Name,
+		Address:   request.Address,
+		Latitude:  *request.Latitude,
+		Longitude: *request.Longitude,
+		Capacity:  defaultStationCapacity,
+		OpensAt:   request.OpensAt,
+		ClosesAt:  request.ClosesAt,
+	}
+	if request.Capacity != nil {
+		station.Capacity = *request.Capacity
+	}
+	if !stationDetails(w, &station) {
+		return
+	}
+
+	stationID, err := database.CreateStation(station)
+	if database.IsDuplicateEntry(err) {
+		http.Error(w, "A station with this name already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error creating station %s: %v", station.Name, err)
+		http.Error(w, "Failed to create station", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %d added station %d (%s)", auth.UserID(r), stationID, station.Name)
+	writeStation(w, http.StatusCreated, stationID)
+}
+
+// AdminUpdateStation changes the name, address, position, capacity or opening hours of a
+// station. Fields left out keep their current value; empty opens_at and closes_at make the
+// station open around the clock. A lower capacity does not affect bookings already made.
+func AdminUpdateStation(w http.ResponseWriter, r *http.Request) {
+	stationID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || stationID <= 0 {
+		http.Error(w, "Invalid station ID", http.StatusBadRequest)
+		return
+	}
+
+	var request struct {
+		Name      *string  `json:"name"`
+		Address   *string  `json:"address"`
+		Latitude  *float64 `json:"latitude"`
+		Longitude *float64 `json:"longitude"`
+		Capacity  *int     `json:"capacity"`
+		OpensAt   *string  `json:"opens_at"`
+		ClosesAt  *string  `json:"closes_at"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	station, err := database.FetchStation(stationID)
+	if err == database.ErrStationNotFound {
+		http.Error(w, "Station not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching station %d: %v", stationID, err)
+		http.Error(w, "Failed to update station", http.StatusInternalServerError)
+		return
+	}
+	if request.Name != nil {
+		station.Name = *request.Name
+	}
+	if request.Address != nil {
+		station.Address = *request.Address
+	}
+	if request.Latitude != nil {
+		station.Latitude = *request.Latitude
+	}
+	if request.Longitude != nil {
+		station.Longitude = *request.Longitude
+	}
+	if request.Capacity != nil {
+		station.Capacity = *request.Capacity
+	}
+	if request.OpensAt != nil {
+		station.OpensAt = *request.OpensAt
+	}
+	if request.ClosesAt != nil {
+		station.ClosesAt = *request.ClosesAt
+	}
+	if !stationDetails(w, &station) {
+		return
+	}
+
+	err = database.UpdateStation(station)
+	if database.IsDuplicateEntry(err) {
+		http.Error(w, "A station with this name already exists", http.StatusConflict)
+		return
+	}
+	if err == database.ErrStationNotFound {
+		http.Error(w, "Station not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating station %d: %v", stationID, err)
+		http.Error(w, "Failed to update station", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %d updated station %d", auth.UserID(r), stationID)
+	writeStation(w, http.StatusOK, stationID)
+}
+
+// AdminParkVehicle records the station a vehicle is parked at. A station_id of null records
+// that it is not at a station.
+func AdminParkVehicle(w http.ResponseWriter, r *http.Request) {
+	vehicleID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || vehicleID <= 0 {
+		http.Error(w, "Invalid vehicle ID", http.StatusBadRequest)
+		return
+	}
+
+	var request struct {
+		StationID *int `json:"station_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	stationID := 0
+	if request.StationID != nil {
+		if *request.StationID <= 0 {
+			http.Error(w, "Invalid station ID", http.StatusBadRequest)
+			return
+		}
+		stationID = *request.StationID
+	}
+
+	err = database.ParkVehicleAtStation(vehicleID, stationID)
+	if err == database.ErrVehicleNotFound {
+		http.Error(w, "Vehicle not found", http.StatusNotFound)
+		return
+	}
+	if err == database.ErrStationNotFound {
+		http.Error(w, "Station not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error parking vehicle %d at station %d: %v", vehicleID, stationID, err)
+		http.Error(w, "Failed to update vehicle station", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %d parked vehicle %d at station %d", auth.UserID(r), vehicleID, stationID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":    "Vehicle station updated",
+		"vehicle_id": vehicleID,
+		"station_id": request.StationID,
+	})
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"cnad_assignment/vehicle-service/database"
+	"cnad_assignment/vehicle-service/models"
+	"cnad_assignment/vehicle-service/utils"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// IngestTelemetry records a reading pushed by a vehicle's device: latitude, longitude,
+// charge_level and odometer_km are required, cleanliness is optional and recorded_at (RFC
+// 3339) defaults to now. Readings older than the vehicle's latest are kept in its history
+// without replacing its status.
+func IngestTelemetry(w http.ResponseWriter, r *http.Request) {
+	vehicleID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || vehicleID <= 0 {
+		http.Error(w, "Invalid vehicle ID", http.StatusBadRequest)
+		return
+	}
+
+	var request struct {
+		Latitude    *float64   `json:"latitude"`
+		Longitude   *float64   `json:"longitude"`
+		ChargeLevel *int       `json:"charge_level"`
+		OdometerKm  *float64   `json:"odometer_km"`
+		Cleanliness string     `json:"cleanliness"`
+		RecordedAt  *time.Time `json:"recorded_at"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	if request.Latitude == nil || request.Longitude == nil || request.ChargeLevel == nil || request.OdometerKm == nil {
+		http.Error(w, "latitude, longitude, charge_level and odometer_km are required", http.StatusBadRequest)
+		return
+	}
+	if err := utils.ValidateCoordinates(*request.Latitude, *request.Longitude); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := utils.ValidateChargeLevel(*request.ChargeLevel); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := utils.ValidateOdometer(*request.OdometerKm); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.Cleanliness != "" && utils.ValidateCleanliness(request.Cleanliness) != nil {
+		http.Error(w, "cleanliness must be one of clean, dirty, needs maintenance", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	recordedAt := now
+	if request.RecordedAt != nil {
+		recordedAt = request.RecordedAt.In(time.Local)
+	}
+	if err := utils.ValidateRecordedAt(recordedAt, now); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	reading := models.TelemetryReading{
+		VehicleID:   vehicleID,
+		Latitude:    *request.Latitude,
+		Longitude:   *request.Longitude,
+		ChargeLevel: *request.ChargeLevel,
+		OdometerKm:  *request.OdometerKm,
+		Cleanliness: request.Cleanliness,
+		RecordedAt:  recordedAt,
+	}
+	latest, err := database.RecordTelemetry(reading)
+	if err == database.ErrVehicleNotFound {
+		http.Error(w, "Vehicle not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error recording telemetry of vehicle %d: %v", vehicleID, err)
+		http.Error(w, "Failed to record telemetry", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Telemetry recorded",
+		"reading": reading,
+		"latest":  latest,
+	})
+}
+
+// AdminGetTelemetry returns a vehicle's telemetry history, newest first. from and to (RFC
+// 3339) bound the time recorded and default to the last day; limit caps the readings returned.
+func AdminGetTelemetry(w http.ResponseWriter, r *http.Request) {
+	vehicleID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || vehicleID <= 0 {
+		http.Error(w, "Invalid vehicle ID", http.StatusBadRequest)
+		return
+	}
+
+	params := r.URL.Query()
+	to := time.Now()
+	if value := params.Get("to"); value != "" {
+		if to, err = time.Parse(time.RFC3339, value); err != nil {
+			http.Error(w, "Invalid to time format", http.StatusBadRequest)
+			return
+		}
+	}
+	from := to.Add(-utils.TelemetryHistoryWindow)
+	if value := params.Get("from"); value != "" {
+		if from, err = time.Parse(time.RFC3339, value); err != nil {
+			http.Error(w, "Invalid from time format", http.StatusBadRequest)
+			return
+		}
+	}
+	if !to.After(from) {
+		http.Error(w, "to must be after from", http.StatusBadRequest)
+		return
+	}
+	limit := utils.DefaultTelemetryLimit
+	if value := params.Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > utils.MaxTelemetryLimit {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", utils.MaxTelemetryLimit), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if _, err := database.FetchVehicle(vehicleID); err == database.ErrVehicleNotFound {
+		http.Error(w, "Vehicle not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error fetching vehicle %d: %v", vehicleID, err)
+		http.Error(w, "Failed to fetch telemetry", http.StatusInternalServerError)
+		return
+	}
+
+	readings, err := database.FetchTelemetry(vehicleID, from.In(time.Local), to.In(time.Local), limit)
+	if err != nil {
+		log.Printf("Error fetching telemetry of vehicle %d: %v", vehicleID, err)
+		http.Error(w, "Failed to fetch telemetry", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"vehicle_id": vehicleID,
+		"from":       from,
+		"to":         to,
+		"readings":   readings,
+		"count":      len(readings),
+	})
+}
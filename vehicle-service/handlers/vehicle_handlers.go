@@ -1,12 +1,16 @@
 package handlers
 
 import (
+	"cnad_assignment/shared/auth"
+	"cnad_assignment/shared/notify"
 	"cnad_assignment/vehicle-service/database"
 	"cnad_assignment/vehicle-service/models"
+	"cnad_assignment/vehicle-service/utils"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
@@ -14,16 +18,244 @@ import (
 	"github.com/gorilla/mux"
 )
 
+// GetAvailableVehicles searches the vehicles that can be booked. Optional query parameters:
+// start_time and end_time (RFC 3339, together) keep vehicles free for that window; make and
+// model match exactly, location anywhere in the reported location; min_charge and
+// cleanliness filter on the vehicle's latest status. sort (a key of
+// database.VehicleSortColumns) and order (asc or desc) order the results, limit sets the
+// page size and cursor continues from the next_cursor of the previous page.
 func GetAvailableVehicles(w http.ResponseWriter, r *http.Request) {
-	log.Println("GetAvailableVehicles called") // Add this log for debugging
-	vehicles, err := database.FetchAvailableVehicles()
+	params := r.URL.Query()
+	search := database.VehicleSearch{
+		Make:        strings.TrimSpace(params.Get("make")),
+		Model:       strings.TrimSpace(params.Get("model")),
+		Location:    strings.TrimSpace(params.Get("location")),
+		Cleanliness: params.Get("cleanliness"),
+		Sort:        params.Get("sort"),
+		Limit:       utils.DefaultSearchLimit,
+	}
+
+	var ok bool
+	if search.StartTime, search.EndTime, ok = timeWindowParams(w, params); !ok {
+		return
+	}
+	if search.MinCharge, ok = minChargeParam(w, params); !ok {
+		return
+	}
+	if search.Cleanliness != "" && utils.ValidateCleanliness(search.Cleanliness) != nil {
+		http.Error(w, "cleanliness must be one of clean, dirty, needs maintenance", http.StatusBadRequest)
+		return
+	}
+
+	if search.Sort == "" {
+		search.Sort = "id"
+	}
+	if _, ok := database.VehicleSortColumns[search.Sort]; !ok {
+		http.Error(w, "Invalid sort key", http.StatusBadRequest)
+		return
+	}
+	switch params.Get("order") {
+	case "", "asc":
+	case "desc":
+		search.Descending = true
+	default:
+		http.Error(w, "order must be asc or desc", http.StatusBadRequest)
+		return
+	}
+	if value := params.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > utils.MaxSearchLimit {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", utils.MaxSearchLimit), http.StatusBadRequest)
+			return
+		}
+		search.Limit = limit
+	}
+
+	if value := params.Get("cursor"); value != "" {
+		cursor, err := utils.DecodeCursor(value)
+		if err != nil || cursor.Sort != search.Sort || cursor.Descending != search.Descending {
+			http.Error(w, "Invalid cursor; start again without it when changing the sort", http.StatusBadRequest)
+			return
+		}
+		afterValue, ok := cursorSortValue(search.Sort, cursor.Value)
+		if !ok {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		search.AfterValue, search.AfterID = afterValue, cursor.ID
+	}
+
+	// One extra vehicle tells whether there is another page
+	pageSize := search.Limit
+	search.Limit++
+	vehicles, sortValues, total, err := database.SearchVehicles(search)
+	if err != nil {
+		log.Printf("Error searching vehicles: %v", err)
+		http.Error(w, "Failed to fetch vehicles", http.StatusInternalServerError)
+		return
+	}
+
+	var nextCursor string
+	if len(vehicles) > pageSize {
+		vehicles = vehicles[:pageSize]
+		last := vehicles[pageSize-1]
+		nextCursor, err = utils.EncodeCursor(utils.SearchCursor{
+			Sort:       search.Sort,
+			Descending: search.Descending,
+			Value:      sortValues[pageSize-1],
+			ID:         last.ID,
+		})
+		if err != nil {
+			log.Printf("Error encoding vehicle search cursor: %v", err)
+			http.Error(w, "Failed to fetch vehicles", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	response := map[string]interface{}{
+		"vehicles":    vehicles,
+		"count":       len(vehicles),
+		"total":       total,
+		"next_cursor": nil,
+	}
+	if nextCursor != "" {
+		response["next_cursor"] = nextCursor
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// timeWindowParams parses the optional start_time and end_time query parameters (RFC 3339,
+// together). On failure it writes a 400 response and returns false.
+func timeWindowParams(w http.ResponseWriter, params url.Values) (time.Time, time.Time, bool) {
+	startValue, endValue := params.Get("start_time"), params.Get("end_time")
+	if (startValue == "") != (endValue == "") {
+		http.Error(w, "start_time and end_time must be given together", http.StatusBadRequest)
+		return time.Time{}, time.Time{}, false
+	}
+	if startValue == "" {
+		return time.Time{}, time.Time{}, true
+	}
+	startTime, err := time.Parse(time.RFC3339, startValue)
+	if err != nil {
+		http.Error(w, "Invalid start time format", http.StatusBadRequest)
+		return time.Time{}, time.Time{}, false
+	}
+	endTime, err := time.Parse(time.RFC3339, endValue)
+	if err != nil {
+		http.Error(w, "Invalid end time format", http.StatusBadRequest)
+		return time.Time{}, time.Time{}, false
+	}
+	if !endTime.After(startTime) {
+		http.Error(w, "End time must be after start time", http.StatusBadRequest)
+		return time.Time{}, time.Time{}, false
+	}
+	return startTime.In(time.Local), endTime.In(time.Local), true
+}
+
+// minChargeParam parses the optional min_charge query parameter. On failure it writes a
+// 400 response and returns false.
+func minChargeParam(w http.ResponseWriter, params url.Values) (int, bool) {
+	value := params.Get("min_charge")
+	if value == "" {
+		return 0, true
+	}
+	minCharge, err := strconv.Atoi(value)
+	if err != nil || utils.ValidateChargeLevel(minCharge) != nil {
+		http.Error(w, "min_charge must be a number between 0 and 100", http.StatusBadRequest)
+		return 0, false
+	}
+	return minCharge, true
+}
+
+// GetNearbyVehicles finds the available vehicles closest to lat and lng, nearest first.
+// radius is in kilometres. Like the vehicle search it takes start_time and end_time to keep
+// vehicles free for that window, min_charge, and limit for the number of results.
+func GetNearbyVehicles(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	search := database.NearbySearch{RadiusKm: utils.DefaultNearbyRadiusKm, Limit: utils.DefaultNearbyLimit}
+
+	if params.Get("lat") == "" || params.Get("lng") == "" {
+		http.Error(w, "lat and lng are required", http.StatusBadRequest)
+		return
+	}
+	var err error
+	search.Latitude, err = strconv.ParseFloat(params.Get("lat"), 64)
+	if err != nil {
+		http.Error(w, "Invalid lat", http.StatusBadRequest)
+		return
+	}
+	search.Longitude, err = strconv.ParseFloat(params.Get("lng"), 64)
+	if err != nil {
+		http.Error(w, "Invalid lng", http.StatusBadRequest)
+		return
+	}
+	if err := utils.ValidateCoordinates(search.Latitude, search.Longitude); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if value := params.Get("radius"); value != "" {
+		search.RadiusKm, err = strconv.ParseFloat(value, 64)
+		if err != nil || !(search.RadiusKm > 0 && search.RadiusKm <= utils.MaxNearbyRadiusKm) {
+			http.Error(w, fmt.Sprintf("radius must be more than 0 and at most %g km", utils.MaxNearbyRadiusKm), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var ok bool
+	if search.StartTime, search.EndTime, ok = timeWindowParams(w, params); !ok {
+		return
+	}
+	if search.MinCharge, ok = minChargeParam(w, params); !ok {
+		return
+	}
+	if value := params.Get("limit"); value != "" {
+		search.Limit, err = strconv.Atoi(value)
+		if err != nil || search.Limit < 1 || search.Limit > utils.MaxNearbyLimit {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", utils.MaxNearbyLimit), http.StatusBadRequest)
+			return
+		}
+	}
+
+	vehicles, err := database.SearchNearbyVehicles(search)
 	if err != nil {
-		log.Printf("Error fetching available vehicles: %v", err) // Log the error
+		log.Printf("Error searching vehicles near %f,%f: %v", search.Latitude, search.Longitude, err)
 		http.Error(w, "Failed to fetch vehicles", http.StatusInternalServerError)
 		return
 	}
-	log.Printf("Fetched vehicles: %+v", vehicles) // Log the vehicles fetched
-	json.NewEncoder(w).Encode(vehicles)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"vehicles":  vehicles,
+		"count":     len(vehicles),
+		"latitude":  search.Latitude,
+		"longitude": search.Longitude,
+		"radius_km": search.RadiusKm,
+	})
+}
+
+// cursorSortValue converts the sort value of a decoded cursor back to what the sort
+// column holds
+func cursorSortValue(sort string, value interface{}) (interface{}, bool) {
+	switch sort {
+	case "id", "charge_level":
+		number, ok := value.(json.Number)
+		if !ok {
+			return nil, false
+		}
+		parsed, err := number.Int64()
+		return parsed, err == nil
+	case "created_at":
+		text, ok := value.(string)
+		if !ok {
+			return nil, false
+		}
+		parsed, err := time.Parse(time.RFC3339Nano, text)
+		return parsed.In(time.Local), err == nil
+	default:
+		text, ok := value.(string)
+		return text, ok
+	}
 }
 
 func BookVehicle(w http.ResponseWriter, r *http.Request) {
@@ -36,10 +268,14 @@ func BookVehicle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The pick-up station defaults to where the vehicle is parked and the drop-off station
+	// to the pick-up station; a different drop-off station makes it a one-way trip
 	var bookingRequest struct {
-		UserID    int    `json:"user_id"`
-		StartTime string `json:"start_time"`
-		EndTime   string `json:"end_time"`
+		UserID           int    `json:"user_id"`
+		StartTime        string `json:"start_time"`
+		EndTime          string `json:"end_time"`
+		PickupStationID  *int   `json:"pickup_station_id"`
+		DropoffStationID *int   `json:"dropoff_station_id"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&bookingRequest); err != nil {
@@ -47,9 +283,35 @@ func BookVehicle(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid input", http.StatusBadRequest)
 		return
 	}
+	if (bookingRequest.PickupStationID != nil && *bookingRequest.PickupStationID <= 0) ||
+		(bookingRequest.DropoffStationID != nil && *bookingRequest.DropoffStationID <= 0) {
+		http.Error(w, "Invalid station ID", http.StatusBadRequest)
+		return
+	}
 
 	log.Printf("Booking request: %+v", bookingRequest)
 
+	// The booking is always made for the authenticated caller
+	userID := auth.UserID(r)
+	if bookingRequest.UserID != 0 && bookingRequest.UserID != userID {
+		log.Printf("User %d attempted to book on behalf of user %d", userID, bookingRequest.UserID)
+		http.Error(w, "You can only book vehicles for yourself", http.StatusForbidden)
+		return
+	}
+
+	// Only verified accounts may book
+	verified, err := database.IsUserVerified(userID)
+	if err != nil {
+		log.Printf("Error checking verification of user %d: %v", userID, err)
+		http.Error(w, "Failed to book vehicle", http.StatusInternalServerError)
+		return
+	}
+	if !verified {
+		http.Error(w, "Please verify your email or phone before booking", http.StatusForbidden)
+		return
+	}
+	bookingRequest.UserID = userID
+
 	loc, _ := time.LoadLocation("Local") // Ensure local timezone
 
 	// Parse incoming UTC time and convert to local time
@@ -83,19 +345,69 @@ func BookVehicle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The licence must be approved and still valid when the vehicle is returned
+	licensed, err := database.HasApprovedLicence(userID, endTime)
+	if err != nil {
+		log.Printf("Error checking licence of user %d: %v", userID, err)
+		http.Error(w, "Failed to book vehicle", http.StatusInternalServerError)
+		return
+	}
+	if !licensed {
+		http.Error(w, "A valid, approved driver licence is required to book", http.StatusForbidden)
+		return
+	}
+
+	// The tier is read from the database because the token's tier claim may be out of date
+	benefits, err := database.FetchMembershipBenefits(userID)
+	if err != nil {
+		log.Printf("Error fetching membership of user %d: %v", userID, err)
+		http.Error(w, "Failed to book vehicle", http.StatusInternalServerError)
+		return
+	}
+	if !benefits.PriorityAccess {
+		releasedAt, highDemand, err := database.FetchVehicleDemand(vehicleID)
+		if err == database.ErrVehicleNotFound {
+			http.Error(w, "Vehicle not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Error fetching demand of vehicle %d: %v", vehicleID, err)
+			http.Error(w, "Failed to book vehicle", http.StatusInternalServerError)
+			return
+		}
+		if reason := utils.PriorityRestriction(releasedAt, highDemand, startTime, now); reason != "" {
+			http.Error(w, reason, http.StatusForbidden)
+			return
+		}
+	}
+
 	booking := models.Booking{
-		UserID:    bookingRequest.UserID,
-		VehicleID: vehicleID,
-		StartTime: startTime,
-		EndTime:   endTime,
-		Status:    "confirmed",
+		UserID:           bookingRequest.UserID,
+		VehicleID:        vehicleID,
+		StartTime:        startTime,
+		EndTime:          endTime,
+		Status:           "confirmed",
+		PickupStationID:  bookingRequest.PickupStationID,
+		DropoffStationID: bookingRequest.DropoffStationID,
 	}
 
 	log.Printf("Attempting to book vehicle ID=%d for user ID=%d", vehicleID, bookingRequest.UserID)
 
-	if err := database.CreateBooking(vehicleID, booking); err != nil {
+	bookingID, err := database.CreateBooking(vehicleID, &booking, benefits.BookingLimit)
+	if err != nil {
 		log.Printf("Error creating booking: %v", err)
-		if strings.Contains(err.Error(), "time range overlaps") {
+		if message, status, ok := bookingStationError(err); ok {
+			http.Error(w, message, status)
+		} else if err == database.ErrAccountSuspended {
+			http.Error(w, "Your account is suspended. Please contact support.", http.StatusForbidden)
+		} else if err == database.ErrVehicleNotFound {
+			http.Error(w, "Vehicle not found", http.StatusNotFound)
+		} else if err == database.ErrVehicleRetired {
+			http.Error(w, "This vehicle has been retired and can no longer be booked", http.StatusConflict)
+		} else if err == database.ErrBookingLimitReached {
+			http.Error(w, fmt.Sprintf("Your %s membership allows %d active bookings. Cancel a booking or upgrade your membership to book more.",
+				benefits.Tier, benefits.BookingLimit), http.StatusForbidden)
+		} else if strings.Contains(err.Error(), "time range overlaps") {
 			// Send a structured JSON response for the conflict
 			conflictDetails := strings.Split(err.Error(), " from ")
 			conflictStartEnd := strings.Split(conflictDetails[1], " to ")
@@ -107,8 +419,34 @@ func BookVehicle(w http.ResponseWriter, r *http.Request) {
 	}
 
 	log.Printf("Vehicle %d successfully booked by user %d", vehicleID, bookingRequest.UserID)
+	notifyBooking(bookingID, notify.TemplateBookingConfirmed, fmt.Sprintf("booking-confirmed-%d", bookingID))
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Vehicle booked successfully"})
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":            "Vehicle booked successfully",
+		"booking_id":         bookingID,
+		"pickup_station_id":  booking.PickupStationID,
+		"dropoff_station_id": booking.DropoffStationID,
+	})
+}
+
+// bookingStationError maps the errors of checking a booking's stations to a response. It
+// returns false for other errors.
+func bookingStationError(err error) (string, int, bool) {
+	switch err {
+	case database.ErrPickupStationMismatch:
+		return "The vehicle is not parked at that pick-up station when your booking starts", http.StatusConflict, true
+	case database.ErrPickupStationClosed:
+		return "The pick-up station is closed when your booking starts", http.StatusConflict, true
+	case database.ErrDropoffStationClosed:
+		return "The drop-off station is closed when your booking ends", http.StatusConflict, true
+	case database.ErrDropoffStationFull:
+		return "The drop-off station has no room left for another vehicle", http.StatusConflict, true
+	case database.ErrDropoffStrandsBooking:
+		return "The vehicle is booked afterwards from another station; return it to its pick-up station instead", http.StatusConflict, true
+	case database.ErrStationNotFound:
+		return "Pick-up or drop-off station not found", http.StatusBadRequest, true
+	}
+	return "", 0, false
 }
 
 func GetVehicleStatus(w http.ResponseWriter, r *http.Request) {
@@ -119,11 +457,17 @@ func GetVehicleStatus(w http.ResponseWriter, r *http.Request) {
 	}
 
 	status, err := database.FetchVehicleStatus(vehicleID)
+	if err == database.ErrVehicleStatusNotFound {
+		http.Error(w, "Vehicle status not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
+		log.Printf("Error fetching status of vehicle %d: %v", vehicleID, err)
 		http.Error(w, "Failed to fetch vehicle status", http.StatusInternalServerError)
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(status)
 }
 func GetBookingsForVehicle(w http.ResponseWriter, r *http.Request) {
@@ -139,15 +483,31 @@ func GetBookingsForVehicle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Other users' bookings only reveal the reserved time slots, not who made them
+	callerID := auth.UserID(r)
+	for i := range bookings {
+		if bookings[i].UserID != callerID {
+			bookings[i].UserID = 0
+		}
+	}
+
 	json.NewEncoder(w).Encode(bookings)
 }
 
 func GetBookings(w http.ResponseWriter, r *http.Request) {
-	userID, err := strconv.Atoi(r.URL.Query().Get("user_id"))
-	if err != nil || userID <= 0 {
-		log.Printf("Invalid user ID: %v", err)
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
-		return
+	// Default to the caller; an explicit user_id must be the caller's own
+	userID := auth.UserID(r)
+	if requested := r.URL.Query().Get("user_id"); requested != "" {
+		requestedID, err := strconv.Atoi(requested)
+		if err != nil || requestedID <= 0 {
+			log.Printf("Invalid user ID: %v", err)
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+		if requestedID != userID {
+			http.Error(w, "You can only view your own bookings", http.StatusForbidden)
+			return
+		}
 	}
 
 	log.Printf("Fetching bookings for user ID: %d", userID)
@@ -176,6 +536,10 @@ func ModifyBooking(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !authorizeBooking(w, r, bookingID) {
+		return
+	}
+
 	var updateRequest struct {
 		StartTime string `json:"start_time"`
 		EndTime   string `json:"end_time"`
@@ -214,8 +578,63 @@ func ModifyBooking(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The licence must still be approved and valid when the vehicle is returned at the new end time
+	userID := auth.UserID(r)
+	licensed, err := database.HasApprovedLicence(userID, endTime)
+	if err != nil {
+		log.Printf("Error checking licence of user %d: %v", userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to modify booking due to server error"})
+		return
+	}
+	if !licensed {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{"error": "A valid, approved driver licence is required to book"})
+		return
+	}
+
+	// Moving a booking must not get round the priority windows a new booking is held to
+	benefits, err := database.FetchMembershipBenefits(userID)
+	if err != nil {
+		log.Printf("Error fetching membership of user %d: %v", userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to modify booking due to server error"})
+		return
+	}
+	if !benefits.PriorityAccess {
+		vehicleID, err := database.FetchBookingVehicle(bookingID)
+		if err != nil {
+			log.Printf("Error fetching vehicle of booking %d: %v", bookingID, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Failed to modify booking due to server error"})
+			return
+		}
+		releasedAt, highDemand, err := database.FetchVehicleDemand(vehicleID)
+		if err != nil {
+			log.Printf("Error fetching demand of vehicle %d: %v", vehicleID, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Failed to modify booking due to server error"})
+			return
+		}
+		if reason := utils.PriorityRestriction(releasedAt, highDemand, startTime, now); reason != "" {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]string{"error": reason})
+			return
+		}
+	}
+
 	if err := database.ModifyBooking(bookingID, startTime, endTime); err != nil {
 		log.Printf("Error modifying booking: %v", err)
+		if message, status, ok := bookingStationError(err); ok {
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(map[string]string{"error": message})
+			return
+		}
+		if err == database.ErrAccountSuspended {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Your account is suspended. Please contact support."})
+			return
+		}
 		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to modify booking due to server error"})
 		w.WriteHeader(http.StatusInternalServerError)
 		return
@@ -232,6 +651,10 @@ func CancelBooking(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !authorizeBooking(w, r, bookingID) {
+		return
+	}
+
 	// Cancel booking in the database
 	if err := database.CancelBooking(bookingID); err != nil {
 		log.Printf("Error canceling booking: %v", err)
@@ -251,6 +674,10 @@ func FetchRentalHistoryByUser(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid user ID", http.StatusBadRequest)
 		return
 	}
+	if userID != auth.UserID(r) {
+		http.Error(w, "You can only view your own rental history", http.StatusForbidden)
+		return
+	}
 
 	// Fetch the user's rental history from the database
 	bookings, err := database.FetchRentalHistoryByUser(userID)
@@ -264,3 +691,66 @@ func FetchRentalHistoryByUser(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(bookings)
 }
+
+// authorizeBooking checks that the booking exists and belongs to the authenticated caller.
+// On failure it writes the error response and returns false.
+func authorizeBooking(w http.ResponseWriter, r *http.Request, bookingID int) bool {
+	ownerID, err := database.FetchBookingOwner(bookingID)
+	if err == database.ErrBookingNotFound {
+		http.Error(w, "Booking not found", http.StatusNotFound)
+		return false
+	}
+	if err != nil {
+		log.Printf("Error fetching owner of booking %d: %v", bookingID, err)
+		http.Error(w, "Failed to fetch booking", http.StatusInternalServerError)
+		return false
+	}
+
+	if ownerID != auth.UserID(r) {
+		log.Printf("User %d attempted to access booking %d owned by user %d", auth.UserID(r), bookingID, ownerID)
+		http.Error(w, "You can only manage your own bookings", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// notifyBooking queues a notification about the booking for its user. Failures are only
+// logged since the booking itself has already been saved.
+func notifyBooking(bookingID int, template, dedupeKey string) {
+	notice, err := database.FetchBookingNotice(bookingID)
+	if err != nil {
+		log.Printf("Error fetching booking %d for notification: %v", bookingID, err)
+		return
+	}
+	if _, err := notify.Notify(database.DB, utils.BookingNotification(notice, template, dedupeKey)); err != nil {
+		log.Printf("Error queuing %s notification for booking %d: %v", template, bookingID, err)
+	}
+}
+
+// ReturnBooking records that the caller handed the vehicle of their booking back
+func ReturnBooking(w http.ResponseWriter, r *http.Request) {
+	bookingID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || bookingID <= 0 {
+		http.Error(w, "Invalid booking ID", http.StatusBadRequest)
+		return
+	}
+
+	if !authorizeBooking(w, r, bookingID) {
+		return
+	}
+
+	err = database.MarkBookingReturned(bookingID)
+	if err == database.ErrBookingNotReturnable {
+		http.Error(w, "Only a booking that has started and not been returned yet can be returned", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error returning booking %d: %v", bookingID, err)
+		http.Error(w, "Failed to return vehicle", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Booking %d returned by user %d", bookingID, auth.UserID(r))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Vehicle returned successfully"})
+}
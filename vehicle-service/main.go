@@ -1,8 +1,12 @@
 package main
 
 import (
+	"cnad_assignment/shared/auth"
+	"cnad_assignment/shared/notify"
 	"cnad_assignment/vehicle-service/database"
+	"cnad_assignment/vehicle-service/models"
 	"cnad_assignment/vehicle-service/routes"
+	"cnad_assignment/vehicle-service/utils"
 	"fmt"
 	"log"
 	"net/http"
@@ -16,6 +20,9 @@ func main() {
 	// Initialize the database
 	database.InitDB()
 
+	// Verify access tokens with the public keys published by user-service
+	auth.SetKeySource(auth.NewJWKSCache(auth.DefaultJWKSURL))
+
 	// Create a new router
 	router := mux.NewRouter()
 
@@ -36,6 +43,9 @@ func main() {
 	// Start the real-time availability checker in a separate Goroutine
 	go startAvailabilityChecker()
 
+	// Queue booking reminders and overdue return alerts
+	go startBookingNotifier()
+
 	// Start the server
 	port := ":8082" // Use a different port to avoid conflicts with the user-service
 	fmt.Printf("Vehicle service is running on http://localhost%s\n", port)
@@ -59,3 +69,45 @@ func startAvailabilityChecker() {
 		}
 	}
 }
+
+// startBookingNotifier periodically queues reminders for bookings about to start and alerts
+// for vehicles that were not returned on time. Dedupe keys make sure each is sent once.
+func startBookingNotifier() {
+	ticker := time.NewTicker(utils.BookingNotifierInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			now := time.Now()
+
+			upcoming, err := database.FetchBookingsStartingBefore(now, now.Add(utils.BookingReminderLead))
+			if err != nil {
+				log.Printf("Error fetching upcoming bookings: %v", err)
+			}
+			for _, notice := range upcoming {
+				// The start time is part of the key so a booking moved to a new time is reminded again
+				key := fmt.Sprintf("booking-reminder-%d-%d", notice.BookingID, notice.StartTime.Unix())
+				queueBookingNotification(notice, notify.TemplateBookingReminder, key)
+			}
+
+			overdue, err := database.FetchOverdueReturns(now, now.Add(-utils.ReturnGracePeriod))
+			if err != nil {
+				log.Printf("Error fetching overdue returns: %v", err)
+			}
+			for _, notice := range overdue {
+				queueBookingNotification(notice, notify.TemplateReturnOverdue, fmt.Sprintf("return-overdue-%d", notice.BookingID))
+			}
+		}
+	}
+}
+
+// queueBookingNotification queues a notification about a booking, logging any failure
+func queueBookingNotification(notice models.BookingNotice, template, dedupeKey string) {
+	queued, err := notify.Notify(database.DB, utils.BookingNotification(notice, template, dedupeKey))
+	if err != nil {
+		log.Printf("Error queuing %s notification for booking %d: %v", template, notice.BookingID, err)
+	} else if queued > 0 {
+		log.Printf("Queued %s notification for booking %d", template, notice.BookingID)
+	}
+}
@@ -3,12 +3,52 @@ package models
 import "time"
 
 type Vehicle struct {
-	ID                 int       `json:"id"`
-	Make               string    `json:"make"`
-	Model              string    `json:"model"`
-	RegistrationNumber string    `json:"registration_number"`
-	IsAvailable        bool      `json:"is_available"`
-	CreatedAt          time.Time `json:"created_at"`
+	ID                 int        `json:"id"`
+	Make               string     `json:"make"`
+	Model              string     `json:"model"`
+	RegistrationNumber string     `json:"registration_number"`
+	IsAvailable        bool       `json:"is_available"`
+	HighDemand         bool       `json:"high_demand"`
+	ReleasedAt         *time.Time `json:"released_at,omitempty"` // When the vehicle was added or returned to service
+	CreatedAt          time.Time  `json:"created_at"`
+	HomeStationID      *int       `json:"home_station_id,omitempty"` // Station the vehicle is parked at between trips
+
+	RetiredAt        *time.Time `json:"retired_at,omitempty"` // Set once the vehicle is taken out of the fleet for good
+	RetirementReason string     `json:"retirement_reason,omitempty"`
+}
+
+// VehicleListing is a vehicle in search results together with its latest status. The
+// status fields are empty for vehicles that have never reported one.
+type VehicleListing struct {
+	Vehicle
+	Location    string `json:"location,omitempty"`
+	ChargeLevel *int   `json:"charge_level,omitempty"`
+	Cleanliness string `json:"cleanliness,omitempty"`
+}
+
+// NearbyVehicle is a vehicle found by the nearby search, with where it is and how far away.
+// Vehicles that have not reported their position are placed at the station they are parked at.
+type NearbyVehicle struct {
+	VehicleListing
+	Latitude    float64 `json:"latitude"`
+	Longitude   float64 `json:"longitude"`
+	DistanceKm  float64 `json:"distance_km"`
+	StationID   *int    `json:"station_id,omitempty"`
+	StationName string  `json:"station_name,omitempty"`
+}
+
+// Station is a named place where vehicles are parked. OpensAt and ClosesAt are local times
+// as HH:MM, both empty for stations that never close.
+type Station struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Address   string    `json:"address,omitempty"`
+	Latitude  float64   `json:"latitude"`
+	Longitude float64   `json:"longitude"`
+	Capacity  int       `json:"capacity"`
+	OpensAt   string    `json:"opens_at,omitempty"`
+	ClosesAt  string    `json:"closes_at,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 type Booking struct {
@@ -19,6 +59,11 @@ type Booking struct {
 	EndTime   time.Time `json:"end_time"`   // Updated to time.Time
 	Status    string    `json:"status"`
 	CreatedAt time.Time `json:"created_at"`
+
+	// Stations the vehicle is picked up at and handed back to, unset for vehicles that
+	// are not parked at a station. A different drop-off station makes it a one-way trip.
+	PickupStationID  *int `json:"pickup_station_id,omitempty"`
+	DropoffStationID *int `json:"dropoff_station_id,omitempty"`
 }
 
 type VehicleStatus struct {
@@ -27,4 +72,40 @@ type VehicleStatus struct {
 	ChargeLevel int    `json:"charge_level"`
 	Cleanliness string `json:"cleanliness"`
 	UpdatedAt   string `json:"updated_at"`
+
+	// Latest telemetry, empty until the vehicle's device has reported
+	Latitude   *float64   `json:"latitude,omitempty"`
+	Longitude  *float64   `json:"longitude,omitempty"`
+	OdometerKm *float64   `json:"odometer_km,omitempty"`
+	ReportedAt *time.Time `json:"reported_at,omitempty"`
+
+	StationID *int `json:"station_id,omitempty"` // Station the vehicle is parked at, if any
+}
+
+// TelemetryReading is one report from a vehicle's device. Cleanliness is empty when the
+// device did not report it.
+type TelemetryReading struct {
+	VehicleID   int       `json:"vehicle_id"`
+	Latitude    float64   `json:"latitude"`
+	Longitude   float64   `json:"longitude"`
+	ChargeLevel int       `json:"charge_level"`
+	OdometerKm  float64   `json:"odometer_km"`
+	Cleanliness string    `json:"cleanliness,omitempty"`
+	RecordedAt  time.Time `json:"recorded_at"`
+}
+
+// MembershipBenefits are the booking rules that come with a user's membership tier
+type MembershipBenefits struct {
+	Tier           string
+	BookingLimit   int // Maximum active bookings; 0 means no limit
+	PriorityAccess bool
+}
+
+// BookingNotice is what booking notifications tell the user about a booking
+type BookingNotice struct {
+	BookingID int
+	UserID    int
+	Vehicle   string // Make, model and registration number
+	StartTime time.Time
+	EndTime   time.Time
 }
@@ -1,7 +1,10 @@
 package routes
 
 import (
+	"cnad_assignment/shared/auth"
+	"cnad_assignment/vehicle-service/database"
 	"cnad_assignment/vehicle-service/handlers"
+	"net/http"
 
 	"github.com/gorilla/mux"
 	"github.com/rs/cors"
@@ -18,15 +21,49 @@ func RegisterVehicleRoutes(router *mux.Router) {
 	// Wrap your routes with the CORS middleware
 	vehicleRouter := router.PathPrefix("/api/v1").Subrouter()
 	vehicleRouter.HandleFunc("/vehicles", handlers.GetAvailableVehicles).Methods("GET")
-	vehicleRouter.HandleFunc("/vehicles/{id:[0-9]+}/book", handlers.BookVehicle).Methods("POST")
+	vehicleRouter.HandleFunc("/vehicles/nearby", handlers.GetNearbyVehicles).Methods("GET")
 	vehicleRouter.HandleFunc("/vehicles/{id:[0-9]+}/status", handlers.GetVehicleStatus).Methods("GET")
-	vehicleRouter.HandleFunc("/vehicles/{id:[0-9]+}/bookings", handlers.GetBookingsForVehicle).Methods("GET")
-	vehicleRouter.HandleFunc("/bookings", handlers.GetBookings).Methods("GET")
-	vehicleRouter.HandleFunc("/bookings/{id}", handlers.ModifyBooking).Methods("PUT")
-	vehicleRouter.HandleFunc("/bookings/{id}", handlers.CancelBooking).Methods("DELETE")
+	vehicleRouter.HandleFunc("/stations", handlers.GetStations).Methods("GET")
 
-	// Register the route for fetching rental history by user ID
-	router.HandleFunc("/api/v1/users/{id}/rental-history", handlers.FetchRentalHistoryByUser).Methods("GET")
+	// Routes scripts may also call with a personal API key holding the route's scope
+	scriptRouter := router.PathPrefix("/api/v1").Subrouter()
+	scriptRouter.Handle("/vehicles/{id:[0-9]+}/book", withScope(auth.ScopeBookingsWrite, handlers.BookVehicle)).Methods("POST")
+	scriptRouter.Handle("/bookings", withScope(auth.ScopeBookingsRead, handlers.GetBookings)).Methods("GET")
+	scriptRouter.Handle("/users/{id}/rental-history", withScope(auth.ScopeBookingsRead, handlers.FetchRentalHistoryByUser)).Methods("GET")
+
+	// Vehicle devices report telemetry with an API key of a fleet staff account
+	telemetry := auth.RequirePermission(database.DB, auth.PermFleetManage)(http.HandlerFunc(handlers.IngestTelemetry))
+	scriptRouter.Handle("/vehicles/{id:[0-9]+}/telemetry", auth.APIKeyMiddleware(database.DB, auth.ScopeTelemetryWrite)(telemetry)).Methods("POST")
+
+	// Booking routes require a valid access token; the user is taken from the token
+	bookingRouter := router.PathPrefix("/api/v1").Subrouter()
+	bookingRouter.Use(auth.Middleware(database.DB))
+	bookingRouter.HandleFunc("/vehicles/{id:[0-9]+}/bookings", handlers.GetBookingsForVehicle).Methods("GET")
+	bookingRouter.HandleFunc("/bookings/{id}", handlers.ModifyBooking).Methods("PUT")
+	bookingRouter.HandleFunc("/bookings/{id}", handlers.CancelBooking).Methods("DELETE")
+	bookingRouter.HandleFunc("/bookings/{id:[0-9]+}/return", handlers.ReturnBooking).Methods("POST")
+
+	// Fleet operations for staff with the fleet:manage permission
+	adminRouter := router.PathPrefix("/api/v1/admin").Subrouter()
+	adminRouter.Use(auth.Middleware(database.DB), auth.RequirePermission(database.DB, auth.PermFleetManage))
+	adminRouter.HandleFunc("/vehicles", handlers.AdminListFleet).Methods("GET")
+	adminRouter.HandleFunc("/vehicles", handlers.AdminCreateVehicle).Methods("POST")
+	adminRouter.HandleFunc("/vehicles/{id:[0-9]+}", handlers.AdminGetVehicle).Methods("GET")
+	adminRouter.HandleFunc("/vehicles/{id:[0-9]+}", handlers.AdminUpdateVehicle).Methods("PUT")
+	adminRouter.HandleFunc("/vehicles/{id:[0-9]+}", handlers.AdminDeleteVehicle).Methods("DELETE")
+	adminRouter.HandleFunc("/vehicles/{id:[0-9]+}/retire", handlers.AdminRetireVehicle).Methods("POST")
+	adminRouter.HandleFunc("/vehicles/{id:[0-9]+}/telemetry", handlers.AdminGetTelemetry).Methods("GET")
+	adminRouter.HandleFunc("/vehicles/{id:[0-9]+}/station", handlers.AdminParkVehicle).Methods("PUT")
+	adminRouter.HandleFunc("/stations", handlers.AdminCreateStation).Methods("POST")
+	adminRouter.HandleFunc("/stations/{id:[0-9]+}", handlers.AdminUpdateStation).Methods("PUT")
+	adminRouter.HandleFunc("/vehicles/{id:[0-9]+}/availability", handlers.AdminSetVehicleAvailability).Methods("PUT")
+	adminRouter.HandleFunc("/vehicles/{id:[0-9]+}/high-demand", handlers.AdminSetVehicleHighDemand).Methods("PUT")
+	adminRouter.HandleFunc("/bookings/{id:[0-9]+}", handlers.AdminCancelBooking).Methods("DELETE")
 	// Apply CORS middleware
 	c.Handler(vehicleRouter)
 }
+
+// withScope wraps a handler so it accepts access tokens and API keys holding the scope
+func withScope(scope string, handler http.HandlerFunc) http.Handler {
+	return auth.APIKeyMiddleware(database.DB, scope)(handler)
+}
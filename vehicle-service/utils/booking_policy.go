@@ -0,0 +1,26 @@
+package utils
+
+import (
+	"fmt"
+	"time"
+)
+
+// PriorityReleaseWindow is how long after release a vehicle can only be booked by priority members
+const PriorityReleaseWindow = 24 * time.Hour
+
+// StandardAdvanceWindow is how far ahead members without priority access can book high-demand vehicles
+const StandardAdvanceWindow = 3 * 24 * time.Hour
+
+// PriorityRestriction explains why a member without priority access cannot book the vehicle
+// for the given start time yet. It returns an empty string when nothing stands in the way.
+func PriorityRestriction(releasedAt *time.Time, highDemand bool, startTime, now time.Time) string {
+	if releasedAt != nil && now.Before(releasedAt.Add(PriorityReleaseWindow)) {
+		return fmt.Sprintf("This vehicle is reserved for priority members until %s",
+			releasedAt.Add(PriorityReleaseWindow).Format(time.RFC1123))
+	}
+	if highDemand && startTime.After(now.Add(StandardAdvanceWindow)) {
+		return fmt.Sprintf("This vehicle is in high demand; your membership can book it at most %d days ahead",
+			int(StandardAdvanceWindow.Hours()/24))
+	}
+	return ""
+}
@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+// Page sizes of the vehicle search
+const (
+	DefaultSearchLimit = 20
+	MaxSearchLimit     = 100
+)
+
+// SearchCursor marks where a page of search results ended: the sort it was made with and
+// the sort value and ID of the last result. Clients pass it back as an opaque string.
+type SearchCursor struct {
+	Sort       string      `json:"s"`
+	Descending bool        `json:"d"`
+	Value      interface{} `json:"v"`
+	ID         int         `json:"id"`
+}
+
+// errInvalidCursor is returned for cursors that were not made by EncodeCursor
+var errInvalidCursor = errors.New("invalid cursor")
+
+// EncodeCursor turns a cursor into the string handed to clients
+func EncodeCursor(cursor SearchCursor) (string, error) {
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// DecodeCursor parses a cursor string from a client. Numbers in the sort value come back
+// as json.Number.
+func DecodeCursor(raw string) (SearchCursor, error) {
+	var cursor SearchCursor
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return cursor, errInvalidCursor
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&cursor); err != nil || cursor.ID <= 0 {
+		return cursor, errInvalidCursor
+	}
+	return cursor, nil
+}
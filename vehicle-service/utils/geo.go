@@ -0,0 +1,37 @@
+package utils
+
+import "math"
+
+// Radius of the nearby search in kilometres
+const (
+	DefaultNearbyRadiusKm = 5.0
+	MaxNearbyRadiusKm     = 50.0
+)
+
+// Result sizes of the nearby search
+const (
+	DefaultNearbyLimit = 20
+	MaxNearbyLimit     = 100
+)
+
+// kmPerDegreeLatitude is the length of one degree of latitude
+const kmPerDegreeLatitude = 111.32
+
+// BoundingBox returns the latitudes and longitudes of a box around a point that contains
+// every point within radiusKm of it, so that a search can skip rows that are clearly too
+// far away before computing exact distances. Near the poles and the antimeridian the
+// longitudes cover the whole globe.
+func BoundingBox(latitude, longitude, radiusKm float64) (minLat, maxLat, minLng, maxLng float64) {
+	deltaLat := radiusKm / kmPerDegreeLatitude
+	minLat, maxLat = math.Max(latitude-deltaLat, -90), math.Min(latitude+deltaLat, 90)
+
+	cosLat := math.Cos(math.Max(math.Abs(minLat), math.Abs(maxLat)) * math.Pi / 180)
+	if cosLat < 1e-6 {
+		return minLat, maxLat, -180, 180
+	}
+	deltaLng := radiusKm / (kmPerDegreeLatitude * cosLat)
+	if longitude-deltaLng < -180 || longitude+deltaLng > 180 {
+		return minLat, maxLat, -180, 180
+	}
+	return minLat, maxLat, longitude - deltaLng, longitude + deltaLng
+}
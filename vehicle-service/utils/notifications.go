@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"cnad_assignment/shared/notify"
+	"cnad_assignment/vehicle-service/models"
+	"time"
+)
+
+// BookingNotifierInterval is how often reminders and overdue return alerts are checked for
+const BookingNotifierInterval = time.Minute
+
+// BookingReminderLead is how long before a booking starts its reminder is sent
+const BookingReminderLead = time.Hour
+
+// ReturnGracePeriod is how long after a booking ends the overdue return alert is sent
+const ReturnGracePeriod = 15 * time.Minute
+
+// BookingNotification is the notification about a booking for the user who made it
+func BookingNotification(notice models.BookingNotice, template, dedupeKey string) notify.Notification {
+	return notify.Notification{
+		UserID:   notice.UserID,
+		Template: template,
+		Data: notify.Data{
+			"BookingID": notice.BookingID,
+			"Vehicle":   notice.Vehicle,
+			"StartTime": notice.StartTime,
+			"EndTime":   notice.EndTime,
+		},
+		DedupeKey: dedupeKey,
+	}
+}
@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"errors"
+	"time"
+)
+
+// MaxStationCapacity is the most vehicles a station may be given room for
+const MaxStationCapacity = 1000
+
+// stationTimeLayout is how opening hours are written
+const stationTimeLayout = "15:04"
+
+// ValidateStationCapacity checks that a station has room for at least one vehicle
+func ValidateStationCapacity(capacity int) error {
+	if capacity < 1 || capacity > MaxStationCapacity {
+		return errors.New("capacity must be between 1 and 1000")
+	}
+	return nil
+}
+
+// ValidateStationHours checks opening hours given as HH:MM. Both must be empty for a station
+// that never closes, or both set and different.
+func ValidateStationHours(opensAt, closesAt string) error {
+	if opensAt == "" && closesAt == "" {
+		return nil
+	}
+	if opensAt == "" || closesAt == "" {
+		return errors.New("opens_at and closes_at must be given together")
+	}
+	opens, err := time.Parse(stationTimeLayout, opensAt)
+	if err != nil {
+		return errors.New("opens_at must be a time as HH:MM")
+	}
+	closes, err := time.Parse(stationTimeLayout, closesAt)
+	if err != nil {
+		return errors.New("closes_at must be a time as HH:MM")
+	}
+	if opens.Equal(closes) {
+		return errors.New("opens_at and closes_at must differ; leave both out for a station that never closes")
+	}
+	return nil
+}
+
+// StationOpenAt reports whether a station with the given opening hours is open at t, in
+// local time. Stations without opening hours are always open, and a closing time before
+// the opening time means the station is open overnight.
+func StationOpenAt(opensAt, closesAt string, t time.Time) bool {
+	if opensAt == "" || closesAt == "" {
+		return true
+	}
+	opens, err1 := time.Parse(stationTimeLayout, opensAt)
+	closes, err2 := time.Parse(stationTimeLayout, closesAt)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+
+	local := t.In(time.Local)
+	minute := local.Hour()*60 + local.Minute()
+	opensMinute := opens.Hour()*60 + opens.Minute()
+	closesMinute := closes.Hour()*60 + closes.Minute()
+	if opensMinute < closesMinute {
+		return minute >= opensMinute && minute < closesMinute
+	}
+	return minute >= opensMinute || minute < closesMinute
+}
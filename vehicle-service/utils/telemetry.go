@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"errors"
+	"time"
+)
+
+// Page sizes of the telemetry history
+const (
+	DefaultTelemetryLimit = 100
+	MaxTelemetryLimit     = 1000
+)
+
+// TelemetryHistoryWindow is how far back the telemetry history goes when no start is given
+const TelemetryHistoryWindow = 24 * time.Hour
+
+// MaxTelemetryClockSkew is how far in the future a device's clock may be before its
+// readings are rejected
+const MaxTelemetryClockSkew = 5 * time.Minute
+
+// MaxTelemetryAge is how old a reading may be. Devices that were offline send what they
+// buffered once they reconnect.
+const MaxTelemetryAge = 7 * 24 * time.Hour
+
+// ValidateCoordinates checks that a latitude and longitude are on the globe. The
+// comparisons are written so that NaN fails them.
+func ValidateCoordinates(latitude, longitude float64) error {
+	if !(latitude >= -90 && latitude <= 90) {
+		return errors.New("latitude must be between -90 and 90")
+	}
+	if !(longitude >= -180 && longitude <= 180) {
+		return errors.New("longitude must be between -180 and 180")
+	}
+	return nil
+}
+
+// ValidateOdometer checks that an odometer reading in kilometres is not negative and fits its column
+func ValidateOdometer(odometerKm float64) error {
+	if !(odometerKm >= 0 && odometerKm < 1e9) {
+		return errors.New("odometer_km must be between 0 and 999999999")
+	}
+	return nil
+}
+
+// ValidateRecordedAt checks that a reading's device time is neither in the future nor too old
+func ValidateRecordedAt(recordedAt, now time.Time) error {
+	if recordedAt.After(now.Add(MaxTelemetryClockSkew)) {
+		return errors.New("recorded_at is in the future")
+	}
+	if recordedAt.Before(now.Add(-MaxTelemetryAge)) {
+		return errors.New("recorded_at is more than 7 days ago")
+	}
+	return nil
+}
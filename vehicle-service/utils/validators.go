@@ -2,6 +2,8 @@ package utils
 
 import (
 	"errors"
+	"regexp"
+	"strings"
 	"time"
 )
 
@@ -51,3 +53,20 @@ func ValidateCleanliness(cleanliness string) error {
 
 	return nil
 }
+
+// registrationPattern is a normalized registration number: letters and digits only
+var registrationPattern = regexp.MustCompile(`^[A-Z0-9]{2,12}$`)
+
+// NormalizeRegistration upper-cases a registration number and drops spaces and hyphens,
+// so "sgx 1234-a" and "SGX1234A" are the same vehicle
+func NormalizeRegistration(registration string) string {
+	return strings.NewReplacer(" ", "", "-", "").Replace(strings.ToUpper(strings.TrimSpace(registration)))
+}
+
+// ValidateRegistration checks that a normalized registration number is 2 to 12 letters and digits
+func ValidateRegistration(registration string) error {
+	if !registrationPattern.MatchString(registration) {
+		return errors.New("registration number must be 2 to 12 letters and digits")
+	}
+	return nil
+}